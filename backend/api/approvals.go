@@ -0,0 +1,176 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/validator"
+)
+
+// listApprovalsHandler lists the approvals waiting on the current user.
+func (app *Application) listApprovalsHandler(w http.ResponseWriter, r *http.Request) {
+	approvals, err := app.models.Approvals.GetPendingForUser(app.contextGetUser(r).Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"approvals": approvals}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) showApprovalHandler(w http.ResponseWriter, r *http.Request) {
+	approval, _, _, ok := app.getVisibleApproval(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"approval": approval}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) approveHandler(w http.ResponseWriter, r *http.Request) {
+	app.decideApproval(w, r, data.ApprovalStatusApproved)
+}
+
+func (app *Application) rejectHandler(w http.ResponseWriter, r *http.Request) {
+	app.decideApproval(w, r, data.ApprovalStatusRejected)
+}
+
+// decideApproval records the decision and queues the run so it continues
+// down the matching branch. When the run hasn't been saved as waiting yet,
+// Resume fails with an edit conflict and the scheduler queues the run with
+// the next QueueDue instead. Expired approvals and approvals of runs that
+// already finished, like cancelled ones, can't be decided.
+func (app *Application) decideApproval(w http.ResponseWriter, r *http.Request, status string) {
+	var input struct {
+		Comment string `json:"comment"`
+	}
+
+	if r.ContentLength != 0 {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	v := validator.New()
+	v.Check(len(input.Comment) <= 2000, "comment", "must not be more than 2000 bytes long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	approval, run, role, ok := app.getVisibleApproval(w, r)
+	if !ok {
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if !approval.CanDecide(user.Id, role) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if run.Finished() {
+		app.errorResponse(w, r, http.StatusConflict, "the run is no longer running")
+		return
+	}
+
+	approval.Status = status
+	approval.Comment = input.Comment
+	approval.DecidedBy = sql.NullString{String: user.Id, Valid: true}
+
+	err := app.models.Approvals.Decide(approval)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict) && approval.Expired(time.Now()):
+			app.errorResponse(w, r, http.StatusConflict, "the approval has expired")
+		case errors.Is(err, data.ErrEditConflict):
+			app.errorResponse(w, r, http.StatusConflict, "the approval has already been decided")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Runs.Resume(approval.RunId)
+	if errors.Is(err, data.ErrEditConflict) {
+		// The run isn't waiting: either it hasn't been saved as waiting
+		// yet, and QueueDue picks the decision up, or it finished.
+		run, err = app.models.Runs.Get(approval.RunId)
+		if err == nil && run.Finished() {
+			app.errorResponse(w, r, http.StatusConflict, "the run is no longer running")
+			return
+		}
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"approval": approval}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getVisibleApproval loads the approval in the id URL param along with its
+// run and the role of the current user in the workspace of its workflow. Only members
+// of the workspace can see an approval, assignees included; anyone else
+// gets a not found response.
+func (app *Application) getVisibleApproval(w http.ResponseWriter, r *http.Request) (*data.Approval, *data.WorkflowRun, string, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, nil, "", false
+	}
+
+	approval, err := app.models.Approvals.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, "", false
+	}
+
+	run, err := app.models.Runs.Get(approval.RunId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, nil, "", false
+	}
+
+	workspaceId, err := app.models.Workflows.GetWorkspaceId(run.WorkflowId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, nil, "", false
+	}
+
+	userId := app.contextGetUser(r).Id
+
+	role, err := app.models.Workspaces.GetRole(workspaceId, userId)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return nil, nil, "", false
+	}
+
+	if role == "" {
+		app.notFoundResponse(w, r)
+		return nil, nil, "", false
+	}
+
+	return approval, run, role, true
+}
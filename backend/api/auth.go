@@ -1,12 +1,25 @@
 package api
 
 import (
+	"context"
 	"net/http"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+)
+
+const (
+	authenticationTokenTTL = 24 * time.Hour
+	tokenCleanupInterval   = time.Hour
 )
 
 func (app *Application) githubCallbackHandler(w http.ResponseWriter, r *http.Request) {
 
 	code := r.URL.Query().Get("code")
+	if code == "" {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
 
 	accessToken, err := app.oauhtService.GetGithubAccessToken(code)
 	if err != nil {
@@ -14,10 +27,79 @@ func (app *Application) githubCallbackHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if accessToken == "" {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
 	userData, err := app.oauhtService.GetGithubData(accessToken)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	user := &data.User{
+		GithubLogin: userData.Login,
+		Name:        userData.Name,
+		Email:       userData.Email,
+		AvatarUrl:   userData.AvatarUrl,
+	}
+
+	err = app.models.Users.UpsertGithub(user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Workspaces.InsertPersonal(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.Id, authenticationTokenTTL, data.ScopeAuthentication)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"user": user, "authentication_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// logoutHandler revokes the token the request was authenticated with.
+// Other sessions of the user keep their tokens.
+func (app *Application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	token, _ := bearerToken(r)
+
+	err := app.models.Tokens.Delete(data.ScopeAuthentication, token)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteExpiredTokens removes expired tokens every tokenCleanupInterval
+// until ctx is cancelled.
+func (app *Application) deleteExpiredTokens(ctx context.Context) {
+	ticker := time.NewTicker(tokenCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := app.models.Tokens.DeleteExpired()
+			if err != nil {
+				app.logger.Error(err.Error())
+			} else if n > 0 {
+				app.logger.Info("deleted expired tokens", "count", n)
+			}
+		}
+	}
 }
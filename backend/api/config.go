@@ -1,29 +1,388 @@
 package api
 
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
 type Config struct {
-	Port int
-	Env  string
-	DB   struct {
-		DSN          string
-		MaxOpenConns int
-		MaxIdleConns int
-		MaxIdleTime  string
-	}
+	Port          int           `yaml:"port" toml:"port"`
+	Env           string        `yaml:"env" toml:"env"`
+	ShutdownDelay time.Duration `yaml:"shutdownDelay" toml:"shutdownDelay"`
+	DB            struct {
+		DSN          string `yaml:"dsn" toml:"dsn"`
+		MaxOpenConns int    `yaml:"maxOpenConns" toml:"maxOpenConns"`
+		MaxIdleConns int    `yaml:"maxIdleConns" toml:"maxIdleConns"`
+		MaxIdleTime  string `yaml:"maxIdleTime" toml:"maxIdleTime"`
+		AutoMigrate  bool   `yaml:"autoMigrate" toml:"autoMigrate"`
+	} `yaml:"db" toml:"db"`
 	Limiter struct {
-		RPS     float64
-		Burst   int
-		Enabled bool
-	}
+		RPS            float64  `yaml:"rps" toml:"rps"`
+		Burst          int      `yaml:"burst" toml:"burst"`
+		Enabled        bool     `yaml:"enabled" toml:"enabled"`
+		TrustedProxies []string `yaml:"trustedProxies" toml:"trustedProxies"`
+		Webhooks       struct {
+			RPS   float64 `yaml:"rps" toml:"rps"`
+			Burst int     `yaml:"burst" toml:"burst"`
+		} `yaml:"webhooks" toml:"webhooks"`
+	} `yaml:"limiter" toml:"limiter"`
+	Engine struct {
+		Workers         int           `yaml:"workers" toml:"workers"`
+		PollInterval    time.Duration `yaml:"pollInterval" toml:"pollInterval"`
+		DedupeRetention time.Duration `yaml:"dedupeRetention" toml:"dedupeRetention"`
+		RunLease        time.Duration `yaml:"runLease" toml:"runLease"`
+		RetryAttempts   int           `yaml:"retryAttempts" toml:"retryAttempts"`
+		RetryBackoff    time.Duration `yaml:"retryBackoff" toml:"retryBackoff"`
+	} `yaml:"engine" toml:"engine"`
 	Cors struct {
-		TrustedOrigins []string
-	}
+		TrustedOrigins []string `yaml:"trustedOrigins" toml:"trustedOrigins"`
+	} `yaml:"cors" toml:"cors"`
+	Tracing struct {
+		Exporter    string  `yaml:"exporter" toml:"exporter"`
+		Endpoint    string  `yaml:"endpoint" toml:"endpoint"`
+		SampleRatio float64 `yaml:"sampleRatio" toml:"sampleRatio"`
+		ServiceName string  `yaml:"serviceName" toml:"serviceName"`
+	} `yaml:"tracing" toml:"tracing"`
 	Providers struct {
 		Github struct {
-			ClientId     string
-			ClientSecret string
-			Url          string
-			RedirectUrl  string
-			UserUrl      string
+			ClientId     string `yaml:"clientId" toml:"clientId"`
+			ClientSecret string `yaml:"clientSecret" toml:"clientSecret"`
+			Url          string `yaml:"url" toml:"url"`
+			RedirectUrl  string `yaml:"redirectUrl" toml:"redirectUrl"`
+			UserUrl      string `yaml:"userUrl" toml:"userUrl"`
+		} `yaml:"github" toml:"github"`
+		Http struct {
+			AllowedHosts []string `yaml:"allowedHosts" toml:"allowedHosts"`
+			DeniedHosts  []string `yaml:"deniedHosts" toml:"deniedHosts"`
+		} `yaml:"http" toml:"http"`
+	} `yaml:"providers" toml:"providers"`
+}
+
+// EnvPrefix is the prefix of the environment variables that set the config.
+// Every flag has one: -db-dsn is CONFLUO_DB_DSN, -providers-github-client-id
+// is CONFLUO_PROVIDERS_GITHUB_CLIENT_ID.
+const EnvPrefix = "CONFLUO_"
+
+const redacted = "[REDACTED]"
+
+// LoadConfig builds the config from, in order of precedence, the
+// command-line flags, the CONFLUO_* environment variables, the config file
+// and the defaults. The config file is optional and set with -config or
+// CONFLUO_CONFIG; it can be YAML (.yaml, .yml) or TOML (.toml). The
+// arguments left after the flags, like a subcommand, are returned with it.
+// The config isn't validated, since what's required depends on the command;
+// call Validate before serving.
+func LoadConfig(args []string, getenv func(string) string, output io.Writer) (Config, []string, error) {
+	var cfg Config
+
+	fs := flag.NewFlagSet("confluo", flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	configFile := fs.String("config", "", "Path to a YAML or TOML config file")
+
+	fs.IntVar(&cfg.Port, "port", 4000, "API server port")
+	fs.StringVar(&cfg.Env, "env", "development", "Environment (development|staging|production)")
+	fs.DurationVar(&cfg.ShutdownDelay, "shutdown-delay", 0, "How long /readyz fails on shutdown before the server stops accepting connections")
+
+	fs.StringVar(&cfg.DB.DSN, "db-dsn", "", "PostgreSQL DSN")
+	fs.IntVar(&cfg.DB.MaxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
+	fs.IntVar(&cfg.DB.MaxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
+	fs.StringVar(&cfg.DB.MaxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
+	fs.BoolVar(&cfg.DB.AutoMigrate, "db-auto-migrate", false, "Apply pending migrations on startup")
+
+	fs.Float64Var(&cfg.Limiter.RPS, "limiter-rps", 2, "Rate limiter maximum requests per second")
+	fs.IntVar(&cfg.Limiter.Burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	fs.BoolVar(&cfg.Limiter.Enabled, "limiter-enabled", true, "Enable rate limiter")
+	fs.Var(stringList{&cfg.Limiter.TrustedProxies}, "limiter-trusted-proxies", "Proxies whose X-Forwarded-For and X-Real-IP headers are trusted (comma separated IPs or CIDRs)")
+	fs.Float64Var(&cfg.Limiter.Webhooks.RPS, "limiter-webhooks-rps", 10, "Rate limiter maximum webhook requests per second")
+	fs.IntVar(&cfg.Limiter.Webhooks.Burst, "limiter-webhooks-burst", 20, "Rate limiter maximum webhook burst")
+
+	fs.IntVar(&cfg.Engine.Workers, "engine-workers", 4, "Number of workers executing runs")
+	fs.DurationVar(&cfg.Engine.PollInterval, "engine-poll-interval", 30*time.Second, "How often triggers are polled")
+	fs.DurationVar(&cfg.Engine.DedupeRetention, "engine-dedupe-retention", 24*time.Hour, "How long trigger dedupe keys are kept")
+	fs.DurationVar(&cfg.Engine.RunLease, "engine-run-lease", 2*time.Minute, "How long a run stays with a worker that stopped sending heartbeats before it is taken back")
+	fs.IntVar(&cfg.Engine.RetryAttempts, "engine-retry-attempts", 3, "How many times a run whose step failed is retried before it is dead lettered")
+	fs.DurationVar(&cfg.Engine.RetryBackoff, "engine-retry-backoff", 30*time.Second, "Wait before the first retry of a failed run, doubled for every retry after it")
+
+	fs.StringVar(&cfg.Tracing.Exporter, "tracing-exporter", TracingExporterNone, "Trace exporter (none|stdout|otlp)")
+	fs.StringVar(&cfg.Tracing.Endpoint, "tracing-endpoint", "", "OTLP/HTTP endpoint URL, e.g. http://localhost:4318 (defaults to the OTEL_EXPORTER_OTLP_* variables)")
+	fs.Float64Var(&cfg.Tracing.SampleRatio, "tracing-sample-ratio", 1, "Fraction of the traces that are recorded")
+	fs.StringVar(&cfg.Tracing.ServiceName, "tracing-service-name", "confluo", "Service name traces are reported under")
+
+	fs.Var(stringList{&cfg.Cors.TrustedOrigins}, "cors-trusted-origins", "Trusted CORS origins, like https://app.example.com or https://*.example.com (comma separated)")
+
+	fs.StringVar(&cfg.Providers.Github.ClientId, "providers-github-client-id", "", "Github OAuth app client id")
+	fs.StringVar(&cfg.Providers.Github.ClientSecret, "providers-github-client-secret", "", "Github OAuth app client secret")
+	fs.StringVar(&cfg.Providers.Github.Url, "providers-github-url", "https://github.com/login/oauth/access_token", "Github OAuth access token URL")
+	fs.StringVar(&cfg.Providers.Github.RedirectUrl, "providers-github-redirect-url", "", "Github OAuth redirect URL")
+	fs.StringVar(&cfg.Providers.Github.UserUrl, "providers-github-user-url", "https://api.github.com/user", "Github user API URL")
+
+	fs.Var(stringList{&cfg.Providers.Http.AllowedHosts}, "providers-http-allowed-hosts", "Hosts the HTTP provider may call (comma separated)")
+	fs.Var(stringList{&cfg.Providers.Http.DeniedHosts}, "providers-http-denied-hosts", "Hosts the HTTP provider may not call (comma separated)")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	// The file and the environment are applied over the defaults, so the
+	// flags that were passed are remembered and applied again last.
+	passed := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		passed[f.Name] = f.Value.String()
+	})
+
+	path := *configFile
+	if path == "" {
+		path = getenv(EnvPrefix + "CONFIG")
+	}
+
+	if path != "" {
+		err := loadConfigFile(path, &cfg)
+		if err != nil {
+			return cfg, nil, err
 		}
 	}
+
+	var errs []error
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+
+		name := envName(f.Name)
+
+		value := getenv(name)
+		if value == "" {
+			return
+		}
+
+		if err := fs.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for %s: %w", name, err))
+		}
+	})
+
+	if len(errs) > 0 {
+		return cfg, nil, errors.Join(errs...)
+	}
+
+	for name, value := range passed {
+		if err := fs.Set(name, value); err != nil {
+			return cfg, nil, fmt.Errorf("invalid value for -%s: %w", name, err)
+		}
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+func loadConfigFile(path string, cfg *Config) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(contents))
+		dec.KnownFields(true)
+
+		err = dec.Decode(cfg)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	case ".toml":
+		var md toml.MetaData
+
+		md, err = toml.Decode(string(contents), cfg)
+		if err == nil && len(md.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown key %s", md.Undecoded()[0])
+		}
+	default:
+		return fmt.Errorf("config file %s: must be .yaml, .yml or .toml", path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Validate reports every required value that is missing and every value
+// that is out of range, not just the first one.
+func (cfg Config) Validate() error {
+	var problems []string
+
+	check := func(ok bool, problem string) {
+		if !ok {
+			problems = append(problems, problem)
+		}
+	}
+
+	check(cfg.Port > 0 && cfg.Port <= 65535, "port must be between 1 and 65535")
+	check(cfg.ShutdownDelay >= 0, "shutdown delay must not be negative")
+	check(cfg.Env == "development" || cfg.Env == "staging" || cfg.Env == "production", "env must be development, staging or production")
+
+	check(cfg.DB.DSN != "", "db dsn must be provided (-db-dsn or CONFLUO_DB_DSN)")
+	check(cfg.DB.MaxOpenConns >= 0, "db max open conns must not be negative")
+	check(cfg.DB.MaxIdleConns >= 0, "db max idle conns must not be negative")
+
+	_, err := time.ParseDuration(cfg.DB.MaxIdleTime)
+	check(err == nil, "db max idle time must be a duration, e.g. 15m")
+
+	check(!cfg.Limiter.Enabled || cfg.Limiter.RPS > 0, "limiter rps must be greater than zero")
+	check(!cfg.Limiter.Enabled || cfg.Limiter.Burst > 0, "limiter burst must be greater than zero")
+	check(!cfg.Limiter.Enabled || cfg.Limiter.Webhooks.RPS > 0, "limiter webhooks rps must be greater than zero")
+	check(!cfg.Limiter.Enabled || cfg.Limiter.Webhooks.Burst > 0, "limiter webhooks burst must be greater than zero")
+
+	_, err = parseTrustedProxies(cfg.Limiter.TrustedProxies)
+	check(err == nil, fmt.Sprint(err))
+
+	check(cfg.Engine.Workers >= 0, "engine workers must not be negative")
+	check(cfg.Engine.PollInterval >= 0, "engine poll interval must not be negative")
+	check(cfg.Engine.DedupeRetention >= 0, "engine dedupe retention must not be negative")
+	check(cfg.Engine.RunLease >= 0, "engine run lease must not be negative")
+	check(cfg.Engine.RetryAttempts >= 0, "engine retry attempts must not be negative")
+	check(cfg.Engine.RetryBackoff >= 0, "engine retry backoff must not be negative")
+
+	check(cfg.Providers.Github.ClientId != "", "github client id must be provided (-providers-github-client-id or CONFLUO_PROVIDERS_GITHUB_CLIENT_ID)")
+	check(cfg.Providers.Github.ClientSecret != "", "github client secret must be provided (-providers-github-client-secret or CONFLUO_PROVIDERS_GITHUB_CLIENT_SECRET)")
+	check(validURL(cfg.Providers.Github.Url), "github url must be an absolute URL")
+	check(validURL(cfg.Providers.Github.UserUrl), "github user url must be an absolute URL")
+	check(cfg.Providers.Github.RedirectUrl == "" || validURL(cfg.Providers.Github.RedirectUrl), "github redirect url must be an absolute URL")
+
+	check(
+		cfg.Tracing.Exporter == TracingExporterNone || cfg.Tracing.Exporter == TracingExporterStdout || cfg.Tracing.Exporter == TracingExporterOTLP,
+		"tracing exporter must be none, stdout or otlp",
+	)
+	check(cfg.Tracing.Endpoint == "" || validURL(cfg.Tracing.Endpoint), "tracing endpoint must be an absolute URL")
+	check(cfg.Tracing.SampleRatio >= 0 && cfg.Tracing.SampleRatio <= 1, "tracing sample ratio must be between 0 and 1")
+
+	for _, origin := range cfg.Cors.TrustedOrigins {
+		_, err := parseTrustedOrigin(origin)
+		check(err == nil, fmt.Sprint(err))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	sort.Strings(problems)
+
+	return fmt.Errorf("invalid config:\n  %s", strings.Join(problems, "\n  "))
+}
+
+// Redacted returns a copy of the config that is safe to log: secrets are
+// replaced and the password in the DSN is masked.
+func (cfg Config) Redacted() Config {
+	c := cfg
+
+	if c.Providers.Github.ClientSecret != "" {
+		c.Providers.Github.ClientSecret = redacted
+	}
+
+	c.DB.DSN = redactDSN(c.DB.DSN)
+
+	return c
+}
+
+// LogValue makes slog log the redacted config, so the config can't leak
+// secrets into the logs by accident.
+func (cfg Config) LogValue() slog.Value {
+	c := cfg.Redacted()
+
+	return slog.GroupValue(
+		slog.Int("port", c.Port),
+		slog.String("env", c.Env),
+		slog.Duration("shutdown_delay", c.ShutdownDelay),
+		slog.String("db_dsn", c.DB.DSN),
+		slog.Int("db_max_open_conns", c.DB.MaxOpenConns),
+		slog.Int("db_max_idle_conns", c.DB.MaxIdleConns),
+		slog.String("db_max_idle_time", c.DB.MaxIdleTime),
+		slog.Bool("db_auto_migrate", c.DB.AutoMigrate),
+		slog.Bool("limiter_enabled", c.Limiter.Enabled),
+		slog.Float64("limiter_rps", c.Limiter.RPS),
+		slog.Int("limiter_burst", c.Limiter.Burst),
+		slog.Any("limiter_trusted_proxies", c.Limiter.TrustedProxies),
+		slog.Float64("limiter_webhooks_rps", c.Limiter.Webhooks.RPS),
+		slog.Int("limiter_webhooks_burst", c.Limiter.Webhooks.Burst),
+		slog.Int("engine_workers", c.Engine.Workers),
+		slog.Duration("engine_poll_interval", c.Engine.PollInterval),
+		slog.Duration("engine_dedupe_retention", c.Engine.DedupeRetention),
+		slog.Duration("engine_run_lease", c.Engine.RunLease),
+		slog.Int("engine_retry_attempts", c.Engine.RetryAttempts),
+		slog.Duration("engine_retry_backoff", c.Engine.RetryBackoff),
+		slog.String("tracing_exporter", c.Tracing.Exporter),
+		slog.String("tracing_endpoint", c.Tracing.Endpoint),
+		slog.Float64("tracing_sample_ratio", c.Tracing.SampleRatio),
+		slog.String("tracing_service_name", c.Tracing.ServiceName),
+		slog.Any("cors_trusted_origins", c.Cors.TrustedOrigins),
+		slog.String("github_client_id", c.Providers.Github.ClientId),
+		slog.String("github_client_secret", c.Providers.Github.ClientSecret),
+		slog.Any("http_allowed_hosts", c.Providers.Http.AllowedHosts),
+		slog.Any("http_denied_hosts", c.Providers.Http.DeniedHosts),
+	)
+}
+
+var dsnPasswordRX = regexp.MustCompile(`(?i)(password\s*=\s*)('[^']*'|\S+)`)
+
+// redactDSN masks the password of a postgres:// URL or of a key=value DSN.
+// Passwords in the query of a URL, sslpassword for example, are left as they
+// are.
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		return u.Redacted()
+	}
+
+	return dsnPasswordRX.ReplaceAllString(dsn, "${1}"+redacted)
+}
+
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// stringList is a comma separated flag.
+type stringList struct {
+	values *[]string
+}
+
+func (l stringList) String() string {
+	if l.values == nil {
+		return ""
+	}
+
+	return strings.Join(*l.values, ",")
+}
+
+func (l stringList) Set(s string) error {
+	*l.values = []string{}
+
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l.values = append(*l.values, v)
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	corsAllowedMethods = "GET, POST, PATCH, DELETE, OPTIONS"
+	corsAllowedHeaders = "Authorization, Content-Type, X-Request-ID, traceparent"
+	corsExposedHeaders = "RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After, X-Request-ID"
+	corsMaxAge         = "600"
+)
+
+// trustedOrigin is an origin from Config.Cors.TrustedOrigins. An origin like
+// https://*.example.com trusts every subdomain of example.com, but not
+// example.com itself.
+type trustedOrigin struct {
+	scheme   string
+	host     string
+	wildcard bool
+}
+
+// parseTrustedOrigin parses an origin: a scheme and a host with an optional
+// port, nothing else. The wildcard can only be the whole leftmost label.
+func parseTrustedOrigin(s string) (trustedOrigin, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return trustedOrigin{}, fmt.Errorf("cors trusted origin %q must be an absolute URL", s)
+	}
+
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return trustedOrigin{}, fmt.Errorf("cors trusted origin %q must only have a scheme and a host", s)
+	}
+
+	origin := trustedOrigin{scheme: strings.ToLower(u.Scheme), host: strings.ToLower(u.Host)}
+
+	if rest, ok := strings.CutPrefix(origin.host, "*."); ok {
+		origin.host = rest
+		origin.wildcard = true
+	}
+
+	if strings.Contains(origin.host, "*") {
+		return trustedOrigin{}, fmt.Errorf("cors trusted origin %q can only have a wildcard as its first label, like https://*.example.com", s)
+	}
+
+	return origin, nil
+}
+
+// parseTrustedOrigins parses the trusted origins of the config once, when
+// the application starts.
+func parseTrustedOrigins(origins []string) ([]trustedOrigin, error) {
+	trusted := make([]trustedOrigin, 0, len(origins))
+
+	for _, s := range origins {
+		origin, err := parseTrustedOrigin(s)
+		if err != nil {
+			return nil, err
+		}
+
+		trusted = append(trusted, origin)
+	}
+
+	return trusted, nil
+}
+
+func (o trustedOrigin) matches(scheme, host string) bool {
+	if scheme != o.scheme {
+		return false
+	}
+
+	if !o.wildcard {
+		return host == o.host
+	}
+
+	subdomain, ok := strings.CutSuffix(host, "."+o.host)
+
+	return ok && subdomain != ""
+}
+
+// corsOriginAllowed reports whether the Origin header of a request is one of
+// the trusted origins.
+func (app *Application) corsOriginAllowed(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+		app.logger.Debug("cors: malformed origin", "origin", origin, "method", r.Method, "uri", r.URL.RequestURI())
+		return false
+	}
+
+	scheme, host := strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+
+	for _, trusted := range app.trustedOrigins {
+		if trusted.matches(scheme, host) {
+			return true
+		}
+	}
+
+	app.logger.Debug("cors: origin not trusted", "origin", origin, "method", r.Method, "uri", r.URL.RequestURI())
+
+	return false
+}
+
+// enableCORS lets the trusted origins call the API with credentials. A
+// preflight request from a trusted origin is answered here; any other
+// request gets no CORS headers and the browser blocks it.
+func (app *Application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+
+		if origin == "" || !app.corsOriginAllowed(r, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestParseTrustedOrigins(t *testing.T) {
+	testMap := []struct {
+		name        string
+		origins     []string
+		shouldError bool
+	}{
+		{name: "Origins", origins: []string{"https://app.example.com", "http://localhost:3000", "https://*.example.com"}},
+		{name: "Trailing Slash", origins: []string{"https://app.example.com/"}},
+		{name: "Empty", origins: nil},
+		{name: "Missing Scheme Should Error", origins: []string{"app.example.com"}, shouldError: true},
+		{name: "Path Should Error", origins: []string{"https://app.example.com/login"}, shouldError: true},
+		{name: "User Should Error", origins: []string{"https://user@app.example.com"}, shouldError: true},
+		{name: "Inner Wildcard Should Error", origins: []string{"https://app.*.example.com"}, shouldError: true},
+		{name: "Partial Wildcard Should Error", origins: []string{"https://app-*.example.com"}, shouldError: true},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			origins, err := parseTrustedOrigins(tt.origins)
+
+			if tt.shouldError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, len(origins), len(tt.origins))
+		})
+	}
+}
+
+func TestEnableCORS(t *testing.T) {
+	app := newTestApplication(t)
+
+	trustedOrigins, err := parseTrustedOrigins([]string{"https://app.example.com", "https://*.example.org"})
+	assert.NilError(t, err)
+	app.trustedOrigins = trustedOrigins
+
+	handler := app.enableCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	testMap := []struct {
+		name          string
+		method        string
+		origin        string
+		preflight     bool
+		status        int
+		allowedOrigin string
+	}{
+		{
+			name:          "Trusted Origin",
+			method:        http.MethodGet,
+			origin:        "https://app.example.com",
+			status:        http.StatusOK,
+			allowedOrigin: "https://app.example.com",
+		},
+		{
+			name:          "Origin Is Case Insensitive",
+			method:        http.MethodGet,
+			origin:        "HTTPS://App.Example.com",
+			status:        http.StatusOK,
+			allowedOrigin: "HTTPS://App.Example.com",
+		},
+		{
+			name:          "Wildcard Subdomain",
+			method:        http.MethodGet,
+			origin:        "https://app.example.org",
+			status:        http.StatusOK,
+			allowedOrigin: "https://app.example.org",
+		},
+		{
+			name:   "Wildcard Doesn't Match The Apex",
+			method: http.MethodGet,
+			origin: "https://example.org",
+			status: http.StatusOK,
+		},
+		{
+			name:   "Other Scheme",
+			method: http.MethodGet,
+			origin: "http://app.example.com",
+			status: http.StatusOK,
+		},
+		{
+			name:   "Untrusted Origin",
+			method: http.MethodGet,
+			origin: "https://evil.example.net",
+			status: http.StatusOK,
+		},
+		{
+			name:   "Lookalike Origin",
+			method: http.MethodGet,
+			origin: "https://app.example.com.evil.net",
+			status: http.StatusOK,
+		},
+		{
+			name:   "No Origin",
+			method: http.MethodGet,
+			status: http.StatusOK,
+		},
+		{
+			name:          "Preflight",
+			method:        http.MethodOptions,
+			origin:        "https://app.example.com",
+			preflight:     true,
+			status:        http.StatusNoContent,
+			allowedOrigin: "https://app.example.com",
+		},
+		{
+			name:      "Preflight From Untrusted Origin",
+			method:    http.MethodOptions,
+			origin:    "https://evil.example.net",
+			preflight: true,
+			status:    http.StatusOK,
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/workflows", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			assert.Equal(t, rec.Code, tt.status)
+			assert.Equal(t, rec.Header().Get("Access-Control-Allow-Origin"), tt.allowedOrigin)
+			assert.StringContains(t, rec.Header().Values("Vary")[0], "Origin")
+
+			switch {
+			case tt.allowedOrigin == "":
+				assert.Equal(t, rec.Header().Get("Access-Control-Allow-Credentials"), "")
+			case tt.preflight:
+				assert.Equal(t, rec.Header().Get("Access-Control-Allow-Headers"), corsAllowedHeaders)
+				assert.StringContains(t, corsAllowedHeaders, "X-Request-ID")
+				assert.StringContains(t, corsAllowedHeaders, "traceparent")
+			default:
+				assert.Equal(t, rec.Header().Get("Access-Control-Allow-Credentials"), "true")
+				assert.Equal(t, rec.Header().Get("Access-Control-Expose-Headers"), corsExposedHeaders)
+				assert.StringContains(t, corsExposedHeaders, "X-Request-ID")
+			}
+		})
+	}
+}
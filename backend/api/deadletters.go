@@ -0,0 +1,193 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/validator"
+)
+
+func (app *Application) listDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	workflowId := app.readString(qs, "workflow_id", "")
+	v.Check(workflowId == "" || validator.Matches(workflowId, validator.UUIDRX), "workflow_id", "must be a valid id")
+
+	provider := app.readString(qs, "provider", "")
+
+	status := app.readString(qs, "status", data.DeadLetterStatusPending)
+	v.Check(
+		validator.PermittedValue(status, "all", data.DeadLetterStatusPending, data.DeadLetterStatusRequeued, data.DeadLetterStatusDiscarded),
+		"status",
+		"invalid status value",
+	)
+
+	if status == "all" {
+		status = ""
+	}
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         "-updated_at",
+		SortSafeList: []string{"-updated_at"},
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	deadLetters, metadata, err := app.models.DeadLetters.GetAllForUser(user.Id, workflowId, provider, status, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"deadLetters": deadLetters, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showDeadLetterHandler returns the dead letter together with the history
+// of the run, every attempt included.
+func (app *Application) showDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	deadLetter, ok := app.getPermittedDeadLetter(w, r, data.PermissionView)
+	if !ok {
+		return
+	}
+
+	steps, err := app.models.RunSteps.GetAllForRun(deadLetter.RunId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"deadLetter": deadLetter, "steps": steps}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// requeueDeadLetterHandler queues the failed run again. It continues from
+// the step it failed on with the params it had, and gets its retries back.
+func (app *Application) requeueDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	deadLetter, ok := app.getPermittedDeadLetter(w, r, data.PermissionRun)
+	if !ok {
+		return
+	}
+
+	if deadLetter.Status != data.DeadLetterStatusPending {
+		app.errorResponse(w, r, http.StatusConflict, "the dead letter is not pending")
+		return
+	}
+
+	err := app.models.DeadLetters.Requeue(deadLetter)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRunNotFailed):
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"deadLetter": deadLetter}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// discardDeadLetterHandler drops the dead letter from the queue. The run
+// itself stays failed.
+func (app *Application) discardDeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	deadLetter, ok := app.getPermittedDeadLetter(w, r, data.PermissionRun)
+	if !ok {
+		return
+	}
+
+	app.setDeadLetterStatus(w, r, deadLetter, data.DeadLetterStatusDiscarded)
+}
+
+// deadLetterDepthHandler counts the pending dead letters of the user per
+// workflow and per provider.
+func (app *Application) deadLetterDepthHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	depth, err := app.models.DeadLetters.Depth(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"depth": depth}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) setDeadLetterStatus(w http.ResponseWriter, r *http.Request, deadLetter *data.DeadLetter, status string) {
+	err := app.models.DeadLetters.SetStatus(deadLetter, status)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"deadLetter": deadLetter}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getPermittedDeadLetter loads the dead letter in the id URL param and
+// checks that the current user has the permission in the workspace of its
+// workflow. It writes a not found response when the dead letter doesn't
+// exist or the user isn't a member of the workspace.
+func (app *Application) getPermittedDeadLetter(w http.ResponseWriter, r *http.Request, permission string) (*data.DeadLetter, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	workspaceId, err := app.models.DeadLetters.GetWorkspaceId(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if _, ok := app.requirePermission(w, r, workspaceId, permission); !ok {
+		return nil, false
+	}
+
+	deadLetter, err := app.models.DeadLetters.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return deadLetter, true
+}
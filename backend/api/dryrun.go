@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/validator"
+)
+
+type dryRunInput struct {
+	Params map[string]interface{}            `json:"params"`
+	Mocks  map[string]map[string]interface{} `json:"mocks"`
+}
+
+// dryRunWorkflowHandler executes the whole workflow with sample trigger
+// params and returns every step it went through. Nothing is stored as a
+// run; steps with side effects can be mocked by step id.
+func (app *Application) dryRunWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	workflow, ok := app.getPermittedWorkflow(w, r, id, data.PermissionRun)
+	if !ok {
+		return
+	}
+
+	input, ok := app.readDryRunInput(w, r, workflow)
+	if !ok {
+		return
+	}
+
+	result := app.engine.DryRun(r.Context(), workflow, input.Params, input.Mocks)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"result": result}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// testWorkflowActionHandler executes a single step with sample params, the
+// same way a dry run does.
+func (app *Application) testWorkflowActionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	workflowAction, err := app.models.WorkflowActions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	workflow, ok := app.getPermittedWorkflow(w, r, workflowAction.WorkflowId, data.PermissionRun)
+	if !ok {
+		return
+	}
+
+	input, ok := app.readDryRunInput(w, r, workflow)
+	if !ok {
+		return
+	}
+
+	var step *data.WorkflowAction
+	for i := range workflow.Actions {
+		if workflow.Actions[i].Id == workflowAction.Id {
+			step = &workflow.Actions[i]
+		}
+	}
+
+	if step == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	result := app.engine.TestStep(r.Context(), workflow, step, input.Params, input.Mocks)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"result": result}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) readDryRunInput(w http.ResponseWriter, r *http.Request, workflow *data.Workflow) (*dryRunInput, bool) {
+	var input dryRunInput
+
+	if r.ContentLength != 0 {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return nil, false
+		}
+	}
+
+	v := validator.New()
+
+	for stepId := range input.Mocks {
+		v.Check(isWorkflowStep(workflow, stepId, ""), "mocks", "must be keyed by steps of the workflow")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+
+	return &input, true
+}
@@ -8,6 +8,7 @@ import (
 func (app *Application) logError(r *http.Request, err error) {
 	app.logger.Error(
 		err.Error(),
+		"request_id", app.contextGetRequestID(r),
 		"request_method", r.Method,
 		"request_url", r.URL.String(),
 	)
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// healthzHandler tells that the process is up and serving requests.
+func (app *Application) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"status": "available"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readyzHandler tells whether the server should get traffic: the database
+// answers, its schema is at the latest migration, the scheduler and all the
+// workers are running and the server isn't shutting down. Every check is
+// reported, with the reason for the ones that fail.
+func (app *Application) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	checks := make(map[string]string)
+	ready := true
+
+	check := func(name string, problem string) {
+		if problem == "" {
+			checks[name] = "ok"
+			return
+		}
+
+		checks[name] = problem
+		ready = false
+	}
+
+	if app.shuttingDown.Load() {
+		check("server", "shutting down")
+	} else {
+		check("server", "")
+	}
+
+	check("database", app.checkDatabase())
+
+	health := app.engine.Health()
+
+	switch {
+	case !health.SchedulerRunning:
+		check("scheduler", "not running")
+	case health.SchedulerStalled:
+		check("scheduler", fmt.Sprintf("stalled since %s", health.LastSchedulerTick.Format(time.RFC3339)))
+	default:
+		check("scheduler", "")
+	}
+
+	if health.Workers < health.ExpectedWorkers {
+		check("workers", fmt.Sprintf("%d of %d running", health.Workers, health.ExpectedWorkers))
+	} else {
+		check("workers", "")
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not ready", http.StatusServiceUnavailable
+	}
+
+	err := app.writeJSON(w, code, envelope{"status": status, "checks": checks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkDatabase pings the database and compares its schema version with the
+// latest migration. It returns the problem, or "" when there is none.
+func (app *Application) checkDatabase() string {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := app.db.PingContext(ctx)
+	if err != nil {
+		return err.Error()
+	}
+
+	version, err := app.migrator.Version()
+	if err != nil {
+		return err.Error()
+	}
+
+	if version != app.migrator.Latest() {
+		return fmt.Sprintf("schema at migration %d, latest is %d", version, app.migrator.Latest())
+	}
+
+	return ""
+}
+
+type buildInfo struct {
+	Path      string `json:"path"`
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified"`
+}
+
+// versionHandler returns the build info the Go toolchain embedded in the
+// binary and the providers the executor has.
+func (app *Application) versionHandler(w http.ResponseWriter, r *http.Request) {
+	var build buildInfo
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		build.Path = info.Main.Path
+		build.Version = info.Main.Version
+		build.GoVersion = info.GoVersion
+
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				build.Revision = setting.Value
+			case "vcs.time":
+				build.Time = setting.Value
+			case "vcs.modified":
+				build.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"build": build, "providers": app.executor.Providers()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/engine"
+	"github.com/luisya22/confluo/backend/internal/executor"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestReadyzHandler(t *testing.T) {
+	testMap := []struct {
+		name         string
+		shuttingDown bool
+		server       string
+	}{
+		{name: "Serving", server: "ok"},
+		{name: "Shutting Down", shuttingDown: true, server: "shutting down"},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			// Nothing listens on the database address, so the ping fails
+			// right away and the engine isn't running.
+			db, err := sqlx.Open("postgres", "postgres://confluo@127.0.0.1:1/confluo?sslmode=disable&connect_timeout=1")
+			assert.NilError(t, err)
+			t.Cleanup(func() { db.Close() })
+
+			app.db = db
+			app.engine = engine.New(data.Models{}, executor.NewExecutor(), app.logger, engine.Config{})
+			app.shuttingDown.Store(tt.shuttingDown)
+
+			rr := httptest.NewRecorder()
+			app.readyzHandler(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			assert.Equal(t, rr.Code, http.StatusServiceUnavailable)
+
+			var body struct {
+				Status string            `json:"status"`
+				Checks map[string]string `json:"checks"`
+			}
+
+			assert.NilError(t, json.NewDecoder(rr.Body).Decode(&body))
+			assert.Equal(t, body.Status, "not ready")
+			assert.Equal(t, body.Checks["server"], tt.server)
+			assert.Equal(t, body.Checks["scheduler"], "not running")
+		})
+	}
+}
@@ -10,18 +10,21 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/julienschmidt/httprouter"
+	"github.com/go-chi/chi/v5"
 	"github.com/luisya22/confluo/backend/internal/validator"
 )
 
 type envelope map[string]any
 
-func (app *Application) readIDParam(r *http.Request) (int64, error) {
-	params := httprouter.ParamsFromContext(r.Context())
+func (app *Application) readIDParam(r *http.Request) (string, error) {
+	return app.readUUIDParam(r, "id")
+}
+
+func (app *Application) readUUIDParam(r *http.Request, key string) (string, error) {
+	id := chi.URLParam(r, key)
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
-	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+	if !validator.Matches(id, validator.UUIDRX) {
+		return "", fmt.Errorf("invalid %s parameter", key)
 	}
 
 	return id, nil
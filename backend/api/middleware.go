@@ -0,0 +1,223 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/metrics"
+	"github.com/luisya22/confluo/backend/internal/validator"
+)
+
+// requestIDRX is what an X-Request-ID sent by a client or a proxy has to look
+// like to be kept; anything else is replaced so it can't mess up the logs.
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestID gives every request an id, the X-Request-ID it came with when
+// there is a valid one, and sends it back in the response.
+func (app *Application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+
+		if !requestIDRX.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		next.ServeHTTP(w, app.contextSetRequestID(r, id))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+
+	// crypto/rand doesn't fail on the platforms we run on.
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// accessLogEntry collects what the access log needs to know from the
+// handlers further down the chain. The user is only known after
+// authenticate, which sets it through contextSetUser.
+type accessLogEntry struct {
+	userId string
+}
+
+// responseRecorder keeps the status and the size of the response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+
+	return n, err
+}
+
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// logRequest logs every request once it has been served.
+func (app *Application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		entry := &accessLogEntry{}
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		r = r.WithContext(context.WithValue(r.Context(), accessLogContextKey, entry))
+
+		next.ServeHTTP(rec, r)
+
+		app.logger.Info(
+			"request",
+			"request_id", app.contextGetRequestID(r),
+			"method", r.Method,
+			"uri", r.URL.RequestURI(),
+			"remote_addr", r.RemoteAddr,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"latency_ms", float64(time.Since(start).Microseconds())/1000,
+			"user_id", entry.userId,
+		)
+	})
+}
+
+// recordMetrics records the duration of every request by route pattern, so a
+// path with an id in it doesn't make a series of its own.
+func (app *Application) recordMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		metrics.ObserveHTTPRequest(r.Method, route, rec.status, time.Since(start))
+	})
+}
+
+// recoverPanic turns a panic in a handler into a 500 response instead of a
+// dropped connection.
+func (app *Application) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				// http.ErrAbortHandler is how a handler aborts on purpose.
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				w.Header().Set("Connection", "close")
+				app.serverErrorResponse(w, r, fmt.Errorf("panic: %v", err))
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (app *Application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		if r.Header.Get("Authorization") == "" {
+			r = app.contextSetUser(r, data.AnonymousUser)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !app.checkAuthenticationGuesses(w, r) {
+			return
+		}
+
+		token, ok := bearerToken(r)
+		if !ok {
+			app.countAuthenticationFailure(r)
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		v := validator.New()
+
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.countAuthenticationFailure(r)
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.countAuthenticationFailure(r)
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		r = app.contextSetUser(r, user)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bearerToken returns the token of an "Authorization: Bearer <token>"
+// header. The scheme is case-insensitive and any run of spaces may separate
+// it from the token.
+func bearerToken(r *http.Request) (string, bool) {
+	headerParts := strings.Fields(r.Header.Get("Authorization"))
+	if len(headerParts) != 2 || !strings.EqualFold(headerParts[0], "Bearer") {
+		return "", false
+	}
+
+	return headerParts[1], true
+}
+
+func (app *Application) requireAuthenticatedUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+// logLines decodes the JSON log lines written to buf.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var lines []map[string]interface{}
+
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var line map[string]interface{}
+		assert.NilError(t, dec.Decode(&line))
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+func TestBearerToken(t *testing.T) {
+	testMap := []struct {
+		name   string
+		header string
+		token  string
+		ok     bool
+	}{
+		{name: "Bearer Token", header: "Bearer abc", token: "abc", ok: true},
+		{name: "Lower Case Scheme", header: "bearer abc", token: "abc", ok: true},
+		{name: "Extra Spaces", header: "  Bearer   abc ", token: "abc", ok: true},
+		{name: "Other Scheme", header: "Basic abc", ok: false},
+		{name: "Missing Token", header: "Bearer", ok: false},
+		{name: "Too Many Parts", header: "Bearer abc def", ok: false},
+		{name: "Empty", header: "", ok: false},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Authorization", tt.header)
+
+			token, ok := bearerToken(r)
+
+			assert.Equal(t, ok, tt.ok)
+			assert.Equal(t, token, tt.token)
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	testMap := []struct {
+		name      string
+		header    string
+		kept      bool
+		generated bool
+	}{
+		{name: "Valid Id Is Kept", header: "req-1.a:b_C", kept: true},
+		{name: "Missing Id Is Generated", generated: true},
+		{name: "Id With Spaces Is Replaced", header: "req 1", generated: true},
+		{name: "Too Long Id Is Replaced", header: strings.Repeat("a", 129), generated: true},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			var got string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = app.contextGetRequestID(r)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Request-ID", tt.header)
+			}
+
+			rr := httptest.NewRecorder()
+			app.requestID(next).ServeHTTP(rr, r)
+
+			assert.Equal(t, rr.Header().Get("X-Request-ID"), got)
+
+			if tt.kept {
+				assert.Equal(t, got, tt.header)
+			}
+
+			if tt.generated {
+				assert.Equal(t, len(got), 32)
+				assert.NotEqual(t, got, tt.header)
+			}
+		})
+	}
+}
+
+func TestRecoverPanic(t *testing.T) {
+	app := newTestApplication(t)
+
+	var buf bytes.Buffer
+	app.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Request-ID", "req-1")
+
+	rr := httptest.NewRecorder()
+	app.requestID(app.recoverPanic(next)).ServeHTTP(rr, r)
+
+	assert.Equal(t, rr.Code, http.StatusInternalServerError)
+	assert.Equal(t, strings.EqualFold(rr.Header().Get("Content-Type"), "application/json"), true)
+	assert.Equal(t, rr.Header().Get("Connection"), "close")
+	assert.Equal(t, rr.Header().Get("X-Request-ID"), "req-1")
+
+	var body struct {
+		Error string `json:"error"`
+	}
+
+	assert.NilError(t, json.NewDecoder(rr.Body).Decode(&body))
+	assert.StringContains(t, body.Error, "the server encountered a problem")
+
+	// The error is logged with the id the client got back.
+	lines := logLines(t, &buf)
+	assert.Equal(t, len(lines), 1)
+	assert.Equal(t, lines[0]["msg"], interface{}("panic: boom"))
+	assert.Equal(t, lines[0]["request_id"], interface{}("req-1"))
+}
+
+func TestRecoverPanicAbortHandler(t *testing.T) {
+	app := newTestApplication(t)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+		assert.Equal(t, recover(), interface{}(http.ErrAbortHandler))
+	}()
+
+	app.recoverPanic(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	t.Fatal("http.ErrAbortHandler should be panicked again")
+}
+
+func TestLogRequest(t *testing.T) {
+	testMap := []struct {
+		name    string
+		handler func(app *Application, w http.ResponseWriter, r *http.Request)
+		status  float64
+		bytes   float64
+		userId  string
+	}{
+		{
+			name: "Written Body Is Counted",
+			handler: func(app *Application, w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("hello"))
+			},
+			status: http.StatusOK,
+			bytes:  5,
+		},
+		{
+			name: "First Status Is Kept",
+			handler: func(app *Application, w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name: "User Set Further Down Is Logged",
+			handler: func(app *Application, w http.ResponseWriter, r *http.Request) {
+				app.contextSetUser(r, &data.User{Id: "user-1"})
+				w.WriteHeader(http.StatusNoContent)
+			},
+			status: http.StatusNoContent,
+			userId: "user-1",
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			var buf bytes.Buffer
+			app.logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/runs?page=2", nil)
+			r.Header.Set("X-Request-ID", "req-1")
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.handler(app, w, r)
+			})
+
+			app.requestID(app.logRequest(next)).ServeHTTP(httptest.NewRecorder(), r)
+
+			lines := logLines(t, &buf)
+			assert.Equal(t, len(lines), 1)
+
+			line := lines[0]
+			assert.Equal(t, line["msg"], interface{}("request"))
+			assert.Equal(t, line["request_id"], interface{}("req-1"))
+			assert.Equal(t, line["method"], interface{}(http.MethodPost))
+			assert.Equal(t, line["uri"], interface{}("/v1/runs?page=2"))
+			assert.Equal(t, line["status"], interface{}(tt.status))
+			assert.Equal(t, line["bytes"], interface{}(tt.bytes))
+			assert.Equal(t, line["user_id"], interface{}(tt.userId))
+
+			_, ok := line["latency_ms"].(float64)
+			assert.Equal(t, ok, true)
+		})
+	}
+}
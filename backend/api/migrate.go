@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/luisya22/confluo/backend/internal/migrations"
+)
+
+const migrateUsage = `usage: confluo [flags] migrate <command>
+
+commands:
+  up             apply every pending migration
+  down [n]       revert the last n migrations (default 1)
+  to <version>   migrate up or down to version; 0 reverts everything
+  status         list the migrations and whether they are applied`
+
+// Migrate runs the migrate subcommand against the configured database.
+func Migrate(cfg Config, args []string, output io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	if cfg.DB.DSN == "" {
+		return errors.New("db dsn must be provided (-db-dsn or CONFLUO_DB_DSN)")
+	}
+
+	db, err := openDb(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	var done []migrations.Migration
+
+	switch args[0] {
+	case "up":
+		done, err = migrator.Up()
+	case "down":
+		steps := 1
+
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("down: n must be a positive number")
+			}
+		}
+
+		done, err = migrator.Down(steps)
+	case "to":
+		if len(args) < 2 {
+			return errors.New(migrateUsage)
+		}
+
+		version, parseErr := strconv.ParseInt(args[1], 10, 64)
+		if parseErr != nil || version < 0 {
+			return fmt.Errorf("to: version must be a number")
+		}
+
+		done, err = migrator.To(version)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied"
+			}
+
+			fmt.Fprintf(output, "%06d_%s\t%s\n", s.Version, s.Name, state)
+		}
+
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	for _, m := range done {
+		fmt.Fprintf(output, "migrated %06d_%s\n", m.Version, m.Name)
+	}
+
+	if err == nil && len(done) == 0 {
+		fmt.Fprintln(output, "no change")
+	}
+
+	return err
+}
@@ -0,0 +1,331 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webhookIngestionPrefix is where the endpoints that receive webhooks from
+// other services are mounted. They are called by machines, often in bursts,
+// so they are limited per client IP with limits of their own.
+const webhookIngestionPrefix = "/hooks/"
+
+// unlimitedPaths are polled by probes and scrapers, often from a single
+// address, so they aren't rate limited.
+var unlimitedPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// bucketIdleTTL is how long a bucket is kept after its last request.
+const bucketIdleTTL = 3 * time.Minute
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// rateLimiter keeps a token bucket per client. A bucket holds up to burst
+// tokens and refills at rps tokens per second; every request takes one.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rps       float64
+	burst     int
+	idleTTL   time.Duration
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type rateLimitResult struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	// An evicted bucket comes back full, so a bucket is only evicted once it
+	// would have refilled anyway.
+	idleTTL := bucketIdleTTL
+	if full := time.Duration(float64(burst) / rps * float64(time.Second)); full > idleTTL {
+		idleTTL = full
+	}
+
+	return &rateLimiter{
+		rps:     rps,
+		burst:   burst,
+		idleTTL: idleTTL,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// take takes a token from the bucket of key. The result says how many
+// tokens are left, how long until the bucket is full again and, when there
+// was no token to take, how long until there is one.
+func (l *rateLimiter) take(key string, now time.Time) rateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key, now)
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	return l.result(b, allowed)
+}
+
+// peek is take without taking the token.
+func (l *rateLimiter) peek(key string, now time.Time) rateLimitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key, now)
+
+	return l.result(b, b.tokens >= 1)
+}
+
+// bucket returns the bucket of key refilled up to now. l.mu must be held.
+func (l *rateLimiter) bucket(key string, now time.Time) *tokenBucket {
+	if now.Sub(l.lastSweep) > l.idleTTL {
+		l.evict(now)
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.burst)}
+		l.buckets[key] = b
+	} else {
+		b.tokens = math.Min(float64(l.burst), b.tokens+now.Sub(b.lastSeen).Seconds()*l.rps)
+	}
+
+	b.lastSeen = now
+
+	return b
+}
+
+func (l *rateLimiter) result(b *tokenBucket, allowed bool) rateLimitResult {
+	result := rateLimitResult{
+		allowed:   allowed,
+		remaining: int(b.tokens),
+		reset:     l.refillTime(float64(l.burst) - b.tokens),
+	}
+
+	if !allowed {
+		result.retryAfter = l.refillTime(1 - b.tokens)
+	}
+
+	return result
+}
+
+// evict drops the buckets that haven't been used for idleTTL.
+func (l *rateLimiter) evict(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > l.idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *rateLimiter) refillTime(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rps * float64(time.Second))
+}
+
+// rateLimiters holds the limiters of the API: anonymous clients and failed
+// authentications are limited per IP, authenticated users per user and
+// webhook ingestion per IP.
+type rateLimiters struct {
+	clients        *rateLimiter
+	users          *rateLimiter
+	webhooks       *rateLimiter
+	trustedProxies []*net.IPNet
+}
+
+func newRateLimiters(cfg Config) (*rateLimiters, error) {
+	trustedProxies, err := parseTrustedProxies(cfg.Limiter.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rateLimiters{
+		clients:        newRateLimiter(cfg.Limiter.RPS, cfg.Limiter.Burst),
+		users:          newRateLimiter(cfg.Limiter.RPS, cfg.Limiter.Burst),
+		webhooks:       newRateLimiter(cfg.Limiter.Webhooks.RPS, cfg.Limiter.Webhooks.Burst),
+		trustedProxies: trustedProxies,
+	}, nil
+}
+
+// parseTrustedProxies parses a list of CIDRs. A bare IP is a network of
+// its own.
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("trusted proxy %q must be an IP or a CIDR", proxy)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q must be an IP or a CIDR", proxy)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func (l *rateLimiters) trusted(ip net.IP) bool {
+	for _, network := range l.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the IP of the client that made the request.
+// X-Forwarded-For and X-Real-IP are only believed when the request comes
+// from a trusted proxy. The client is then the last address in
+// X-Forwarded-For that isn't a trusted proxy, since anything before it could
+// have been sent by the client itself.
+func (l *rateLimiters) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !l.trusted(ip) {
+		return host
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+
+	if len(forwarded) > 0 {
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+			if hop == nil {
+				break
+			}
+
+			ip = hop
+
+			if !l.trusted(hop) {
+				break
+			}
+		}
+
+		return ip.String()
+	}
+
+	if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+		return realIP.String()
+	}
+
+	return ip.String()
+}
+
+// rateLimit limits authenticated users per user and everyone else per
+// client IP, so users behind the same NAT don't share a bucket. It has to run
+// after authenticate. Webhook ingestion is always limited per IP.
+func (app *Application) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.Limiter.Enabled || unlimitedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user := app.contextGetUser(r)
+
+		limiter, key := app.limiters.clients, ""
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, webhookIngestionPrefix):
+			limiter, key = app.limiters.webhooks, app.limiters.clientIP(r)
+		case !user.IsAnonymous():
+			limiter, key = app.limiters.users, user.Id
+		default:
+			key = app.limiters.clientIP(r)
+		}
+
+		result := limiter.take(key, time.Now())
+
+		if !app.writeRateLimit(w, r, limiter, result) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkAuthenticationGuesses stops a client from guessing tokens. Every
+// rejected token takes a token from the bucket of the client IP through
+// countAuthenticationFailure, and once the bucket is empty the client gets
+// 429 before its token is looked up. It reports whether the request may go
+// on.
+func (app *Application) checkAuthenticationGuesses(w http.ResponseWriter, r *http.Request) bool {
+	if !app.config.Limiter.Enabled {
+		return true
+	}
+
+	result := app.limiters.clients.peek(app.limiters.clientIP(r), time.Now())
+	if result.allowed {
+		return true
+	}
+
+	return app.writeRateLimit(w, r, app.limiters.clients, result)
+}
+
+func (app *Application) countAuthenticationFailure(r *http.Request) {
+	if !app.config.Limiter.Enabled {
+		return
+	}
+
+	app.limiters.clients.take(app.limiters.clientIP(r), time.Now())
+}
+
+// writeRateLimit sets the RateLimit headers and, when the request isn't
+// allowed, responds 429. It reports whether the request was allowed.
+func (app *Application) writeRateLimit(w http.ResponseWriter, r *http.Request, limiter *rateLimiter, result rateLimitResult) bool {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(limiter.burst))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.reset)))
+
+	if !result.allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.retryAfter)))
+		app.rateLimitExceededResponse(w, r)
+	}
+
+	return result.allowed
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
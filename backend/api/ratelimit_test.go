@@ -0,0 +1,356 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestRateLimiterTake(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testMap := []struct {
+		name       string
+		rps        float64
+		burst      int
+		takes      []time.Duration
+		allowed    bool
+		remaining  int
+		reset      time.Duration
+		retryAfter time.Duration
+	}{
+		{
+			name:      "First Request",
+			rps:       1,
+			burst:     3,
+			takes:     []time.Duration{0},
+			allowed:   true,
+			remaining: 2,
+			reset:     time.Second,
+		},
+		{
+			name:       "Burst Used Up",
+			rps:        1,
+			burst:      2,
+			takes:      []time.Duration{0, 0, 0},
+			allowed:    false,
+			remaining:  0,
+			reset:      2 * time.Second,
+			retryAfter: time.Second,
+		},
+		{
+			name:      "Refills Over Time",
+			rps:       2,
+			burst:     2,
+			takes:     []time.Duration{0, 0, 500 * time.Millisecond},
+			allowed:   true,
+			remaining: 0,
+			reset:     time.Second,
+		},
+		{
+			name:      "Refill Is Capped At Burst",
+			rps:       10,
+			burst:     2,
+			takes:     []time.Duration{0, time.Hour},
+			allowed:   true,
+			remaining: 1,
+			reset:     100 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newRateLimiter(tt.rps, tt.burst)
+
+			var result rateLimitResult
+			for _, at := range tt.takes {
+				result = limiter.take("client", start.Add(at))
+			}
+
+			assert.Equal(t, result.allowed, tt.allowed)
+			assert.Equal(t, result.remaining, tt.remaining)
+			assert.Equal(t, result.reset, tt.reset)
+			assert.Equal(t, result.retryAfter, tt.retryAfter)
+		})
+	}
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(1, 1)
+
+	assert.Equal(t, limiter.take("a", now).allowed, true)
+	assert.Equal(t, limiter.take("a", now).allowed, false)
+	assert.Equal(t, limiter.take("b", now).allowed, true)
+}
+
+func TestRateLimiterPeek(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(1, 1)
+
+	assert.Equal(t, limiter.peek("a", now).allowed, true)
+	assert.Equal(t, limiter.peek("a", now).allowed, true)
+	assert.Equal(t, limiter.take("a", now).allowed, true)
+	assert.Equal(t, limiter.peek("a", now).allowed, false)
+}
+
+func TestRateLimiterEviction(t *testing.T) {
+	start := time.Now()
+	limiter := newRateLimiter(1, 2)
+
+	limiter.take("idle", start)
+	limiter.take("active", start)
+
+	limiter.take("active", start.Add(limiter.idleTTL))
+	assert.Equal(t, len(limiter.buckets), 2)
+
+	// The sweep only drops buckets idle for longer than idleTTL.
+	limiter.take("active", start.Add(limiter.idleTTL+time.Second))
+	assert.Equal(t, len(limiter.buckets), 1)
+
+	_, ok := limiter.buckets["idle"]
+	assert.Equal(t, ok, false)
+}
+
+func TestRateLimiterIdleTTL(t *testing.T) {
+	// A bucket that takes longer than bucketIdleTTL to refill is kept
+	// until it is full, so evicting it doesn't hand out tokens.
+	limiter := newRateLimiter(0.01, 10)
+	assert.Equal(t, limiter.idleTTL, 1000*time.Second)
+
+	limiter = newRateLimiter(10, 10)
+	assert.Equal(t, limiter.idleTTL, bucketIdleTTL)
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	testMap := []struct {
+		name        string
+		proxies     []string
+		networks    []string
+		shouldError bool
+	}{
+		{
+			name:     "IPv4",
+			proxies:  []string{"10.0.0.1"},
+			networks: []string{"10.0.0.1/32"},
+		},
+		{
+			name:     "IPv6",
+			proxies:  []string{"fd00::1"},
+			networks: []string{"fd00::1/128"},
+		},
+		{
+			name:     "CIDRs",
+			proxies:  []string{"10.0.0.0/8", "fd00::/8"},
+			networks: []string{"10.0.0.0/8", "fd00::/8"},
+		},
+		{
+			name:    "Empty",
+			proxies: nil,
+		},
+		{
+			name:        "Hostname Should Error",
+			proxies:     []string{"proxy.internal"},
+			shouldError: true,
+		},
+		{
+			name:        "Invalid CIDR Should Error",
+			proxies:     []string{"10.0.0.0/33"},
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			networks, err := parseTrustedProxies(tt.proxies)
+
+			if tt.shouldError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, len(networks), len(tt.networks))
+
+			for i, network := range networks {
+				assert.Equal(t, network.String(), tt.networks[i])
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trustedProxies, err := parseTrustedProxies([]string{"10.0.0.0/8", "fd00::/8"})
+	assert.NilError(t, err)
+
+	limiters := &rateLimiters{trustedProxies: trustedProxies}
+
+	testMap := []struct {
+		name          string
+		remoteAddr    string
+		xForwardedFor []string
+		xRealIP       string
+		ip            string
+	}{
+		{
+			name:       "Direct Client",
+			remoteAddr: "203.0.113.7:4000",
+			ip:         "203.0.113.7",
+		},
+		{
+			name:          "Spoofed X-Forwarded-For From Untrusted Client",
+			remoteAddr:    "203.0.113.7:4000",
+			xForwardedFor: []string{"198.51.100.1"},
+			ip:            "203.0.113.7",
+		},
+		{
+			name:       "Spoofed X-Real-IP From Untrusted Client",
+			remoteAddr: "203.0.113.7:4000",
+			xRealIP:    "198.51.100.1",
+			ip:         "203.0.113.7",
+		},
+		{
+			name:          "Trusted Proxy",
+			remoteAddr:    "10.0.0.1:4000",
+			xForwardedFor: []string{"203.0.113.7"},
+			ip:            "203.0.113.7",
+		},
+		{
+			name:          "Client Prepends Spoofed Hops",
+			remoteAddr:    "10.0.0.1:4000",
+			xForwardedFor: []string{"198.51.100.1, 198.51.100.2, 203.0.113.7"},
+			ip:            "203.0.113.7",
+		},
+		{
+			name:          "Chain Of Trusted Proxies",
+			remoteAddr:    "10.0.0.1:4000",
+			xForwardedFor: []string{"198.51.100.1, 203.0.113.7, 10.0.0.3, 10.0.0.2"},
+			ip:            "203.0.113.7",
+		},
+		{
+			name:          "Split Across Headers",
+			remoteAddr:    "10.0.0.1:4000",
+			xForwardedFor: []string{"198.51.100.1", "203.0.113.7, 10.0.0.2"},
+			ip:            "203.0.113.7",
+		},
+		{
+			name:          "Only Trusted Hops",
+			remoteAddr:    "10.0.0.1:4000",
+			xForwardedFor: []string{"10.0.0.3, 10.0.0.2"},
+			ip:            "10.0.0.3",
+		},
+		{
+			name:          "Invalid Hop Stops The Walk",
+			remoteAddr:    "10.0.0.1:4000",
+			xForwardedFor: []string{"203.0.113.7, garbage, 10.0.0.2"},
+			ip:            "10.0.0.2",
+		},
+		{
+			name:       "X-Real-IP From Trusted Proxy",
+			remoteAddr: "10.0.0.1:4000",
+			xRealIP:    "203.0.113.7",
+			ip:         "203.0.113.7",
+		},
+		{
+			name:       "Trusted Proxy Without Headers",
+			remoteAddr: "10.0.0.1:4000",
+			ip:         "10.0.0.1",
+		},
+		{
+			name:          "IPv6",
+			remoteAddr:    "[fd00::1]:4000",
+			xForwardedFor: []string{"2001:db8::7"},
+			ip:            "2001:db8::7",
+		},
+		{
+			name:       "Remote Address Without Port",
+			remoteAddr: "203.0.113.7",
+			ip:         "203.0.113.7",
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+
+			for _, value := range tt.xForwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			if tt.xRealIP != "" {
+				r.Header.Set("X-Real-IP", tt.xRealIP)
+			}
+
+			assert.Equal(t, limiters.clientIP(r), tt.ip)
+		})
+	}
+}
+
+func TestAuthenticationGuessesAreLimited(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.Limiter.Enabled = true
+
+	limiters, err := newRateLimiters(app.config)
+	assert.NilError(t, err)
+	app.limiters = limiters
+
+	handler := app.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	guess := func() int {
+		r := httptest.NewRequest(http.MethodGet, "/workflows", nil)
+		r.RemoteAddr = "203.0.113.7:4000"
+		r.Header.Set("Authorization", "Bearer not-a-token")
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+
+		return rec.Code
+	}
+
+	for i := 0; i < app.config.Limiter.Burst; i++ {
+		assert.Equal(t, guess(), http.StatusUnauthorized)
+	}
+
+	assert.Equal(t, guess(), http.StatusTooManyRequests)
+}
+
+func TestWebhookIngestionHasItsOwnLimits(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.Limiter.Enabled = true
+	app.config.Limiter.Burst = 1
+	app.config.Limiter.Webhooks.Burst = 3
+
+	limiters, err := newRateLimiters(app.config)
+	assert.NilError(t, err)
+	app.limiters = limiters
+
+	handler := app.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		r.RemoteAddr = "203.0.113.7:4000"
+		r = app.contextSetUser(r, data.AnonymousUser)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+
+		return rec
+	}
+
+	for i := 0; i < 3; i++ {
+		rec := request("/hooks/github")
+		assert.Equal(t, rec.Code, http.StatusOK)
+		assert.Equal(t, rec.Header().Get("RateLimit-Limit"), "3")
+	}
+
+	assert.Equal(t, request("/hooks/github").Code, http.StatusTooManyRequests)
+
+	// The webhooks used up their own bucket, not the one of the client.
+	assert.Equal(t, request("/workflows").Code, http.StatusOK)
+	assert.Equal(t, request("/workflows").Code, http.StatusTooManyRequests)
+}
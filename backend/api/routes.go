@@ -4,28 +4,118 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
+	"github.com/luisya22/confluo/backend/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 func (app *Application) routes() http.Handler {
 	router := chi.NewRouter()
 
-	router.Use(middleware.Logger)
+	router.Use(app.requestID)
+	router.Use(otelhttp.NewMiddleware("http"))
+	router.Use(app.traceRoute)
+	router.Use(app.logRequest)
+	router.Use(app.recordMetrics)
+	router.Use(app.recoverPanic)
+	router.Use(app.enableCORS)
+	router.Use(app.authenticate)
+	router.Use(app.rateLimit)
 
 	// routes
-	// Get Workflows
-	// Get Workflow
 	// Post Workflow
-	// Patch Workflow
 	// Post WorkflowAction
-	// Patch WorkflowAction
 
 	// Github Oauth
 	// Google Sheets Oauth
 
+	// Health
+	router.Get("/healthz", app.healthzHandler)
+	router.Get("/readyz", app.readyzHandler)
+	router.Get("/version", app.versionHandler)
+
+	// Metrics
+	router.Method(http.MethodGet, "/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+
 	// Authentication
 	router.Group(func(r chi.Router) {
-		r.Post("/auth/github/callback")
+		r.Post("/auth/github/callback", app.githubCallbackHandler)
+		r.With(app.requireAuthenticatedUser).Delete("/auth/token", app.logoutHandler)
+	})
+
+	// Workflows
+	router.Group(func(r chi.Router) {
+		r.Use(app.requireAuthenticatedUser)
+
+		r.Get("/workflows", app.listWorkflowsHandler)
+		r.Get("/workflows/{id}", app.showWorkflowHandler)
+		r.Patch("/workflows/{id}", app.updateWorkflowHandler)
+		r.Post("/workflows/{id}/dry-run", app.dryRunWorkflowHandler)
+		r.Post("/workflows/{id}/rerun", app.rerunFailedHandler)
+		r.Patch("/workflow-actions/{id}", app.updateWorkflowActionHandler)
+		r.Post("/workflow-actions/{id}/test", app.testWorkflowActionHandler)
+	})
+
+	// Workspaces
+	router.Group(func(r chi.Router) {
+		r.Use(app.requireAuthenticatedUser)
+
+		r.Get("/workspaces", app.listWorkspacesHandler)
+		r.Post("/workspaces", app.createWorkspaceHandler)
+		r.Get("/workspaces/{id}", app.showWorkspaceHandler)
+		r.Patch("/workspaces/{id}", app.updateWorkspaceHandler)
+		r.Patch("/workspaces/{id}/members/{userId}", app.updateWorkspaceMemberHandler)
+		r.Delete("/workspaces/{id}/members/{userId}", app.removeWorkspaceMemberHandler)
+		r.Get("/workspaces/{id}/invitations", app.listWorkspaceInvitationsHandler)
+		r.Post("/workspaces/{id}/invitations", app.createWorkspaceInvitationHandler)
+		r.Delete("/workspaces/{id}/invitations/{invitationId}", app.deleteWorkspaceInvitationHandler)
+		r.Post("/invitations/accept", app.acceptInvitationHandler)
+	})
+
+	// Search
+	router.Group(func(r chi.Router) {
+		r.Use(app.requireAuthenticatedUser)
+
+		r.Get("/search", app.searchHandler)
+	})
+
+	// Runs
+	router.Group(func(r chi.Router) {
+		r.Use(app.requireAuthenticatedUser)
+
+		r.Get("/runs/{id}", app.showRunHandler)
+		r.Post("/runs/{id}/cancel", app.cancelRunHandler)
+		r.Post("/runs/{id}/rerun", app.rerunHandler)
+	})
+
+	// Approvals
+	router.Group(func(r chi.Router) {
+		r.Use(app.requireAuthenticatedUser)
+
+		r.Get("/approvals", app.listApprovalsHandler)
+		r.Get("/approvals/{id}", app.showApprovalHandler)
+		r.Post("/approvals/{id}/approve", app.approveHandler)
+		r.Post("/approvals/{id}/reject", app.rejectHandler)
+	})
+
+	// Dead Letters
+	router.Group(func(r chi.Router) {
+		r.Use(app.requireAuthenticatedUser)
+
+		r.Get("/dead-letters", app.listDeadLettersHandler)
+		r.Get("/dead-letters/depth", app.deadLetterDepthHandler)
+		r.Get("/dead-letters/{id}", app.showDeadLetterHandler)
+		r.Post("/dead-letters/{id}/requeue", app.requeueDeadLetterHandler)
+		r.Post("/dead-letters/{id}/discard", app.discardDeadLetterHandler)
+	})
+
+	// Webhook Deliveries
+	router.Group(func(r chi.Router) {
+		r.Use(app.requireAuthenticatedUser)
+
+		r.Get("/webhooks/deliveries", app.listWebhookDeliveriesHandler)
+		r.Get("/webhooks/deliveries/{id}", app.showWebhookDeliveryHandler)
+		r.Post("/webhooks/deliveries/{id}/redeliver", app.redeliverWebhookHandler)
 	})
 
 	return router
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/engine"
+	"github.com/luisya22/confluo/backend/internal/metrics"
+	"github.com/luisya22/confluo/backend/internal/validator"
+)
+
+func (app *Application) showRunHandler(w http.ResponseWriter, r *http.Request) {
+	run, ok := app.getPermittedRun(w, r, data.PermissionView)
+	if !ok {
+		return
+	}
+
+	steps, err := app.models.RunSteps.GetAllForRun(run.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	children, err := app.models.Runs.GetChildren(run.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"run": run, "steps": steps, "children": children}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// cancelRunHandler stops a queued, running or waiting run. Pending timers
+// are dropped with it.
+func (app *Application) cancelRunHandler(w http.ResponseWriter, r *http.Request) {
+	run, ok := app.getPermittedRun(w, r, data.PermissionRun)
+	if !ok {
+		return
+	}
+
+	err := app.models.Runs.Cancel(run.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.errorResponse(w, r, http.StatusConflict, "the run has already finished")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	run, err = app.models.Runs.Get(run.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if run.FinishedAt != nil {
+		metrics.ObserveRunFinished(run.Status, run.FinishedAt.Sub(run.CreatedAt))
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"run": run}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// rerunHandler queues a new run that replays a finished run from the
+// beginning, from its failed step or from a given step, using the params
+// recorded in the run history.
+func (app *Application) rerunHandler(w http.ResponseWriter, r *http.Request) {
+	run, ok := app.getPermittedRun(w, r, data.PermissionRun)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		From string `json:"from"`
+	}
+
+	if r.ContentLength != 0 {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	v := validator.New()
+
+	validateReplayFrom(v, input.From)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	replay, err := app.engine.Replay(r.Context(), run, input.From)
+	if err != nil {
+		switch {
+		case errors.Is(err, engine.ErrNotReplayable):
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"run": replay}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// rerunFailedHandler replays the failed runs of a workflow that finished
+// within a time window, e.g. the minutes a provider was down. A window with
+// more failed runs than one re-run takes reports more, and the client
+// repeats the request until it doesn't.
+func (app *Application) rerunFailedHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	workflow, ok := app.getPermittedWorkflow(w, r, id, data.PermissionRun)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Since *time.Time `json:"since"`
+		Until *time.Time `json:"until"`
+		From  string     `json:"from"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	until := time.Now()
+	if input.Until != nil {
+		until = *input.Until
+	}
+
+	v := validator.New()
+
+	v.Check(input.Since != nil, "since", "must be provided")
+	v.Check(input.Since == nil || input.Since.Before(until), "since", "must be before until")
+	v.Check(input.From == "" || input.From == engine.ReplayFromStart || input.From == engine.ReplayFromFailedStep, "from", "must be start or failed")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	bulk, err := app.engine.ReplayFailed(r.Context(), workflow.Id, *input.Since, until, input.From)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{
+		"runs":    bulk.Runs,
+		"skipped": bulk.Skipped,
+		"count":   len(bulk.Runs),
+		"more":    bulk.More,
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func validateReplayFrom(v *validator.Validator, from string) {
+	switch from {
+	case "", engine.ReplayFromStart, engine.ReplayFromFailedStep:
+	default:
+		v.Check(validator.Matches(from, validator.UUIDRX), "from", "must be start, failed or a step id")
+	}
+}
+
+// getPermittedRun loads the run in the id URL param and checks that the
+// current user has the permission in the workspace of its workflow. It
+// writes a not found response when the run doesn't exist or the user isn't
+// a member of the workspace.
+func (app *Application) getPermittedRun(w http.ResponseWriter, r *http.Request, permission string) (*data.WorkflowRun, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	run, err := app.models.Runs.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	workspaceId, err := app.models.Workflows.GetWorkspaceId(run.WorkflowId)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if _, ok := app.requirePermission(w, r, workspaceId, permission); !ok {
+		return nil, false
+	}
+
+	return run, true
+}
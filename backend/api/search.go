@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/validator"
+)
+
+// searchHandler searches the user's workflows, steps and run errors for q.
+// kind takes comma separated kinds of result to search, all of them by
+// default.
+func (app *Application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	q := app.readString(qs, "q", "")
+	v.Check(q != "", "q", "must be provided")
+	v.Check(len(q) <= 200, "q", "must not be more than 200 bytes long")
+
+	kinds := app.readCSV(qs, "kind", nil)
+	for _, kind := range kinds {
+		v.Check(validator.PermittedValue(kind, data.SearchKindWorkflow, data.SearchKindStep, data.SearchKindRun), "kind", "invalid kind value")
+	}
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         "-rank",
+		SortSafeList: []string{"-rank"},
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	results, metadata, err := app.models.Search.Search(user.Id, q, kinds, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"results": results, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
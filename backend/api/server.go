@@ -10,22 +10,37 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/engine"
 	"github.com/luisya22/confluo/backend/internal/executor"
+	"github.com/luisya22/confluo/backend/internal/migrations"
+	"github.com/luisya22/confluo/backend/internal/providers/github"
+	httpprovider "github.com/luisya22/confluo/backend/internal/providers/http"
+	"github.com/luisya22/confluo/backend/internal/providers/system"
+	"github.com/luisya22/confluo/backend/internal/providers/webhook"
 	"github.com/luisya22/confluo/backend/oauth"
 )
 
 type Application struct {
-	config       Config
-	logger       *slog.Logger
-	models       data.Models
-	wg           sync.WaitGroup
-	executor     *executor.Executor
-	oauhtService *oauth.OauthService
+	config          Config
+	logger          *slog.Logger
+	models          data.Models
+	wg              sync.WaitGroup
+	executor        *executor.Executor
+	webhooks        *webhook.Sender
+	engine          *engine.Engine
+	oauhtService    *oauth.OauthService
+	limiters        *rateLimiters
+	trustedOrigins  []trustedOrigin
+	shutdownTracing func(context.Context) error
+	db              *sqlx.DB
+	migrator        *migrations.Migrator
+	shuttingDown    atomic.Bool
 }
 
 func NewApplication(cfg Config) *Application {
@@ -36,8 +51,50 @@ func NewApplication(cfg Config) *Application {
 		log.Fatal(err)
 	}
 
+	migrator, err := migrations.New(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg.DB.AutoMigrate {
+		applied, err := migrator.Up()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		logger.Info("migrated database", "applied", len(applied), "version", migrator.Latest())
+	}
+
+	shutdownTracing, err := setupTracing(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	models := data.NewModels(db)
 
+	exec := executor.NewExecutor()
+
+	github.Initialize(exec)
+	system.Initialize(exec)
+
+	httpConfig := httpprovider.Config{
+		AllowedHosts: cfg.Providers.Http.AllowedHosts,
+		DeniedHosts:  cfg.Providers.Http.DeniedHosts,
+	}
+
+	err = httpprovider.Initialize(exec, httpConfig, models.Connections)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	webhookClient, err := httpprovider.NewClient(httpConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	webhooks := webhook.NewSender(webhookClient, models.WebhookDeliveries, models.Connections)
+	webhook.Initialize(exec, webhooks)
+
 	oauthConfig := oauth.Config{
 		Github: oauth.Github{
 			ClientId:     cfg.Providers.Github.ClientId,
@@ -50,12 +107,39 @@ func NewApplication(cfg Config) *Application {
 
 	oauthService := oauth.NewOauthService(oauthConfig)
 
+	eng := engine.New(models, exec, logger, engine.Config{
+		Workers:         cfg.Engine.Workers,
+		PollInterval:    cfg.Engine.PollInterval,
+		DedupeRetention: cfg.Engine.DedupeRetention,
+		RunLease:        cfg.Engine.RunLease,
+		RetryAttempts:   cfg.Engine.RetryAttempts,
+		RetryBackoff:    cfg.Engine.RetryBackoff,
+	})
+
+	limiters, err := newRateLimiters(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	trustedOrigins, err := parseTrustedOrigins(cfg.Cors.TrustedOrigins)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	return &Application{
-		config:       cfg,
-		logger:       logger,
-		models:       models,
-		wg:           sync.WaitGroup{},
-		oauhtService: oauthService,
+		config:          cfg,
+		logger:          logger,
+		models:          models,
+		wg:              sync.WaitGroup{},
+		executor:        exec,
+		webhooks:        webhooks,
+		engine:          eng,
+		oauhtService:    oauthService,
+		limiters:        limiters,
+		trustedOrigins:  trustedOrigins,
+		shutdownTracing: shutdownTracing,
+		db:              db,
+		migrator:        migrator,
 	}
 
 }
@@ -96,7 +180,24 @@ func (app *Application) Serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 
-	shutdownError := make(chan error)
+	shutdownError := make(chan error, 1)
+
+	engineCtx, stopEngine := context.WithCancel(context.Background())
+	defer stopEngine()
+
+	app.background(func() {
+		app.engine.RunScheduler(engineCtx)
+	})
+
+	app.background(func() {
+		app.deleteExpiredTokens(engineCtx)
+	})
+
+	for i := 0; i < app.engine.Workers(); i++ {
+		app.background(func() {
+			app.engine.RunWorker(engineCtx)
+		})
+	}
 
 	go func() {
 		quit := make(chan os.Signal, 1)
@@ -107,25 +208,39 @@ func (app *Application) Serve() error {
 
 		app.logger.Info("shutting down server", "signal", s.String())
 
+		// Fail readiness first and give load balancers time to notice
+		// before the listener closes.
+		app.shuttingDown.Store(true)
+		time.Sleep(app.config.ShutdownDelay)
+
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		err := srv.Shutdown(ctx)
-		if err != nil {
-			shutdownError <- err
-		}
+		// The background tasks are drained even when the listener didn't
+		// close in time; its error is reported once they are done.
+		shutdownErr := srv.Shutdown(ctx)
 
 		app.logger.Info("completing background tasks", "addr", srv.Addr)
 
+		stopEngine()
 		app.wg.Wait()
 
-		shutdownError <- nil
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := app.shutdownTracing(ctx)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+
+		shutdownError <- shutdownErr
 	}()
 
 	app.logger.Info(
 		"starting server",
 		"addr", srv.Addr,
 		"env", app.config.Env,
+		"config", app.config,
 	)
 
 	err := srv.ListenAndServe()
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+)
+
+// newTestApplication returns an Application with the default config, a
+// discarded log and no database.
+func newTestApplication(t *testing.T) *Application {
+	t.Helper()
+
+	cfg, _, err := LoadConfig(nil, func(string) string { return "" }, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Application{
+		config: cfg,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
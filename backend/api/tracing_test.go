@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceRoute(t *testing.T) {
+	testMap := []struct {
+		name  string
+		path  string
+		span  string
+		route string
+	}{
+		{name: "Named After The Route Pattern", path: "/v1/runs/1", span: "GET /v1/runs/{id}", route: "/v1/runs/{id}"},
+		{name: "Other Id Gets The Same Name", path: "/v1/runs/2", span: "GET /v1/runs/{id}", route: "/v1/runs/{id}"},
+		{name: "Unmatched Route Keeps The Default Name", path: "/v1/missing", span: "http"},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+			router := chi.NewRouter()
+			router.Use(app.requestID)
+			router.Use(otelhttp.NewMiddleware("http", otelhttp.WithTracerProvider(provider)))
+			router.Use(app.traceRoute)
+			router.Get("/v1/runs/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Header.Set("X-Request-ID", "req-1")
+
+			router.ServeHTTP(httptest.NewRecorder(), r)
+
+			spans := recorder.Ended()
+			assert.Equal(t, len(spans), 1)
+			assert.Equal(t, spans[0].Name(), tt.span)
+
+			attrs := make(map[string]string)
+			for _, attr := range spans[0].Attributes() {
+				attrs[string(attr.Key)] = attr.Value.Emit()
+			}
+
+			assert.Equal(t, attrs["confluo.request_id"], "req-1")
+			assert.Equal(t, attrs["http.route"], tt.route)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/providers/webhook"
+	"github.com/luisya22/confluo/backend/internal/validator"
+)
+
+func (app *Application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	status := app.readString(qs, "status", "")
+	v.Check(
+		validator.PermittedValue(status, "", data.DeliveryStatusPending, data.DeliveryStatusDelivered, data.DeliveryStatusFailed),
+		"status",
+		"invalid status value",
+	)
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         "-created_at",
+		SortSafeList: []string{"-created_at"},
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	deliveries, metadata, err := app.models.WebhookDeliveries.GetAllForUser(user.Id, status, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"deliveries": deliveries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) showWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	delivery, ok := app.getPermittedDelivery(w, r, data.PermissionView)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"delivery": delivery}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// redeliverWebhookHandler sends the delivery again with the same delivery
+// id, a new timestamp and a signature made with the current secret of the
+// connection it was first signed with.
+func (app *Application) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	delivery, ok := app.getPermittedDelivery(w, r, data.PermissionRun)
+	if !ok {
+		return
+	}
+
+	// The attempt is recorded even if the client goes away, so it shouldn't
+	// be cancelled with the request.
+	attempt, err := app.webhooks.Deliver(context.WithoutCancel(r.Context()), delivery)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, webhook.ErrNoSecret):
+			app.errorResponse(w, r, http.StatusConflict, "the connection the delivery was signed with no longer exists")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	delivery.Attempts = append(delivery.Attempts, *attempt)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"delivery": delivery}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getPermittedDelivery loads the delivery in the id URL param and checks
+// that the current user has the permission in the workspace of the
+// workflow that sent it. It writes a not found response when the delivery
+// doesn't exist or the user isn't a member of the workspace.
+func (app *Application) getPermittedDelivery(w http.ResponseWriter, r *http.Request, permission string) (*data.WebhookDelivery, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	workspaceId, err := app.models.WebhookDeliveries.GetWorkspaceId(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if _, ok := app.requirePermission(w, r, workspaceId, permission); !ok {
+		return nil, false
+	}
+
+	delivery, err := app.models.WebhookDeliveries.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return delivery, true
+}
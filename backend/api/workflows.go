@@ -0,0 +1,301 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/validator"
+)
+
+// listWorkflowsHandler lists the workflows of the user's workspaces, or of
+// the one in workspace_id. They can be searched by name and filtered by the
+// providers their steps use, the status of their last run and their tags,
+// which take comma separated values. Pages are picked with page, or with the
+// cursor from the metadata of the previous page.
+func (app *Application) listWorkflowsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	workflowFilters := data.WorkflowFilters{
+		WorkspaceId: app.readString(qs, "workspace_id", ""),
+		Name:        app.readString(qs, "name", ""),
+		Providers:   app.readCSV(qs, "provider", nil),
+		Statuses:    app.readCSV(qs, "status", nil),
+		Tags:        app.readCSV(qs, "tag", nil),
+	}
+
+	filters := data.Filters{
+		Page:     app.readInt(qs, "page", 1, v),
+		PageSize: app.readInt(qs, "page_size", 20, v),
+		Sort:     app.readString(qs, "sort", "-updated_at"),
+		Cursor:   app.readString(qs, "cursor", ""),
+		SortSafeList: []string{
+			"name", "created_at", "updated_at", "last_run_at",
+			"-name", "-created_at", "-updated_at", "-last_run_at",
+		},
+	}
+
+	data.ValidateWorkflowFilters(v, workflowFilters)
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	workflows, metadata, err := app.models.Workflows.GetAll(user.Id, workflowFilters, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"workflows": workflows, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) showWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	workflow, ok := app.getPermittedWorkflow(w, r, id, data.PermissionView)
+	if !ok {
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"workflow": workflow}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateWorkflowHandler saves the name, the tags and the error-handler
+// workflow of a workflow. Fields left out of the body keep their value; an empty
+// errorWorkflowId removes the error handler.
+func (app *Application) updateWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	workflow, ok := app.getPermittedWorkflow(w, r, id, data.PermissionEdit)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name            *string   `json:"name"`
+		Tags            *[]string `json:"tags"`
+		ErrorWorkflowId *string   `json:"errorWorkflowId"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		workflow.Name = *input.Name
+	}
+
+	if input.Tags != nil {
+		workflow.Tags = *input.Tags
+	}
+
+	if input.ErrorWorkflowId != nil {
+		workflow.ErrorWorkflowId.String = *input.ErrorWorkflowId
+		workflow.ErrorWorkflowId.Valid = *input.ErrorWorkflowId != ""
+	}
+
+	v := validator.New()
+
+	v.Check(workflow.Name != "", "name", "must be provided")
+	v.Check(len(workflow.Name) <= 50, "name", "must not be more than 50 bytes long")
+
+	data.ValidateTags(v, workflow.Tags)
+
+	if workflow.ErrorWorkflowId.Valid {
+		v.Check(workflow.ErrorWorkflowId.String != workflow.Id, "errorWorkflowId", "must be another workflow")
+		v.Check(validator.Matches(workflow.ErrorWorkflowId.String, validator.UUIDRX), "errorWorkflowId", "must be a valid id")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if workflow.ErrorWorkflowId.Valid {
+		workspaceId, err := app.models.Workflows.GetWorkspaceId(workflow.ErrorWorkflowId.String)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if workspaceId != workflow.WorkspaceId {
+			app.failedValidationResponse(w, r, map[string]string{"errorWorkflowId": "must be a workflow of the same workspace"})
+			return
+		}
+	}
+
+	err = app.models.Workflows.Update(workflow)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"workflow": workflow}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateWorkflowActionHandler saves the text, params and outgoing edges of a
+// step. Fields left out of the body keep their value; an empty
+// nextActionId or errorActionId removes the edge and an empty branches
+// list removes every branch.
+func (app *Application) updateWorkflowActionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	workflowAction, err := app.models.WorkflowActions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	workflow, ok := app.getPermittedWorkflow(w, r, workflowAction.WorkflowId, data.PermissionEdit)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Text          *string                `json:"text"`
+		Params        map[string]interface{} `json:"params"`
+		NextActionId  *string                `json:"nextActionId"`
+		ErrorActionId *string                `json:"errorActionId"`
+		Branches      []data.WorkflowBranch  `json:"branches"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Text != nil {
+		workflowAction.Text = *input.Text
+	}
+
+	if input.Params != nil {
+		workflowAction.Params = input.Params
+	}
+
+	if input.NextActionId != nil {
+		workflowAction.NextActionId.String = *input.NextActionId
+		workflowAction.NextActionId.Valid = *input.NextActionId != ""
+	}
+
+	if input.ErrorActionId != nil {
+		workflowAction.ErrorActionId.String = *input.ErrorActionId
+		workflowAction.ErrorActionId.Valid = *input.ErrorActionId != ""
+	}
+
+	if input.Branches != nil {
+		workflowAction.Branches = input.Branches
+	}
+
+	v := validator.New()
+
+	v.Check(len(workflowAction.Text) <= 255, "text", "must not be more than 255 bytes long")
+	data.ValidateBranches(v, workflowAction.Branches)
+
+	if workflowAction.NextActionId.Valid {
+		v.Check(isWorkflowStep(workflow, workflowAction.NextActionId.String, workflowAction.Id), "nextActionId", "must be another step of the workflow")
+	}
+
+	if workflowAction.ErrorActionId.Valid {
+		v.Check(isWorkflowStep(workflow, workflowAction.ErrorActionId.String, workflowAction.Id), "errorActionId", "must be another step of the workflow")
+	}
+
+	for _, b := range workflowAction.Branches {
+		v.Check(isWorkflowStep(workflow, b.NextActionId, workflowAction.Id), "branches", "every branch must point to another step of the workflow")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.WorkflowActions.Update(workflowAction)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"workflowAction": workflowAction}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getPermittedWorkflow loads the workflow and checks that the current user
+// has the permission in its workspace. It writes a not found response when
+// the workflow doesn't exist or the user isn't a member of its workspace.
+func (app *Application) getPermittedWorkflow(w http.ResponseWriter, r *http.Request, id string, permission string) (*data.Workflow, bool) {
+	workflow, err := app.models.Workflows.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if _, ok := app.requirePermission(w, r, workflow.WorkspaceId, permission); !ok {
+		return nil, false
+	}
+
+	return workflow, true
+}
+
+func isWorkflowStep(workflow *data.Workflow, id string, self string) bool {
+	if id == self {
+		return false
+	}
+
+	for _, a := range workflow.Actions {
+		if a.Id == id {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,429 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/validator"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+// listWorkspacesHandler lists the workspaces the current user belongs to,
+// with the user's role in each.
+func (app *Application) listWorkspacesHandler(w http.ResponseWriter, r *http.Request) {
+	workspaces, err := app.models.Workspaces.GetAllForUser(app.contextGetUser(r).Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"workspaces": workspaces}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createWorkspaceHandler creates a workspace owned by the current user.
+func (app *Application) createWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	workspace := &data.Workspace{Name: input.Name}
+
+	v := validator.New()
+
+	if data.ValidateWorkspace(v, workspace); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Workspaces.Insert(workspace, app.contextGetUser(r).Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"workspace": workspace}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showWorkspaceHandler returns the workspace with its members.
+func (app *Application) showWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := app.getPermittedWorkspace(w, r, data.PermissionView)
+	if !ok {
+		return
+	}
+
+	members, err := app.models.Workspaces.GetMembers(workspace.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"workspace": workspace, "members": members}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) updateWorkspaceHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := app.getPermittedWorkspace(w, r, data.PermissionManageWorkspace)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name *string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		workspace.Name = *input.Name
+	}
+
+	v := validator.New()
+
+	if data.ValidateWorkspace(v, workspace); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Workspaces.Update(workspace)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"workspace": workspace}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateWorkspaceMemberHandler changes the role of a member. Only owners
+// can make someone an owner or change the role of another owner.
+func (app *Application) updateWorkspaceMemberHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := app.getPermittedWorkspace(w, r, data.PermissionManageMembers)
+	if !ok {
+		return
+	}
+
+	userId, err := app.readUUIDParam(r, "userId")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateRole(v, input.Role); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	memberRole, ok := app.getMemberRole(w, r, workspace.Id, userId)
+	if !ok {
+		return
+	}
+
+	if workspace.Role != data.RoleOwner && (input.Role == data.RoleOwner || memberRole == data.RoleOwner) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Workspaces.SetRole(workspace.Id, userId, input.Role)
+	if err != nil {
+		app.memberChangeErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"member": envelope{"userId": userId, "role": input.Role}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// removeWorkspaceMemberHandler takes a member out of the workspace. Members
+// can always leave; removing someone else takes the permission to manage
+// members, and removing an owner takes being one. The workflows and
+// connections the member made stay in the workspace.
+func (app *Application) removeWorkspaceMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userId, err := app.readUUIDParam(r, "userId")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	permission := data.PermissionManageMembers
+	if userId == app.contextGetUser(r).Id {
+		permission = data.PermissionView
+	}
+
+	workspace, ok := app.getPermittedWorkspace(w, r, permission)
+	if !ok {
+		return
+	}
+
+	memberRole, ok := app.getMemberRole(w, r, workspace.Id, userId)
+	if !ok {
+		return
+	}
+
+	if memberRole == data.RoleOwner && workspace.Role != data.RoleOwner {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Workspaces.RemoveMember(workspace.Id, userId)
+	if err != nil {
+		app.memberChangeErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "member successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createWorkspaceInvitationHandler creates an invitation to the workspace.
+// Its token is only in this response; whoever has it can join the
+// workspace with the role. Only owners can invite owners.
+func (app *Application) createWorkspaceInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := app.getPermittedWorkspace(w, r, data.PermissionManageMembers)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateRole(v, input.Role)
+	v.Check(input.Email == "" || validator.Matches(input.Email, validator.EmailRX), "email", "must be a valid email address")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.Role == data.RoleOwner && workspace.Role != data.RoleOwner {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	invitation, err := app.models.Workspaces.Invite(workspace.Id, input.Email, input.Role, app.contextGetUser(r).Id, invitationTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"invitation": invitation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) listWorkspaceInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := app.getPermittedWorkspace(w, r, data.PermissionManageMembers)
+	if !ok {
+		return
+	}
+
+	invitations, err := app.models.Workspaces.GetInvitations(workspace.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"invitations": invitations}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *Application) deleteWorkspaceInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := app.getPermittedWorkspace(w, r, data.PermissionManageMembers)
+	if !ok {
+		return
+	}
+
+	invitationId, err := app.readUUIDParam(r, "invitationId")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Workspaces.DeleteInvitation(workspace.Id, invitationId)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "invitation successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// acceptInvitationHandler adds the current user to the workspace of the
+// invitation with the token.
+func (app *Application) acceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.Token); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	workspace, err := app.models.Workspaces.AcceptInvitation(input.Token, app.contextGetUser(r).Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.failedValidationResponse(w, r, map[string]string{"token": "invalid or expired invitation token"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"workspace": workspace}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// requirePermission checks that the current user has the permission in the
+// workspace and returns the user's role in it. Users that aren't members
+// get a not found response, so they can't tell what the workspace holds;
+// members whose role doesn't allow it get a not permitted response.
+func (app *Application) requirePermission(w http.ResponseWriter, r *http.Request, workspaceId string, permission string) (string, bool) {
+	role, err := app.models.Workspaces.GetRole(workspaceId, app.contextGetUser(r).Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return "", false
+	}
+
+	if !data.RoleCan(role, permission) {
+		app.notPermittedResponse(w, r)
+		return "", false
+	}
+
+	return role, true
+}
+
+// getPermittedWorkspace loads the workspace in the id URL param and checks
+// that the current user has the permission in it.
+func (app *Application) getPermittedWorkspace(w http.ResponseWriter, r *http.Request, permission string) (*data.Workspace, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	if _, ok := app.requirePermission(w, r, id, permission); !ok {
+		return nil, false
+	}
+
+	workspace, err := app.models.Workspaces.Get(id, app.contextGetUser(r).Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return workspace, true
+}
+
+// getMemberRole returns the role of a member of the workspace and writes a
+// not found response when the user isn't one.
+func (app *Application) getMemberRole(w http.ResponseWriter, r *http.Request, workspaceId string, userId string) (string, bool) {
+	role, err := app.models.Workspaces.GetRole(workspaceId, userId)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return "", false
+	}
+
+	return role, true
+}
+
+func (app *Application) memberChangeErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, data.ErrLastOwner):
+		app.errorResponse(w, r, http.StatusConflict, "the workspace must keep at least one owner")
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -108,7 +109,7 @@ func main() {
 	params["repo"] = "galactic-exchange"
 	params["lastIssue"] = 11
 
-	params, err = extr.Execute("Github", "New Issue", params)
+	params, err = extr.Execute(context.Background(), "Github", "New Issue", params)
 	if err != nil {
 		log.Panic(err)
 	}
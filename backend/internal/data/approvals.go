@@ -0,0 +1,241 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	ApprovalStatusPending  = "pending"
+	ApprovalStatusApproved = "approved"
+	ApprovalStatusRejected = "rejected"
+	ApprovalStatusExpired  = "expired"
+)
+
+// ParamPendingApproval is the run param holding the id of the approval a
+// waiting run is parked on.
+const ParamPendingApproval = "pendingApprovalId"
+
+// Approval is a request for a person to approve or reject a paused run.
+// With no assignees, the members that can run the workflow decide.
+type Approval struct {
+	Id               string         `db:"id" json:"id"`
+	RunId            string         `db:"run_id" json:"runId"`
+	WorkflowActionId sql.NullString `db:"workflow_action_id" json:"workflowActionId"`
+	Assignees        []string       `db:"-" json:"assignees"`
+	Status           string         `db:"status" json:"status"`
+	Comment          string         `db:"comment" json:"comment,omitempty"`
+	DecidedBy        sql.NullString `db:"decided_by" json:"decidedBy"`
+	DecidedAt        *time.Time     `db:"decided_at" json:"decidedAt"`
+	ExpiresAt        *time.Time     `db:"expires_at" json:"expiresAt"`
+	CreatedAt        time.Time      `db:"created_at" json:"createdAt"`
+	Version          int            `db:"version" json:"version"`
+}
+
+// CanDecide reports whether the user can approve or reject. role is the
+// role of the user in the workspace of the workflow the approval belongs
+// to, empty when the user isn't a member. Only members decide: an assignee
+// that was removed from the workspace loses the approval. With no
+// assignees, the members that can run the workflow decide.
+func (a *Approval) CanDecide(userId string, role string) bool {
+	if role == "" {
+		return false
+	}
+
+	if len(a.Assignees) == 0 {
+		return RoleCan(role, PermissionRun)
+	}
+
+	for _, assignee := range a.Assignees {
+		if assignee == userId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Expired reports whether a pending approval can no longer be decided.
+func (a *Approval) Expired(now time.Time) bool {
+	return a.ExpiresAt != nil && !now.Before(*a.ExpiresAt)
+}
+
+type ApprovalModel struct {
+	DB *sqlx.DB
+}
+
+const approvalColumns = `a.id, a.run_id, a.workflow_action_id, a.assignees, a.status, a.comment,
+	a.decided_by, a.decided_at, a.expires_at, a.created_at, a.version`
+
+func (model ApprovalModel) Insert(a *Approval) error {
+	if a.RunId == "" {
+		return fmt.Errorf("run id cannot be empty")
+	}
+
+	if a.Assignees == nil {
+		a.Assignees = []string{}
+	}
+
+	a.Status = ApprovalStatusPending
+
+	query := `INSERT INTO approvals (run_id, workflow_action_id, assignees, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return model.DB.QueryRowxContext(
+		ctx,
+		query,
+		a.RunId,
+		a.WorkflowActionId,
+		pq.Array(a.Assignees),
+		a.Status,
+		a.ExpiresAt,
+	).Scan(&a.Id, &a.CreatedAt, &a.Version)
+}
+
+func (model ApprovalModel) Get(id string) (*Approval, error) {
+	query := `SELECT ` + approvalColumns + ` FROM approvals a WHERE a.id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	approval, err := scanApproval(model.DB.QueryRowxContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return approval, nil
+}
+
+// GetPendingForUser lists the approvals waiting on the user, either as an
+// assignee or as a member that can run a workflow whose approval has no
+// assignees. Assignees have to be members of the workspace as well.
+func (model ApprovalModel) GetPendingForUser(userId string) ([]*Approval, error) {
+	query := `SELECT ` + approvalColumns + `
+		FROM approvals a
+		INNER JOIN workflow_runs r ON a.run_id = r.id
+		INNER JOIN workflows w ON r.workflow_id = w.id
+		WHERE a.status = '` + ApprovalStatusPending + `'
+		AND r.status = '` + RunStatusWaiting + `'
+		AND EXISTS (
+			SELECT 1 FROM workspace_members m
+			WHERE m.workspace_id = w.workspace_id
+			AND m.user_id = $1
+			AND ($1 = ANY(a.assignees) OR (cardinality(a.assignees) = 0 AND m.role = ANY($2)))
+		)
+		ORDER BY a.created_at, a.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryxContext(ctx, query, userId, pq.Array(RolesWith(PermissionRun)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	approvals := []*Approval{}
+
+	for rows.Next() {
+		approval, err := scanApproval(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		approvals = append(approvals, approval)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return approvals, nil
+}
+
+// Decide records the decision of a user on a pending approval. It returns
+// ErrEditConflict when the approval was already decided or has expired.
+func (model ApprovalModel) Decide(a *Approval) error {
+	return model.decide(a, `AND (expires_at IS NULL OR expires_at > now())`)
+}
+
+// Expire marks a pending approval as expired. It returns ErrEditConflict
+// when the approval was decided in the meantime.
+func (model ApprovalModel) Expire(a *Approval) error {
+	a.Status = ApprovalStatusExpired
+	a.DecidedBy = sql.NullString{}
+
+	return model.decide(a, "")
+}
+
+func (model ApprovalModel) decide(a *Approval, condition string) error {
+	query := `UPDATE approvals SET
+			status = $1,
+			comment = $2,
+			decided_by = $3,
+			decided_at = now(),
+			version = version + 1
+		WHERE id = $4
+		AND version = $5
+		AND status = '` + ApprovalStatusPending + `'
+		` + condition + `
+		RETURNING decided_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := model.DB.QueryRowxContext(ctx, query, a.Status, a.Comment, a.DecidedBy, a.Id, a.Version).Scan(
+		&a.DecidedAt,
+		&a.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanApproval(row rowScanner) (*Approval, error) {
+	var approval Approval
+
+	err := row.Scan(
+		&approval.Id,
+		&approval.RunId,
+		&approval.WorkflowActionId,
+		pq.Array(&approval.Assignees),
+		&approval.Status,
+		&approval.Comment,
+		&approval.DecidedBy,
+		&approval.DecidedAt,
+		&approval.ExpiresAt,
+		&approval.CreatedAt,
+		&approval.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &approval, nil
+}
@@ -0,0 +1,229 @@
+package data_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/tests"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestApprovalDecide(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	runs := data.WorkflowRunModel{DB: db}
+	model := data.ApprovalModel{DB: db}
+
+	workflow := tests.Data.Workflows[1]
+	step := tests.Data.WorkflowActions[3]
+
+	run := data.WorkflowRun{WorkflowId: workflow.Id, NextActionId: sql.NullString{String: step.Id, Valid: true}}
+	assert.NilError(t, runs.Insert(&run))
+
+	run.Status = data.RunStatusWaiting
+	assert.NilError(t, runs.Update(&run))
+
+	approval := data.Approval{
+		RunId:            run.Id,
+		WorkflowActionId: sql.NullString{String: step.Id, Valid: true},
+	}
+
+	err := model.Insert(&approval)
+	assert.NilError(t, err)
+	assert.Equal(t, approval.Status, data.ApprovalStatusPending)
+
+	pending, err := model.GetPendingForUser(workflow.UserId)
+	assert.NilError(t, err)
+	assert.Equal(t, len(pending), 1)
+	assert.Equal(t, pending[0].Id, approval.Id)
+
+	pending, err = model.GetPendingForUser(tests.Data.Users[0].Id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(pending), 0)
+
+	assert.Equal(t, approval.CanDecide(workflow.UserId, data.RoleOwner), true)
+	assert.Equal(t, approval.CanDecide(workflow.UserId, data.RoleViewer), false)
+	assert.Equal(t, approval.CanDecide(tests.Data.Users[0].Id, ""), false)
+
+	approval.Status = data.ApprovalStatusApproved
+	approval.Comment = "Looks good"
+	approval.DecidedBy = sql.NullString{String: workflow.UserId, Valid: true}
+
+	err = model.Decide(&approval)
+	assert.NilError(t, err)
+
+	got, err := model.Get(approval.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Status, data.ApprovalStatusApproved)
+	assert.Equal(t, got.Comment, "Looks good")
+	assert.Equal(t, got.DecidedBy.String, workflow.UserId)
+	assert.NotEqual(t, got.DecidedAt, nil)
+
+	got.Status = data.ApprovalStatusRejected
+	err = model.Decide(got)
+	assert.Equal(t, errors.Is(err, data.ErrEditConflict), true)
+
+	err = runs.Resume(run.Id)
+	assert.NilError(t, err)
+
+	resumed, err := runs.Get(run.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, resumed.Status, data.RunStatusQueued)
+
+	err = runs.Resume(run.Id)
+	assert.Equal(t, errors.Is(err, data.ErrEditConflict), true)
+}
+
+func TestApprovalDecidedBeforeRunWaits(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	runs := data.WorkflowRunModel{DB: db}
+	model := data.ApprovalModel{DB: db}
+
+	workflow := tests.Data.Workflows[1]
+	step := tests.Data.WorkflowActions[3]
+
+	run := data.WorkflowRun{WorkflowId: workflow.Id, NextActionId: sql.NullString{String: step.Id, Valid: true}}
+	assert.NilError(t, runs.Insert(&run))
+
+	claimed, err := runs.ClaimNext(time.Minute)
+	assert.NilError(t, err)
+	assert.Equal(t, claimed.Id, run.Id)
+
+	approval := data.Approval{
+		RunId:            run.Id,
+		WorkflowActionId: sql.NullString{String: step.Id, Valid: true},
+	}
+	assert.NilError(t, model.Insert(&approval))
+
+	// The decision lands while the run is still running, so Resume misses.
+	approval.Status = data.ApprovalStatusApproved
+	approval.DecidedBy = sql.NullString{String: workflow.UserId, Valid: true}
+	assert.NilError(t, model.Decide(&approval))
+
+	err = runs.Resume(run.Id)
+	assert.Equal(t, errors.Is(err, data.ErrEditConflict), true)
+
+	claimed.Status = data.RunStatusWaiting
+	claimed.Params = map[string]interface{}{data.ParamPendingApproval: approval.Id}
+	assert.NilError(t, runs.Update(claimed))
+
+	n, err := runs.QueueDue()
+	assert.NilError(t, err)
+	assert.Equal(t, n, int64(1))
+
+	got, err := runs.Get(run.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Status, data.RunStatusQueued)
+}
+
+func TestApprovalPendingRunKeepsWaiting(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	runs := data.WorkflowRunModel{DB: db}
+	model := data.ApprovalModel{DB: db}
+
+	workflow := tests.Data.Workflows[1]
+	step := tests.Data.WorkflowActions[3]
+
+	run := data.WorkflowRun{WorkflowId: workflow.Id, NextActionId: sql.NullString{String: step.Id, Valid: true}}
+	assert.NilError(t, runs.Insert(&run))
+
+	approval := data.Approval{
+		RunId:            run.Id,
+		WorkflowActionId: sql.NullString{String: step.Id, Valid: true},
+	}
+	assert.NilError(t, model.Insert(&approval))
+
+	run.Status = data.RunStatusWaiting
+	run.Params = map[string]interface{}{data.ParamPendingApproval: approval.Id}
+	assert.NilError(t, runs.Update(&run))
+
+	n, err := runs.QueueDue()
+	assert.NilError(t, err)
+	assert.Equal(t, n, int64(0))
+}
+
+func TestApprovalAssigneesMustBeMembers(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	runs := data.WorkflowRunModel{DB: db}
+	model := data.ApprovalModel{DB: db}
+
+	workflow := tests.Data.Workflows[1]
+	step := tests.Data.WorkflowActions[3]
+
+	// Users[0] isn't a member of the workspace of the workflow, e.g.
+	// because they were removed after the approval was requested.
+	outsider := tests.Data.Users[0].Id
+
+	run := data.WorkflowRun{WorkflowId: workflow.Id, NextActionId: sql.NullString{String: step.Id, Valid: true}}
+	assert.NilError(t, runs.Insert(&run))
+
+	run.Status = data.RunStatusWaiting
+	assert.NilError(t, runs.Update(&run))
+
+	approval := data.Approval{
+		RunId:            run.Id,
+		WorkflowActionId: sql.NullString{String: step.Id, Valid: true},
+		Assignees:        []string{outsider, workflow.UserId},
+	}
+	assert.NilError(t, model.Insert(&approval))
+
+	pending, err := model.GetPendingForUser(outsider)
+	assert.NilError(t, err)
+	assert.Equal(t, len(pending), 0)
+
+	pending, err = model.GetPendingForUser(workflow.UserId)
+	assert.NilError(t, err)
+	assert.Equal(t, len(pending), 1)
+
+	assert.Equal(t, approval.CanDecide(outsider, ""), false)
+	assert.Equal(t, approval.CanDecide(outsider, data.RoleViewer), true)
+	assert.Equal(t, approval.CanDecide(workflow.UserId, data.RoleOwner), true)
+}
+
+func TestApprovalExpired(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	runs := data.WorkflowRunModel{DB: db}
+	model := data.ApprovalModel{DB: db}
+
+	workflow := tests.Data.Workflows[1]
+	step := tests.Data.WorkflowActions[3]
+
+	run := data.WorkflowRun{WorkflowId: workflow.Id, NextActionId: sql.NullString{String: step.Id, Valid: true}}
+	assert.NilError(t, runs.Insert(&run))
+
+	expiresAt := time.Now().Add(-time.Minute)
+
+	approval := data.Approval{
+		RunId:            run.Id,
+		WorkflowActionId: sql.NullString{String: step.Id, Valid: true},
+		ExpiresAt:        &expiresAt,
+	}
+	assert.NilError(t, model.Insert(&approval))
+	assert.Equal(t, approval.Expired(time.Now()), true)
+
+	// The timer hasn't fired yet, but users can't decide anymore.
+	approval.Status = data.ApprovalStatusApproved
+	approval.DecidedBy = sql.NullString{String: workflow.UserId, Valid: true}
+	assert.Equal(t, errors.Is(model.Decide(&approval), data.ErrEditConflict), true)
+
+	assert.NilError(t, model.Expire(&approval))
+
+	got, err := model.Get(approval.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Status, data.ApprovalStatusExpired)
+	assert.Equal(t, got.DecidedBy.Valid, false)
+
+	assert.Equal(t, errors.Is(model.Expire(got), data.ErrEditConflict), true)
+}
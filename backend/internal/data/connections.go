@@ -0,0 +1,191 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/luisya22/confluo/backend/internal/validator"
+)
+
+const (
+	ConnectionTypeBasic  = "basic"
+	ConnectionTypeBearer = "bearer"
+	ConnectionTypeApiKey = "apiKey"
+
+	// ConnectionTypeWebhookSecret holds the secret Send Webhook steps sign
+	// their deliveries with.
+	ConnectionTypeWebhookSecret = "webhookSecret"
+)
+
+// Connection holds the credentials stored for an external system. It
+// belongs to a workspace, whose workflows can use it; UserId is the member
+// that created it. Credentials are never serialized back to clients.
+type Connection struct {
+	Id          string            `db:"id" json:"id"`
+	UserId      string            `db:"user_id" json:"userId"`
+	WorkspaceId string            `db:"workspace_id" json:"workspaceId"`
+	Name        string            `db:"name" json:"name"`
+	Type        string            `db:"type" json:"type"`
+	Credentials map[string]string `db:"-" json:"-"`
+	CreatedAt   time.Time         `db:"created_at" json:"-"`
+	UpdatedAt   time.Time         `db:"updated_at" json:"-"`
+	Version     int               `db:"version" json:"version"`
+}
+
+func ValidateConnection(v *validator.Validator, c *Connection) {
+	v.Check(c.Name != "", "name", "must be provided")
+	v.Check(len(c.Name) <= 50, "name", "must not be more than 50 bytes long")
+	v.Check(
+		validator.PermittedValue(c.Type, ConnectionTypeBasic, ConnectionTypeBearer, ConnectionTypeApiKey, ConnectionTypeWebhookSecret),
+		"type",
+		"invalid connection type",
+	)
+
+	switch c.Type {
+	case ConnectionTypeBasic:
+		v.Check(c.Credentials["username"] != "", "credentials.username", "must be provided")
+	case ConnectionTypeBearer:
+		v.Check(c.Credentials["token"] != "", "credentials.token", "must be provided")
+	case ConnectionTypeApiKey:
+		v.Check(c.Credentials["key"] != "", "credentials.key", "must be provided")
+	case ConnectionTypeWebhookSecret:
+		v.Check(c.Credentials["secret"] != "", "credentials.secret", "must be provided")
+	}
+}
+
+type ConnectionModel struct {
+	DB *sqlx.DB
+}
+
+func (model ConnectionModel) Insert(c *Connection) error {
+	if c.UserId == "" {
+		return fmt.Errorf("user id cannot be empty")
+	}
+
+	if c.WorkspaceId == "" {
+		return fmt.Errorf("workspace id cannot be empty")
+	}
+
+	if c.Type == "" {
+		return fmt.Errorf("connection type cannot be empty")
+	}
+
+	credentialsJSON, err := json.Marshal(c.Credentials)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO connections (user_id, workspace_id, name, type, credentials)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return model.DB.QueryRowxContext(ctx, query, c.UserId, c.WorkspaceId, c.Name, c.Type, credentialsJSON).Scan(
+		&c.Id,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.Version,
+	)
+}
+
+func (model ConnectionModel) Get(id string) (*Connection, error) {
+	query := `SELECT id, user_id, workspace_id, name, type, credentials, created_at, updated_at, version
+		FROM connections
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var connection Connection
+	var credentials []uint8
+
+	err := model.DB.QueryRowxContext(ctx, query, id).Scan(
+		&connection.Id,
+		&connection.UserId,
+		&connection.WorkspaceId,
+		&connection.Name,
+		&connection.Type,
+		&credentials,
+		&connection.CreatedAt,
+		&connection.UpdatedAt,
+		&connection.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if credentials != nil {
+		if err := json.Unmarshal(credentials, &connection.Credentials); err != nil {
+			return nil, err
+		}
+	}
+
+	return &connection, nil
+}
+
+func (model ConnectionModel) Update(c *Connection) error {
+	credentialsJSON, err := json.Marshal(c.Credentials)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE connections SET
+			name = $1,
+			type = $2,
+			credentials = $3,
+			updated_at = now(),
+			version = version + 1
+		WHERE id = $4
+		AND version = $5
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = model.DB.QueryRowxContext(ctx, query, c.Name, c.Type, credentialsJSON, c.Id, c.Version).Scan(&c.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (model ConnectionModel) Delete(id string) error {
+	query := `DELETE FROM connections WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := model.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package data_test
+
+import (
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/tests"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+type connectionTestResult struct {
+	connection  data.Connection
+	shouldError bool
+}
+
+func TestConnectionInsert(t *testing.T) {
+	testMap := []struct {
+		name  string
+		data  data.Connection
+		wants connectionTestResult
+	}{
+		{
+			name: "Can Insert",
+			data: data.Connection{
+				UserId:      tests.Data.Users[0].Id,
+				WorkspaceId: tests.Data.Workspaces[0].Id,
+				Name:        "Staging API",
+				Type:        data.ConnectionTypeBasic,
+				Credentials: map[string]string{"username": "bot", "password": "pass"},
+			},
+			wants: connectionTestResult{
+				connection: data.Connection{
+					UserId:      tests.Data.Users[0].Id,
+					WorkspaceId: tests.Data.Workspaces[0].Id,
+					Name:        "Staging API",
+					Type:        data.ConnectionTypeBasic,
+					Credentials: map[string]string{"username": "bot", "password": "pass"},
+				},
+				shouldError: false,
+			},
+		},
+		{
+			name: "Missing UserId Should Error",
+			data: data.Connection{
+				Name: "Staging API",
+				Type: data.ConnectionTypeBasic,
+			},
+			wants: connectionTestResult{
+				shouldError: true,
+			},
+		},
+		{
+			name: "Missing WorkspaceId Should Error",
+			data: data.Connection{
+				UserId: tests.Data.Users[0].Id,
+				Name:   "Staging API",
+				Type:   data.ConnectionTypeBasic,
+			},
+			wants: connectionTestResult{
+				shouldError: true,
+			},
+		},
+		{
+			name: "Missing Type Should Error",
+			data: data.Connection{
+				UserId:      tests.Data.Users[0].Id,
+				WorkspaceId: tests.Data.Workspaces[0].Id,
+				Name:        "Staging API",
+			},
+			wants: connectionTestResult{
+				shouldError: true,
+			},
+		},
+	}
+
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			model := data.ConnectionModel{DB: db}
+
+			err := model.Insert(&tt.data)
+
+			if tt.wants.shouldError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.NotEqual(t, tt.data.Id, "")
+
+			connection, err := model.Get(tt.data.Id)
+
+			assert.NilError(t, err)
+
+			assert.Equal(t, connection.UserId, tt.wants.connection.UserId)
+			assert.Equal(t, connection.Name, tt.wants.connection.Name)
+			assert.Equal(t, connection.Type, tt.wants.connection.Type)
+
+			for k, v := range tt.wants.connection.Credentials {
+				assert.Equal(t, connection.Credentials[k], v)
+			}
+		})
+	}
+}
+
+func TestConnectionGet(t *testing.T) {
+	testMap := []struct {
+		name  string
+		data  string
+		wants connectionTestResult
+	}{
+		{
+			name: "Can Get",
+			data: tests.Data.Connections[0].Id,
+			wants: connectionTestResult{
+				connection:  tests.Data.Connections[0],
+				shouldError: false,
+			},
+		},
+		{
+			name: "Wrong Id Should Error",
+			data: "00000000-0000-0000-0000-000000000000",
+			wants: connectionTestResult{
+				shouldError: true,
+			},
+		},
+	}
+
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			model := data.ConnectionModel{DB: db}
+
+			connection, err := model.Get(tt.data)
+
+			if tt.wants.shouldError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NilError(t, err)
+
+			assert.Equal(t, connection.Id, tt.wants.connection.Id)
+			assert.Equal(t, connection.UserId, tt.wants.connection.UserId)
+			assert.Equal(t, connection.Name, tt.wants.connection.Name)
+			assert.Equal(t, connection.Type, tt.wants.connection.Type)
+			assert.Equal(t, connection.Credentials["token"], tt.wants.connection.Credentials["token"])
+		})
+	}
+}
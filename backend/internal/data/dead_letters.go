@@ -0,0 +1,434 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	DeadLetterStatusPending   = "pending"
+	DeadLetterStatusRequeued  = "requeued"
+	DeadLetterStatusDiscarded = "discarded"
+)
+
+// DeadLetter keeps a run that failed for good together with the context it
+// failed in: the params, the step and provider that failed and the error.
+// Requeuing a dead letter runs it again from the failed step; if it fails
+// again the same entry is pending again. Attempts has every failed attempt
+// of the run, automatic retries included.
+type DeadLetter struct {
+	Id               string                 `db:"id" json:"id"`
+	RunId            string                 `db:"run_id" json:"runId"`
+	WorkflowId       string                 `db:"workflow_id" json:"workflowId"`
+	WorkflowActionId sql.NullString         `db:"workflow_action_id" json:"workflowActionId"`
+	Provider         string                 `db:"provider" json:"provider"`
+	Params           map[string]interface{} `db:"-" json:"params"`
+	Error            string                 `db:"error" json:"error"`
+	Attempts         []DeadLetterAttempt    `db:"-" json:"attempts,omitempty"`
+	AttemptCount     int                    `db:"attempt_count" json:"attemptCount"`
+	Status           string                 `db:"status" json:"status"`
+	CreatedAt        time.Time              `db:"created_at" json:"createdAt"`
+	UpdatedAt        time.Time              `db:"updated_at" json:"updatedAt"`
+	Version          int                    `db:"version" json:"version"`
+}
+
+// DeadLetterAttempt is a single failed attempt of a run: the step it failed
+// on and the error.
+type DeadLetterAttempt struct {
+	Id               string         `db:"id" json:"id"`
+	RunId            string         `db:"run_id" json:"runId"`
+	WorkflowActionId sql.NullString `db:"workflow_action_id" json:"workflowActionId"`
+	Error            string         `db:"error" json:"error"`
+	FailedAt         time.Time      `db:"failed_at" json:"failedAt"`
+}
+
+// DeadLetterDepth counts the pending dead letters per workflow and per
+// provider.
+type DeadLetterDepth struct {
+	Total      int            `json:"total"`
+	ByWorkflow map[string]int `json:"byWorkflow"`
+	ByProvider map[string]int `json:"byProvider"`
+}
+
+type DeadLetterModel struct {
+	DB *sqlx.DB
+}
+
+const deadLetterColumns = `d.id, d.run_id, d.workflow_id, d.workflow_action_id, d.provider, d.params, d.error,
+	(SELECT count(*) FROM dead_letter_attempts a WHERE a.run_id = d.run_id) AS attempt_count,
+	d.status, d.created_at, d.updated_at, d.version`
+
+// Upsert adds the run to the dead letters and records the failure as an
+// attempt. A run that is already there is pending again with the new error.
+func (model DeadLetterModel) Upsert(d *DeadLetter) error {
+	if d.RunId == "" {
+		return fmt.Errorf("run id cannot be empty")
+	}
+
+	paramsJSON, err := json.Marshal(d.Params)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := model.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO dead_letter_attempts (run_id, workflow_action_id, error) VALUES ($1, $2, $3)`
+
+	_, err = tx.ExecContext(ctx, query, d.RunId, d.WorkflowActionId, d.Error)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO dead_letters (run_id, workflow_id, workflow_action_id, provider, params, error)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (run_id) DO UPDATE SET
+			workflow_action_id = EXCLUDED.workflow_action_id,
+			provider = EXCLUDED.provider,
+			params = EXCLUDED.params,
+			error = EXCLUDED.error,
+			status = '` + DeadLetterStatusPending + `',
+			updated_at = now(),
+			version = dead_letters.version + 1
+		RETURNING id, status, created_at, updated_at, version,
+			(SELECT count(*) FROM dead_letter_attempts a WHERE a.run_id = $1)`
+
+	err = tx.QueryRowxContext(
+		ctx,
+		query,
+		d.RunId,
+		d.WorkflowId,
+		d.WorkflowActionId,
+		d.Provider,
+		paramsJSON,
+		d.Error,
+	).Scan(
+		&d.Id,
+		&d.Status,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+		&d.Version,
+		&d.AttemptCount,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InsertAttempt records a failed attempt of a run that is retried instead
+// of dead lettered.
+func (model DeadLetterModel) InsertAttempt(a *DeadLetterAttempt) error {
+	query := `INSERT INTO dead_letter_attempts (run_id, workflow_action_id, error)
+		VALUES ($1, $2, $3)
+		RETURNING id, failed_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return model.DB.QueryRowxContext(ctx, query, a.RunId, a.WorkflowActionId, a.Error).Scan(&a.Id, &a.FailedAt)
+}
+
+// GetAttempts lists the failed attempts of a run, oldest first.
+func (model DeadLetterModel) GetAttempts(runId string) ([]DeadLetterAttempt, error) {
+	query := `SELECT id, run_id, workflow_action_id, error, failed_at
+		FROM dead_letter_attempts
+		WHERE run_id = $1
+		ORDER BY failed_at, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	attempts := []DeadLetterAttempt{}
+
+	err := model.DB.SelectContext(ctx, &attempts, query, runId)
+	if err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+// Get returns the dead letter together with its attempts.
+func (model DeadLetterModel) Get(id string) (*DeadLetter, error) {
+	query := `SELECT ` + deadLetterColumns + ` FROM dead_letters d WHERE d.id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	d, err := scanDeadLetter(model.DB.QueryRowxContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	d.Attempts, err = model.GetAttempts(d.RunId)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// GetAllForUser lists the dead letters of the workflows in the user's
+// workspaces, newest first. Empty workflowId, provider or status don't filter.
+func (model DeadLetterModel) GetAllForUser(userId, workflowId, provider, status string, filters Filters) ([]*DeadLetter, Metadata, error) {
+	query := `SELECT count(*) OVER(), ` + deadLetterColumns + `
+		FROM dead_letters d
+		INNER JOIN workflows w ON d.workflow_id = w.id
+		WHERE w.workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1)
+		AND (d.workflow_id::text = $2 OR $2 = '')
+		AND (d.provider = $3 OR $3 = '')
+		AND (d.status = $4 OR $4 = '')
+		ORDER BY d.updated_at DESC, d.id
+		LIMIT $5 OFFSET $6`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryxContext(ctx, query, userId, workflowId, provider, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	deadLetters := []*DeadLetter{}
+
+	for rows.Next() {
+		var d DeadLetter
+		var params []uint8
+
+		err := rows.Scan(
+			&totalRecords,
+			&d.Id,
+			&d.RunId,
+			&d.WorkflowId,
+			&d.WorkflowActionId,
+			&d.Provider,
+			&params,
+			&d.Error,
+			&d.AttemptCount,
+			&d.Status,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+			&d.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		if params != nil {
+			if err := json.Unmarshal(params, &d.Params); err != nil {
+				return nil, Metadata{}, err
+			}
+		}
+
+		deadLetters = append(deadLetters, &d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return deadLetters, metadata, nil
+}
+
+// SetStatus moves a pending dead letter to status. It returns
+// ErrEditConflict when the entry isn't pending or has changed since it was
+// read.
+func (model DeadLetterModel) SetStatus(d *DeadLetter, status string) error {
+	query := `UPDATE dead_letters SET
+			status = $1,
+			updated_at = now(),
+			version = version + 1
+		WHERE id = $2
+		AND version = $3
+		AND status = '` + DeadLetterStatusPending + `'
+		RETURNING status, updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := model.DB.QueryRowxContext(ctx, query, status, d.Id, d.Version).Scan(&d.Status, &d.UpdatedAt, &d.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Requeue queues the failed run of a pending dead letter again and marks
+// the dead letter as requeued, both or neither. It returns ErrEditConflict
+// when the dead letter isn't pending or has changed since it was read, and
+// ErrRunNotFailed when the run isn't failed anymore.
+func (model DeadLetterModel) Requeue(d *DeadLetter) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := model.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE dead_letters SET
+			status = '` + DeadLetterStatusRequeued + `',
+			updated_at = now(),
+			version = version + 1
+		WHERE id = $1
+		AND version = $2
+		AND status = '` + DeadLetterStatusPending + `'
+		RETURNING status, updated_at, version`
+
+	var requeued DeadLetter
+
+	err = tx.QueryRowxContext(ctx, query, d.Id, d.Version).Scan(&requeued.Status, &requeued.UpdatedAt, &requeued.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = requeueRun(ctx, tx, d.RunId)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	d.Status, d.UpdatedAt, d.Version = requeued.Status, requeued.UpdatedAt, requeued.Version
+
+	return nil
+}
+
+// Depth counts the pending dead letters of the workflows in the user's
+// workspaces. An empty userId counts them for every workspace.
+func (model DeadLetterModel) Depth(userId string) (*DeadLetterDepth, error) {
+	query := `SELECT d.workflow_id, d.provider, count(*)
+		FROM dead_letters d
+		INNER JOIN workflows w ON d.workflow_id = w.id
+		WHERE d.status = '` + DeadLetterStatusPending + `'
+		AND ($1 = '' OR w.workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id::text = $1))
+		GROUP BY d.workflow_id, d.provider`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryxContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	depth := &DeadLetterDepth{
+		ByWorkflow: make(map[string]int),
+		ByProvider: make(map[string]int),
+	}
+
+	for rows.Next() {
+		var workflowId, provider string
+		var count int
+
+		if err := rows.Scan(&workflowId, &provider, &count); err != nil {
+			return nil, err
+		}
+
+		depth.Total += count
+		depth.ByWorkflow[workflowId] += count
+		depth.ByProvider[provider] += count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return depth, nil
+}
+
+// GetWorkspaceId returns the id of the workspace whose workflow the dead
+// letter belongs to.
+func (model DeadLetterModel) GetWorkspaceId(id string) (string, error) {
+	query := `SELECT w.workspace_id
+		FROM dead_letters d
+		INNER JOIN workflows w ON d.workflow_id = w.id
+		WHERE d.id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var workspaceId string
+
+	err := model.DB.QueryRowxContext(ctx, query, id).Scan(&workspaceId)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return workspaceId, nil
+}
+
+func scanDeadLetter(row rowScanner) (*DeadLetter, error) {
+	var d DeadLetter
+	var params []uint8
+
+	err := row.Scan(
+		&d.Id,
+		&d.RunId,
+		&d.WorkflowId,
+		&d.WorkflowActionId,
+		&d.Provider,
+		&params,
+		&d.Error,
+		&d.AttemptCount,
+		&d.Status,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+		&d.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if params != nil {
+		if err := json.Unmarshal(params, &d.Params); err != nil {
+			return nil, err
+		}
+	}
+
+	return &d, nil
+}
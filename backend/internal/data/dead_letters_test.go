@@ -0,0 +1,156 @@
+package data_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/tests"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestDeadLetterUpsert(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.DeadLetterModel{DB: db}
+	runs := data.WorkflowRunModel{DB: db}
+
+	workflow := tests.Data.Workflows[0]
+	step := tests.Data.WorkflowActions[0]
+
+	run := data.WorkflowRun{WorkflowId: workflow.Id}
+	assert.NilError(t, runs.Insert(&run))
+
+	d := data.DeadLetter{
+		RunId:            run.Id,
+		WorkflowId:       workflow.Id,
+		WorkflowActionId: step.NextActionId,
+		Provider:         "Github",
+		Params:           map[string]interface{}{"issueTitle": "Broken build"},
+		Error:            "502 Bad Gateway",
+	}
+	assert.NilError(t, model.Upsert(&d))
+	assert.Equal(t, d.AttemptCount, 1)
+	assert.Equal(t, d.Status, data.DeadLetterStatusPending)
+
+	assert.NilError(t, model.SetStatus(&d, data.DeadLetterStatusRequeued))
+	assert.Equal(t, model.SetStatus(&d, data.DeadLetterStatusDiscarded), data.ErrEditConflict)
+
+	again := data.DeadLetter{
+		RunId:      run.Id,
+		WorkflowId: workflow.Id,
+		Provider:   "Github",
+		Error:      "504 Gateway Timeout",
+	}
+	assert.NilError(t, model.Upsert(&again))
+	assert.Equal(t, again.Id, d.Id)
+	assert.Equal(t, again.AttemptCount, 2)
+	assert.Equal(t, again.Status, data.DeadLetterStatusPending)
+
+	got, err := model.Get(d.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Error, "504 Gateway Timeout")
+	assert.Equal(t, got.AttemptCount, 2)
+	assert.Equal(t, len(got.Attempts), 2)
+	assert.Equal(t, got.Attempts[0].Error, "502 Bad Gateway")
+	assert.Equal(t, got.Attempts[0].WorkflowActionId, step.NextActionId)
+	assert.Equal(t, got.Attempts[1].Error, "504 Gateway Timeout")
+
+	workspaceId, err := model.GetWorkspaceId(d.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, workspaceId, workflow.WorkspaceId)
+
+	depth, err := model.Depth(workflow.UserId)
+	assert.NilError(t, err)
+	assert.Equal(t, depth.Total, 1)
+	assert.Equal(t, depth.ByWorkflow[workflow.Id], 1)
+	assert.Equal(t, depth.ByProvider["Github"], 1)
+
+	filters := data.Filters{Page: 1, PageSize: 20, Sort: "-updated_at", SortSafeList: []string{"-updated_at"}}
+
+	deadLetters, _, err := model.GetAllForUser(workflow.UserId, "", "Github", data.DeadLetterStatusPending, filters)
+	assert.NilError(t, err)
+	assert.Equal(t, len(deadLetters), 1)
+
+	deadLetters, _, err = model.GetAllForUser(workflow.UserId, "", "HTTP", "", filters)
+	assert.NilError(t, err)
+	assert.Equal(t, len(deadLetters), 0)
+}
+
+func TestDeadLetterAttempts(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.DeadLetterModel{DB: db}
+	runs := data.WorkflowRunModel{DB: db}
+
+	workflow := tests.Data.Workflows[0]
+
+	run := data.WorkflowRun{WorkflowId: workflow.Id}
+	assert.NilError(t, runs.Insert(&run))
+
+	// Retries are recorded before the run is dead lettered.
+	for _, message := range []string{"timeout", "connection reset"} {
+		attempt := data.DeadLetterAttempt{RunId: run.Id, Error: message}
+		assert.NilError(t, model.InsertAttempt(&attempt))
+		assert.NotEqual(t, attempt.Id, "")
+	}
+
+	d := data.DeadLetter{RunId: run.Id, WorkflowId: workflow.Id, Error: "502 Bad Gateway"}
+	assert.NilError(t, model.Upsert(&d))
+	assert.Equal(t, d.AttemptCount, 3)
+
+	attempts, err := model.GetAttempts(run.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(attempts), 3)
+	assert.Equal(t, attempts[0].Error, "timeout")
+	assert.Equal(t, attempts[2].Error, "502 Bad Gateway")
+
+	filters := data.Filters{Page: 1, PageSize: 20, Sort: "-updated_at", SortSafeList: []string{"-updated_at"}}
+
+	deadLetters, _, err := model.GetAllForUser(workflow.UserId, workflow.Id, "", "", filters)
+	assert.NilError(t, err)
+	assert.Equal(t, len(deadLetters), 1)
+	assert.Equal(t, deadLetters[0].AttemptCount, 3)
+}
+
+func TestDeadLetterRequeue(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.DeadLetterModel{DB: db}
+	runs := data.WorkflowRunModel{DB: db}
+
+	workflow := tests.Data.Workflows[0]
+
+	run := data.WorkflowRun{WorkflowId: workflow.Id}
+	assert.NilError(t, runs.Insert(&run))
+
+	d := data.DeadLetter{RunId: run.Id, WorkflowId: workflow.Id, Error: "502 Bad Gateway"}
+	assert.NilError(t, model.Upsert(&d))
+
+	// The run is still queued, so nothing changes.
+	assert.Equal(t, errors.Is(model.Requeue(&d), data.ErrRunNotFailed), true)
+
+	got, err := model.Get(d.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Status, data.DeadLetterStatusPending)
+	assert.Equal(t, got.Version, d.Version)
+
+	run.Status = data.RunStatusFailed
+	run.Error = "502 Bad Gateway"
+	run.Retries = 3
+	assert.NilError(t, runs.Update(&run))
+
+	assert.NilError(t, model.Requeue(got))
+	assert.Equal(t, got.Status, data.DeadLetterStatusRequeued)
+
+	requeued, err := runs.Get(run.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, requeued.Status, data.RunStatusQueued)
+	assert.Equal(t, requeued.Error, "")
+	assert.Equal(t, requeued.Retries, 0)
+
+	assert.Equal(t, errors.Is(model.Requeue(got), data.ErrEditConflict), true)
+}
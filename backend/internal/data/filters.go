@@ -1,6 +1,8 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"math"
 	"strings"
@@ -10,19 +12,57 @@ import (
 
 var UnsafeSort = errors.New("unsafe sort parameter")
 
+// Filters pages and sorts a list. A list is paged either by Page or, when
+// Cursor is set, from the record after the one the cursor points to.
 type Filters struct {
 	Page         int
 	PageSize     int
 	Sort         string
 	SortSafeList []string
+	Cursor       string
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+}
+
+// cursor points to the last record of a page: the sort value and the id of
+// the record, and the sort the page was listed with.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	Id    string `json:"i"`
+}
+
+func encodeCursor(c cursor) string {
+	js, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+
+	err = json.Unmarshal(js, &c)
+	if err != nil {
+		return c, err
+	}
+
+	if c.Id == "" {
+		return c, errors.New("cursor has no id")
+	}
+
+	return c, nil
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -32,6 +72,13 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		v.Check(err == nil, "cursor", "must be a valid cursor")
+		v.Check(err != nil || c.Sort == f.Sort, "cursor", "must come from a list with the same sort")
+		v.Check(f.Page == 1, "page", "cannot be used with a cursor")
+	}
 }
 
 func (f Filters) sortColumn() (string, error) {
@@ -73,3 +120,17 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 		TotalRecords: totalRecords,
 	}
 }
+
+// calculateCursorMetadata returns the metadata of a page listed from a
+// cursor, which has no page number.
+func calculateCursorMetadata(totalRecords, pageSize int, nextCursor string) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		PageSize:     pageSize,
+		TotalRecords: totalRecords,
+		NextCursor:   nextCursor,
+	}
+}
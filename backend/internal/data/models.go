@@ -12,18 +12,40 @@ var (
 )
 
 type Models struct {
-	Workflows       WorkflowModel
-	WorkflowActions WorkFlowActionModel
-	Actions         ActionModel
-	Providers       ProviderModel
+	Workflows         WorkflowModel
+	WorkflowActions   WorkFlowActionModel
+	Actions           ActionModel
+	Providers         ProviderModel
+	Connections       ConnectionModel
+	Users             UserModel
+	Tokens            TokenModel
+	WebhookDeliveries WebhookDeliveryModel
+	Runs              WorkflowRunModel
+	RunSteps          RunStepModel
+	Approvals         ApprovalModel
+	TriggerEvents     TriggerEventModel
+	DeadLetters       DeadLetterModel
+	Search            SearchModel
+	Workspaces        WorkspaceModel
 }
 
 func NewModels(db *sqlx.DB) Models {
 
 	return Models{
-		Workflows:       WorkflowModel{DB: db},
-		WorkflowActions: WorkFlowActionModel{DB: db},
-		Actions:         ActionModel{DB: db},
-		Providers:       ProviderModel{DB: db},
+		Workflows:         WorkflowModel{DB: db},
+		WorkflowActions:   WorkFlowActionModel{DB: db},
+		Actions:           ActionModel{DB: db},
+		Providers:         ProviderModel{DB: db},
+		Connections:       ConnectionModel{DB: db},
+		Users:             UserModel{DB: db},
+		Tokens:            TokenModel{DB: db},
+		WebhookDeliveries: WebhookDeliveryModel{DB: db},
+		Runs:              WorkflowRunModel{DB: db},
+		RunSteps:          RunStepModel{DB: db},
+		Approvals:         ApprovalModel{DB: db},
+		TriggerEvents:     TriggerEventModel{DB: db},
+		DeadLetters:       DeadLetterModel{DB: db},
+		Search:            SearchModel{DB: db},
+		Workspaces:        WorkspaceModel{DB: db},
 	}
 }
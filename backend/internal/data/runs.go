@@ -0,0 +1,706 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	RunStatusQueued    = "queued"
+	RunStatusRunning   = "running"
+	RunStatusWaiting   = "waiting"
+	RunStatusSucceeded = "succeeded"
+	RunStatusFailed    = "failed"
+	RunStatusCancelled = "cancelled"
+)
+
+// WorkflowRun is one execution of a workflow. Params is the context passed
+// from step to step and NextActionId points to the step that runs next.
+// Waiting runs are queued again once ResumeAt has passed. Runs started by a
+// Call Workflow step point to the run that called them, and Depth counts the
+// calls between them and the outermost run. Runs started by a re-run point
+// to the run they replay. TraceContext carries the trace of whatever queued
+// the run, so the worker that executes it can link back to it. A running
+// run is leased to the worker executing it until LockedUntil; Recoveries
+// counts the times it was taken back from a worker whose lease expired.
+// Retries counts the times it was retried after a step failed.
+type WorkflowRun struct {
+	Id            string                 `db:"id" json:"id"`
+	WorkflowId    string                 `db:"workflow_id" json:"workflowId"`
+	ParentRunId   sql.NullString         `db:"parent_run_id" json:"parentRunId"`
+	Depth         int                    `db:"depth" json:"depth"`
+	ReplayOfRunId sql.NullString         `db:"replay_of_run_id" json:"replayOfRunId"`
+	Status        string                 `db:"status" json:"status"`
+	Params        map[string]interface{} `db:"-" json:"params"`
+	NextActionId  sql.NullString         `db:"next_action_id" json:"nextActionId"`
+	Error         string                 `db:"error" json:"error,omitempty"`
+	ResumeAt      *time.Time             `db:"resume_at" json:"resumeAt"`
+	StartedAt     *time.Time             `db:"started_at" json:"startedAt"`
+	FinishedAt    *time.Time             `db:"finished_at" json:"finishedAt"`
+	CreatedAt     time.Time              `db:"created_at" json:"createdAt"`
+	UpdatedAt     time.Time              `db:"updated_at" json:"updatedAt"`
+	Version       int                    `db:"version" json:"version"`
+	TraceContext  map[string]string      `db:"-" json:"-"`
+	LockedUntil   *time.Time             `db:"locked_until" json:"-"`
+	Recoveries    int                    `db:"recoveries" json:"recoveries"`
+	Retries       int                    `db:"retries" json:"retries"`
+}
+
+// Finished reports whether the run is done and won't execute again.
+func (r *WorkflowRun) Finished() bool {
+	switch r.Status {
+	case RunStatusSucceeded, RunStatusFailed, RunStatusCancelled:
+		return true
+	}
+
+	return false
+}
+
+// RunStep records the input and output of a single step of a run.
+type RunStep struct {
+	Id               string                 `db:"id" json:"id"`
+	RunId            string                 `db:"run_id" json:"runId"`
+	WorkflowActionId sql.NullString         `db:"workflow_action_id" json:"workflowActionId"`
+	Status           string                 `db:"status" json:"status"`
+	Input            map[string]interface{} `db:"-" json:"input"`
+	Output           map[string]interface{} `db:"-" json:"output"`
+	Error            string                 `db:"error" json:"error,omitempty"`
+	StartedAt        time.Time              `db:"started_at" json:"startedAt"`
+	FinishedAt       time.Time              `db:"finished_at" json:"finishedAt"`
+}
+
+type WorkflowRunModel struct {
+	DB *sqlx.DB
+}
+
+const runColumns = `id, workflow_id, parent_run_id, depth, replay_of_run_id, status, params, next_action_id, error, resume_at,
+	started_at, finished_at, created_at, updated_at, version, trace_context, locked_until, recoveries, retries`
+
+func (model WorkflowRunModel) Insert(run *WorkflowRun) error {
+	if run.WorkflowId == "" {
+		return fmt.Errorf("workflow id cannot be empty")
+	}
+
+	if run.Status == "" {
+		run.Status = RunStatusQueued
+	}
+
+	paramsJSON, err := json.Marshal(run.Params)
+	if err != nil {
+		return err
+	}
+
+	var traceJSON []byte
+	if len(run.TraceContext) > 0 {
+		traceJSON, err = json.Marshal(run.TraceContext)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `INSERT INTO workflow_runs (workflow_id, parent_run_id, depth, replay_of_run_id, status, params, next_action_id,
+			trace_context)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return model.DB.QueryRowxContext(
+		ctx,
+		query,
+		run.WorkflowId,
+		run.ParentRunId,
+		run.Depth,
+		run.ReplayOfRunId,
+		run.Status,
+		paramsJSON,
+		run.NextActionId,
+		traceJSON,
+	).Scan(
+		&run.Id,
+		&run.CreatedAt,
+		&run.UpdatedAt,
+		&run.Version,
+	)
+}
+
+func (model WorkflowRunModel) Get(id string) (*WorkflowRun, error) {
+	query := `SELECT ` + runColumns + ` FROM workflow_runs WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	run, err := scanRun(model.DB.QueryRowxContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return run, nil
+}
+
+// GetChildren returns the runs started by Call Workflow steps of the run.
+func (model WorkflowRunModel) GetChildren(parentRunId string) ([]*WorkflowRun, error) {
+	query := `SELECT ` + runColumns + ` FROM workflow_runs WHERE parent_run_id = $1 ORDER BY created_at, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryxContext(ctx, query, parentRunId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*WorkflowRun{}
+
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, run)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// GetFailed returns the failed runs of the workflow that finished between
+// since and until and haven't been re-run yet, oldest first.
+func (model WorkflowRunModel) GetFailed(workflowId string, since, until time.Time, limit int) ([]*WorkflowRun, error) {
+	query := `SELECT ` + runColumns + ` FROM workflow_runs r
+		WHERE workflow_id = $1
+		AND status = '` + RunStatusFailed + `'
+		AND finished_at >= $2
+		AND finished_at < $3
+		AND NOT EXISTS (SELECT 1 FROM workflow_runs replay WHERE replay.replay_of_run_id = r.id)
+		ORDER BY finished_at, id
+		LIMIT $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryxContext(ctx, query, workflowId, since, until, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*WorkflowRun{}
+
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, run)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// ClaimNext marks the oldest queued run as running, leased to the caller
+// for lease, and returns it. Rows locked by other workers are skipped so
+// every run is claimed once.
+func (model WorkflowRunModel) ClaimNext(lease time.Duration) (*WorkflowRun, error) {
+	query := `UPDATE workflow_runs SET
+			status = '` + RunStatusRunning + `',
+			locked_until = now() + make_interval(secs => $1),
+			started_at = COALESCE(started_at, now()),
+			updated_at = now(),
+			version = version + 1
+		WHERE id = (
+			SELECT id FROM workflow_runs
+			WHERE status = '` + RunStatusQueued + `'
+			ORDER BY created_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING ` + runColumns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	run, err := scanRun(model.DB.QueryRowxContext(ctx, query, lease.Seconds()))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return run, nil
+}
+
+// Heartbeat extends the lease of a running run by lease from now. The
+// version is left alone so the worker can keep saving the run. It returns
+// ErrEditConflict when the run isn't running anymore.
+func (model WorkflowRunModel) Heartbeat(id string, lease time.Duration) error {
+	query := `UPDATE workflow_runs SET
+			locked_until = now() + make_interval(secs => $2)
+		WHERE id = $1
+		AND status = '` + RunStatusRunning + `'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := model.DB.ExecContext(ctx, query, id, lease.Seconds())
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// RequeueExpired queues the running runs whose lease expired, because the
+// worker executing them died, so they continue from the step they were on.
+// Runs that were already taken back maxRecoveries times are left for
+// GetExpired.
+func (model WorkflowRunModel) RequeueExpired(maxRecoveries int) (int64, error) {
+	query := `UPDATE workflow_runs SET
+			status = '` + RunStatusQueued + `',
+			locked_until = NULL,
+			recoveries = recoveries + 1,
+			updated_at = now(),
+			version = version + 1
+		WHERE status = '` + RunStatusRunning + `'
+		AND locked_until < now()
+		AND recoveries < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := model.DB.ExecContext(ctx, query, maxRecoveries)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetExpired returns the running runs whose lease expired after they were
+// taken back maxRecoveries times, which are failed instead of queued again.
+func (model WorkflowRunModel) GetExpired(maxRecoveries int) ([]*WorkflowRun, error) {
+	query := `SELECT ` + runColumns + ` FROM workflow_runs
+		WHERE status = '` + RunStatusRunning + `'
+		AND locked_until < now()
+		AND recoveries >= $1
+		ORDER BY locked_until, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryxContext(ctx, query, maxRecoveries)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*WorkflowRun{}
+
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, run)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// Update saves the run. The lease is kept while the run is running and
+// dropped once it stops.
+func (model WorkflowRunModel) Update(run *WorkflowRun) error {
+	paramsJSON, err := json.Marshal(run.Params)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE workflow_runs SET
+			status = $1,
+			params = $2,
+			next_action_id = $3,
+			error = $4,
+			resume_at = $5,
+			finished_at = $6,
+			retries = $7,
+			locked_until = CASE WHEN $1 = '` + RunStatusRunning + `' THEN locked_until END,
+			updated_at = now(),
+			version = version + 1
+		WHERE id = $8
+		AND version = $9
+		RETURNING updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = model.DB.QueryRowxContext(
+		ctx,
+		query,
+		run.Status,
+		paramsJSON,
+		run.NextActionId,
+		run.Error,
+		run.ResumeAt,
+		run.FinishedAt,
+		run.Retries,
+		run.Id,
+		run.Version,
+	).Scan(&run.UpdatedAt, &run.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// QueueDue queues the waiting runs whose timer has expired and those whose
+// approval has been decided. The latter catches decisions made before the
+// run was saved as waiting, which the Resume after the decision misses.
+func (model WorkflowRunModel) QueueDue() (int64, error) {
+	query := `UPDATE workflow_runs SET
+			status = '` + RunStatusQueued + `',
+			resume_at = NULL,
+			updated_at = now(),
+			version = version + 1
+		WHERE status = '` + RunStatusWaiting + `'
+		AND (resume_at <= now() OR EXISTS (
+			SELECT 1 FROM approvals
+			WHERE approvals.run_id = workflow_runs.id
+			AND approvals.id::text = workflow_runs.params->>'` + ParamPendingApproval + `'
+			AND approvals.status <> '` + ApprovalStatusPending + `'
+		))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := model.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// QueueStats counts the runs that haven't finished per status. Lag is how
+// long the oldest queued run has waited for a worker or the most overdue
+// waiting run for its timer, whichever is longer.
+type QueueStats struct {
+	Runs map[string]int
+	Lag  time.Duration
+}
+
+func (model WorkflowRunModel) QueueStats() (*QueueStats, error) {
+	query := `SELECT
+			count(*) FILTER (WHERE status = '` + RunStatusQueued + `'),
+			count(*) FILTER (WHERE status = '` + RunStatusRunning + `'),
+			count(*) FILTER (WHERE status = '` + RunStatusWaiting + `'),
+			COALESCE(EXTRACT(EPOCH FROM GREATEST(
+				now() - min(updated_at) FILTER (WHERE status = '` + RunStatusQueued + `'),
+				now() - min(resume_at) FILTER (WHERE status = '` + RunStatusWaiting + `' AND resume_at <= now())
+			)), 0)
+		FROM workflow_runs
+		WHERE status IN ('` + RunStatusQueued + `', '` + RunStatusRunning + `', '` + RunStatusWaiting + `')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var queued, running, waiting int
+	var lagSeconds float64
+
+	err := model.DB.QueryRowxContext(ctx, query).Scan(&queued, &running, &waiting, &lagSeconds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QueueStats{
+		Runs: map[string]int{
+			RunStatusQueued:  queued,
+			RunStatusRunning: running,
+			RunStatusWaiting: waiting,
+		},
+		Lag: time.Duration(lagSeconds * float64(time.Second)),
+	}, nil
+}
+
+// Resume queues a waiting run without waiting for its timer. It returns
+// ErrEditConflict when the run isn't waiting.
+func (model WorkflowRunModel) Resume(id string) error {
+	query := `UPDATE workflow_runs SET
+			status = '` + RunStatusQueued + `',
+			resume_at = NULL,
+			updated_at = now(),
+			version = version + 1
+		WHERE id = $1
+		AND status = '` + RunStatusWaiting + `'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := model.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// ErrRunNotFailed is returned when requeuing a run that isn't failed.
+var ErrRunNotFailed = errors.New("the run is no longer failed")
+
+// requeueRun queues a failed run again to continue from the step it failed
+// on. Its retries start over.
+func requeueRun(ctx context.Context, db sqlx.ExecerContext, id string) error {
+	query := `UPDATE workflow_runs SET
+			status = '` + RunStatusQueued + `',
+			error = '',
+			retries = 0,
+			finished_at = NULL,
+			updated_at = now(),
+			version = version + 1
+		WHERE id = $1
+		AND status = '` + RunStatusFailed + `'`
+
+	result, err := db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRunNotFailed
+	}
+
+	return nil
+}
+
+// Cancel stops a run that hasn't finished, dropping any pending timer. A
+// worker executing the run notices on its next save.
+func (model WorkflowRunModel) Cancel(id string) error {
+	query := `UPDATE workflow_runs SET
+			status = '` + RunStatusCancelled + `',
+			resume_at = NULL,
+			locked_until = NULL,
+			finished_at = now(),
+			updated_at = now(),
+			version = version + 1
+		WHERE id = $1
+		AND status IN ('` + RunStatusQueued + `', '` + RunStatusRunning + `', '` + RunStatusWaiting + `')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := model.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+func scanRun(row rowScanner) (*WorkflowRun, error) {
+	var run WorkflowRun
+	var params, traceContext []uint8
+
+	err := row.Scan(
+		&run.Id,
+		&run.WorkflowId,
+		&run.ParentRunId,
+		&run.Depth,
+		&run.ReplayOfRunId,
+		&run.Status,
+		&params,
+		&run.NextActionId,
+		&run.Error,
+		&run.ResumeAt,
+		&run.StartedAt,
+		&run.FinishedAt,
+		&run.CreatedAt,
+		&run.UpdatedAt,
+		&run.Version,
+		&traceContext,
+		&run.LockedUntil,
+		&run.Recoveries,
+		&run.Retries,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if params != nil {
+		if err := json.Unmarshal(params, &run.Params); err != nil {
+			return nil, err
+		}
+	}
+
+	if traceContext != nil {
+		if err := json.Unmarshal(traceContext, &run.TraceContext); err != nil {
+			return nil, err
+		}
+	}
+
+	return &run, nil
+}
+
+type RunStepModel struct {
+	DB *sqlx.DB
+}
+
+func (model RunStepModel) Insert(step *RunStep) error {
+	if step.RunId == "" {
+		return fmt.Errorf("run id cannot be empty")
+	}
+
+	inputJSON, err := json.Marshal(step.Input)
+	if err != nil {
+		return err
+	}
+
+	outputJSON, err := json.Marshal(step.Output)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO run_steps (run_id, workflow_action_id, status, input, output, error, started_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return model.DB.QueryRowxContext(
+		ctx,
+		query,
+		step.RunId,
+		step.WorkflowActionId,
+		step.Status,
+		inputJSON,
+		outputJSON,
+		step.Error,
+		step.StartedAt,
+		step.FinishedAt,
+	).Scan(&step.Id)
+}
+
+func (model RunStepModel) GetAllForRun(runId string) ([]*RunStep, error) {
+	query := `SELECT id, run_id, workflow_action_id, status, input, output, error, started_at, finished_at
+		FROM run_steps
+		WHERE run_id = $1
+		ORDER BY started_at, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryxContext(ctx, query, runId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	steps := []*RunStep{}
+
+	for rows.Next() {
+		var step RunStep
+		var input, output []uint8
+
+		err := rows.Scan(
+			&step.Id,
+			&step.RunId,
+			&step.WorkflowActionId,
+			&step.Status,
+			&input,
+			&output,
+			&step.Error,
+			&step.StartedAt,
+			&step.FinishedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if input != nil {
+			if err := json.Unmarshal(input, &step.Input); err != nil {
+				return nil, err
+			}
+		}
+
+		if output != nil {
+			if err := json.Unmarshal(output, &step.Output); err != nil {
+				return nil, err
+			}
+		}
+
+		steps = append(steps, &step)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return steps, nil
+}
@@ -0,0 +1,383 @@
+package data_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/tests"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+type runTestResult struct {
+	run         data.WorkflowRun
+	shouldError bool
+}
+
+func TestRunInsert(t *testing.T) {
+	testMap := []struct {
+		name  string
+		data  data.WorkflowRun
+		wants runTestResult
+	}{
+		{
+			name: "Can Insert",
+			data: data.WorkflowRun{
+				WorkflowId:   tests.Data.Workflows[0].Id,
+				Params:       map[string]interface{}{"scheduledTime": "2024-05-01T09:00:00Z"},
+				NextActionId: tests.Data.WorkflowActions[0].NextActionId,
+			},
+			wants: runTestResult{
+				run: data.WorkflowRun{
+					WorkflowId:   tests.Data.Workflows[0].Id,
+					Status:       data.RunStatusQueued,
+					NextActionId: tests.Data.WorkflowActions[0].NextActionId,
+				},
+				shouldError: false,
+			},
+		},
+		{
+			name: "Missing WorkflowId Should Error",
+			data: data.WorkflowRun{},
+			wants: runTestResult{
+				shouldError: true,
+			},
+		},
+	}
+
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			model := data.WorkflowRunModel{DB: db}
+
+			err := model.Insert(&tt.data)
+
+			if tt.wants.shouldError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.NotEqual(t, tt.data.Id, "")
+
+			run, err := model.Get(tt.data.Id)
+
+			assert.NilError(t, err)
+
+			assert.Equal(t, run.WorkflowId, tt.wants.run.WorkflowId)
+			assert.Equal(t, run.Status, tt.wants.run.Status)
+			assert.Equal(t, run.NextActionId, tt.wants.run.NextActionId)
+			assert.Equal(t, run.Params["scheduledTime"], tt.data.Params["scheduledTime"])
+		})
+	}
+}
+
+func TestRunClaimNext(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.WorkflowRunModel{DB: db}
+
+	run := data.WorkflowRun{
+		WorkflowId:   tests.Data.Workflows[0].Id,
+		NextActionId: tests.Data.WorkflowActions[0].NextActionId,
+	}
+
+	err := model.Insert(&run)
+	assert.NilError(t, err)
+
+	claimed, err := model.ClaimNext(time.Minute)
+	assert.NilError(t, err)
+
+	assert.Equal(t, claimed.Id, run.Id)
+	assert.Equal(t, claimed.Status, data.RunStatusRunning)
+	assert.NotEqual(t, claimed.StartedAt, nil)
+
+	_, err = model.ClaimNext(time.Minute)
+	assert.Equal(t, errors.Is(err, data.ErrRecordNotFound), true)
+
+	finishedAt := time.Now()
+	claimed.Status = data.RunStatusSucceeded
+	claimed.FinishedAt = &finishedAt
+
+	err = model.Update(claimed)
+	assert.NilError(t, err)
+
+	got, err := model.Get(run.Id)
+	assert.NilError(t, err)
+
+	assert.Equal(t, got.Status, data.RunStatusSucceeded)
+	assert.NotEqual(t, got.FinishedAt, nil)
+}
+
+func TestRunLease(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.WorkflowRunModel{DB: db}
+
+	run := data.WorkflowRun{WorkflowId: tests.Data.Workflows[0].Id}
+	assert.NilError(t, model.Insert(&run))
+
+	// A negative lease stands in for a worker that died a minute ago.
+	claimed, err := model.ClaimNext(-time.Minute)
+	assert.NilError(t, err)
+	assert.NotEqual(t, claimed.LockedUntil, nil)
+
+	n, err := model.RequeueExpired(1)
+	assert.NilError(t, err)
+	assert.Equal(t, n, int64(1))
+
+	got, err := model.Get(run.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Status, data.RunStatusQueued)
+	assert.Equal(t, got.Recoveries, 1)
+
+	claimed, err = model.ClaimNext(-time.Minute)
+	assert.NilError(t, err)
+
+	n, err = model.RequeueExpired(1)
+	assert.NilError(t, err)
+	assert.Equal(t, n, int64(0))
+
+	expired, err := model.GetExpired(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(expired), 1)
+	assert.Equal(t, expired[0].Id, run.Id)
+
+	assert.NilError(t, model.Heartbeat(run.Id, time.Minute))
+
+	expired, err = model.GetExpired(1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(expired), 0)
+
+	claimed, err = model.Get(run.Id)
+	assert.NilError(t, err)
+
+	finishedAt := time.Now()
+	claimed.Status = data.RunStatusSucceeded
+	claimed.FinishedAt = &finishedAt
+	assert.NilError(t, model.Update(claimed))
+
+	got, err = model.Get(run.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, got.LockedUntil == nil, true)
+
+	err = model.Heartbeat(run.Id, time.Minute)
+	assert.Equal(t, errors.Is(err, data.ErrEditConflict), true)
+}
+
+func TestRunTimers(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.WorkflowRunModel{DB: db}
+
+	due := data.WorkflowRun{WorkflowId: tests.Data.Workflows[0].Id}
+	later := data.WorkflowRun{WorkflowId: tests.Data.Workflows[0].Id}
+
+	for _, run := range []*data.WorkflowRun{&due, &later} {
+		err := model.Insert(run)
+		assert.NilError(t, err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	due.Status = data.RunStatusWaiting
+	due.ResumeAt = &past
+	assert.NilError(t, model.Update(&due))
+
+	later.Status = data.RunStatusWaiting
+	later.ResumeAt = &future
+	assert.NilError(t, model.Update(&later))
+
+	n, err := model.QueueDue()
+	assert.NilError(t, err)
+	assert.Equal(t, n, int64(1))
+
+	got, err := model.Get(due.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Status, data.RunStatusQueued)
+
+	err = model.Cancel(later.Id)
+	assert.NilError(t, err)
+
+	got, err = model.Get(later.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, got.Status, data.RunStatusCancelled)
+	assert.Equal(t, got.ResumeAt, nil)
+
+	err = model.Cancel(later.Id)
+	assert.Equal(t, errors.Is(err, data.ErrEditConflict), true)
+}
+
+func TestRunChildren(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.WorkflowRunModel{DB: db}
+
+	parent := data.WorkflowRun{WorkflowId: tests.Data.Workflows[0].Id}
+	assert.NilError(t, model.Insert(&parent))
+
+	child := data.WorkflowRun{
+		WorkflowId:  tests.Data.Workflows[1].Id,
+		ParentRunId: sql.NullString{String: parent.Id, Valid: true},
+		Depth:       parent.Depth + 1,
+		Params:      map[string]interface{}{"title": "Quarterly report"},
+	}
+	assert.NilError(t, model.Insert(&child))
+
+	got, err := model.Get(child.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, got.ParentRunId.String, parent.Id)
+	assert.Equal(t, got.Depth, 1)
+
+	children, err := model.GetChildren(parent.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(children), 1)
+	assert.Equal(t, children[0].Id, child.Id)
+	assert.Equal(t, children[0].Params["title"], "Quarterly report")
+
+	children, err = model.GetChildren(child.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(children), 0)
+}
+
+func TestRunGetFailed(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.WorkflowRunModel{DB: db}
+	workflowId := tests.Data.Workflows[0].Id
+
+	finish := func(status string) *data.WorkflowRun {
+		run := data.WorkflowRun{WorkflowId: workflowId}
+		assert.NilError(t, model.Insert(&run))
+
+		finishedAt := time.Now()
+		run.Status = status
+		run.FinishedAt = &finishedAt
+		assert.NilError(t, model.Update(&run))
+
+		return &run
+	}
+
+	failed := finish(data.RunStatusFailed)
+	replayed := finish(data.RunStatusFailed)
+	finish(data.RunStatusSucceeded)
+	later := finish(data.RunStatusFailed)
+
+	replay := data.WorkflowRun{
+		WorkflowId:    workflowId,
+		ReplayOfRunId: sql.NullString{String: replayed.Id, Valid: true},
+	}
+	assert.NilError(t, model.Insert(&replay))
+
+	got, err := model.Get(replay.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, got.ReplayOfRunId.String, replayed.Id)
+
+	since := time.Now().Add(-time.Hour)
+	until := time.Now().Add(time.Hour)
+
+	runs, err := model.GetFailed(workflowId, since, until, 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(runs), 2)
+	assert.Equal(t, runs[0].Id, failed.Id)
+	assert.Equal(t, runs[1].Id, later.Id)
+
+	// The oldest come first, so a bulk re-run cut short picks up where it
+	// stopped the next time.
+	runs, err = model.GetFailed(workflowId, since, until, 1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(runs), 1)
+	assert.Equal(t, runs[0].Id, failed.Id)
+
+	runs, err = model.GetFailed(workflowId, until, until.Add(time.Hour), 10)
+	assert.NilError(t, err)
+	assert.Equal(t, len(runs), 0)
+}
+
+func TestRunQueueStats(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.WorkflowRunModel{DB: db}
+
+	stats, err := model.QueueStats()
+	assert.NilError(t, err)
+	assert.Equal(t, stats.Runs[data.RunStatusQueued], 0)
+	assert.Equal(t, stats.Lag, time.Duration(0))
+
+	queued := data.WorkflowRun{WorkflowId: tests.Data.Workflows[0].Id}
+	overdue := data.WorkflowRun{WorkflowId: tests.Data.Workflows[0].Id}
+
+	for _, run := range []*data.WorkflowRun{&queued, &overdue} {
+		err := model.Insert(run)
+		assert.NilError(t, err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+
+	overdue.Status = data.RunStatusWaiting
+	overdue.ResumeAt = &past
+	assert.NilError(t, model.Update(&overdue))
+
+	stats, err = model.QueueStats()
+	assert.NilError(t, err)
+	assert.Equal(t, stats.Runs[data.RunStatusQueued], 1)
+	assert.Equal(t, stats.Runs[data.RunStatusWaiting], 1)
+	assert.Equal(t, stats.Runs[data.RunStatusRunning], 0)
+	assert.Equal(t, stats.Lag >= time.Hour, true)
+}
+
+func TestRunTraceContext(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.WorkflowRunModel{DB: db}
+
+	traced := data.WorkflowRun{
+		WorkflowId:   tests.Data.Workflows[0].Id,
+		TraceContext: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	}
+	untraced := data.WorkflowRun{WorkflowId: tests.Data.Workflows[0].Id}
+
+	for _, run := range []*data.WorkflowRun{&traced, &untraced} {
+		err := model.Insert(run)
+		assert.NilError(t, err)
+	}
+
+	got, err := model.Get(traced.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, got.TraceContext["traceparent"], traced.TraceContext["traceparent"])
+
+	got, err = model.Get(untraced.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(got.TraceContext), 0)
+}
+
+func TestRunFinished(t *testing.T) {
+	testMap := []struct {
+		status   string
+		finished bool
+	}{
+		{status: data.RunStatusQueued},
+		{status: data.RunStatusRunning},
+		{status: data.RunStatusWaiting},
+		{status: data.RunStatusSucceeded, finished: true},
+		{status: data.RunStatusFailed, finished: true},
+		{status: data.RunStatusCancelled, finished: true},
+	}
+
+	for _, tt := range testMap {
+		run := data.WorkflowRun{Status: tt.status}
+		assert.Equal(t, run.Finished(), tt.finished)
+	}
+}
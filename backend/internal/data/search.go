@@ -0,0 +1,126 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	SearchKindWorkflow = "workflow"
+	SearchKindStep     = "step"
+	SearchKindRun      = "run"
+)
+
+// SearchResult is a workflow, a step or a run that matched a search.
+// Highlight is the text that matched with the matching words wrapped in
+// <mark> tags. The rest of it is HTML escaped, so it can be shown as is.
+type SearchResult struct {
+	Kind         string         `json:"kind"`
+	WorkflowId   string         `json:"workflowId"`
+	WorkflowName string         `json:"workflowName"`
+	StepId       sql.NullString `json:"stepId"`
+	RunId        sql.NullString `json:"runId"`
+	Rank         float64        `json:"rank"`
+	Highlight    string         `json:"highlight"`
+	At           time.Time      `json:"at"`
+}
+
+type SearchModel struct {
+	DB *sqlx.DB
+}
+
+// Search looks for the text in the names of the workflows in the user's
+// workspaces, in the text, provider and operation of their steps and in the
+// errors of their runs, best matches first. The text is in web search syntax: quoted
+// phrases, OR and -excluded words. Runs that failed with the same error are
+// found once, by the newest of them. Empty kinds search everything.
+func (model SearchModel) Search(userId string, text string, kinds []string, filters Filters) ([]*SearchResult, Metadata, error) {
+	query := `WITH query AS (
+			SELECT websearch_to_tsquery('english', $2) AS q
+		), matches AS (
+			SELECT 'workflow' AS kind, w.id AS workflow_id, w.name AS workflow_name, NULL::uuid AS step_id, NULL::uuid AS run_id,
+				ts_rank(w.search_vector, query.q) AS rank, w.name AS document, w.updated_at AS at
+			FROM workflows w
+			CROSS JOIN query
+			WHERE w.workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1)
+			AND w.search_vector @@ query.q
+			AND (cardinality($3::text[]) = 0 OR 'workflow' = ANY($3))
+			UNION ALL
+			SELECT 'step', w.id, w.name, wa.id, NULL,
+				ts_rank(wa.search_vector, query.q), concat_ws(' - ', wa.text, p.name || ' ' || a.operation), wa.updated_at
+			FROM workflow_actions wa
+			INNER JOIN workflows w ON wa.workflow_id = w.id
+			INNER JOIN actions a ON wa.action_id = a.id
+			INNER JOIN providers p ON a.provider_id = p.id
+			CROSS JOIN query
+			WHERE w.workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1)
+			AND wa.search_vector @@ query.q
+			AND (cardinality($3::text[]) = 0 OR 'step' = ANY($3))
+			UNION ALL
+			SELECT * FROM (
+				SELECT DISTINCT ON (r.workflow_id, r.error) 'run' AS kind, w.id AS workflow_id, w.name AS workflow_name,
+					NULL::uuid AS step_id, r.id AS run_id, ts_rank(r.search_vector, query.q) AS rank, r.error AS document,
+					r.created_at AS at
+				FROM workflow_runs r
+				INNER JOIN workflows w ON r.workflow_id = w.id
+				CROSS JOIN query
+				WHERE w.workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1)
+				AND r.search_vector @@ query.q
+				AND (cardinality($3::text[]) = 0 OR 'run' = ANY($3))
+				ORDER BY r.workflow_id, r.error, r.created_at DESC
+			) runs
+		)
+		SELECT count(*) OVER(), m.kind, m.workflow_id, m.workflow_name, m.step_id, m.run_id, m.rank,
+			ts_headline('english', replace(replace(replace(m.document, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), query.q,
+				'StartSel=<mark>, StopSel=</mark>'),
+			m.at
+		FROM matches m
+		CROSS JOIN query
+		ORDER BY m.rank DESC, m.at DESC, m.kind, coalesce(m.step_id, m.run_id, m.workflow_id)
+		LIMIT $4 OFFSET $5`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryxContext(ctx, query, userId, text, pq.Array(append([]string{}, kinds...)), filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	results := []*SearchResult{}
+
+	for rows.Next() {
+		var result SearchResult
+
+		err := rows.Scan(
+			&totalRecords,
+			&result.Kind,
+			&result.WorkflowId,
+			&result.WorkflowName,
+			&result.StepId,
+			&result.RunId,
+			&result.Rank,
+			&result.Highlight,
+			&result.At,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		results = append(results, &result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return results, metadata, nil
+}
@@ -0,0 +1,56 @@
+package data_test
+
+import (
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/tests"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestSearch(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.SearchModel{DB: db}
+	runs := data.WorkflowRunModel{DB: db}
+
+	onboarding := tests.Data.Workflows[0]
+	filters := data.Filters{Page: 1, PageSize: 20, Sort: "-rank", SortSafeList: []string{"-rank"}}
+
+	for i := 0; i < 2; i++ {
+		run := data.WorkflowRun{WorkflowId: onboarding.Id}
+		assert.NilError(t, runs.Insert(&run))
+
+		run.Status = data.RunStatusFailed
+		run.Error = "release channel not found"
+		assert.NilError(t, runs.Update(&run))
+	}
+
+	results, metadata, err := model.Search(onboarding.UserId, "onboarding", nil, filters)
+	assert.NilError(t, err)
+	assert.Equal(t, metadata.TotalRecords, 3)
+
+	for _, result := range results {
+		assert.Equal(t, result.WorkflowId, onboarding.Id)
+
+		if result.Kind == data.SearchKindWorkflow {
+			assert.Equal(t, result.Highlight, "User <mark>Onboarding</mark>")
+		}
+	}
+
+	results, _, err = model.Search(onboarding.UserId, "onboarding", []string{data.SearchKindStep}, filters)
+	assert.NilError(t, err)
+	assert.Equal(t, len(results), 2)
+	assert.Equal(t, results[0].Kind, data.SearchKindStep)
+
+	results, _, err = model.Search(onboarding.UserId, `"release channels"`, nil, filters)
+	assert.NilError(t, err)
+	assert.Equal(t, len(results), 1)
+	assert.Equal(t, results[0].Kind, data.SearchKindRun)
+	assert.Equal(t, results[0].Highlight, "<mark>release</mark> <mark>channel</mark> not found")
+
+	results, _, err = model.Search(tests.Data.Workflows[1].UserId, "onboarding", nil, filters)
+	assert.NilError(t, err)
+	assert.Equal(t, len(results), 0)
+}
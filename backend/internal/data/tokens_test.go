@@ -0,0 +1,126 @@
+package data_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/tests"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestUserGetForToken(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	tokens := data.TokenModel{DB: db}
+	users := data.UserModel{DB: db}
+
+	userId := tests.Data.Users[0].Id
+
+	valid, err := tokens.New(userId, time.Hour, data.ScopeAuthentication)
+	assert.NilError(t, err)
+
+	expired, err := tokens.New(userId, -time.Hour, data.ScopeAuthentication)
+	assert.NilError(t, err)
+
+	otherScope, err := tokens.New(userId, time.Hour, "other")
+	assert.NilError(t, err)
+
+	testMap := []struct {
+		name        string
+		scope       string
+		token       string
+		shouldError bool
+	}{
+		{
+			name:  "Valid Token",
+			scope: data.ScopeAuthentication,
+			token: valid.Plaintext,
+		},
+		{
+			name:        "Expired Token Should Error",
+			scope:       data.ScopeAuthentication,
+			token:       expired.Plaintext,
+			shouldError: true,
+		},
+		{
+			name:        "Other Scope Should Error",
+			scope:       data.ScopeAuthentication,
+			token:       otherScope.Plaintext,
+			shouldError: true,
+		},
+		{
+			name:        "Unknown Token Should Error",
+			scope:       data.ScopeAuthentication,
+			token:       "AAAAAAAAAAAAAAAAAAAAAAAAAA",
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := users.GetForToken(tt.scope, tt.token)
+
+			if tt.shouldError {
+				assert.Equal(t, errors.Is(err, data.ErrRecordNotFound), true)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, user.Id, userId)
+		})
+	}
+}
+
+func TestTokenDelete(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	tokens := data.TokenModel{DB: db}
+	users := data.UserModel{DB: db}
+
+	userId := tests.Data.Users[0].Id
+
+	revoked, err := tokens.New(userId, time.Hour, data.ScopeAuthentication)
+	assert.NilError(t, err)
+
+	kept, err := tokens.New(userId, time.Hour, data.ScopeAuthentication)
+	assert.NilError(t, err)
+
+	err = tokens.Delete(data.ScopeAuthentication, revoked.Plaintext)
+	assert.NilError(t, err)
+
+	_, err = users.GetForToken(data.ScopeAuthentication, revoked.Plaintext)
+	assert.Equal(t, errors.Is(err, data.ErrRecordNotFound), true)
+
+	_, err = users.GetForToken(data.ScopeAuthentication, kept.Plaintext)
+	assert.NilError(t, err)
+}
+
+func TestTokenDeleteExpired(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	tokens := data.TokenModel{DB: db}
+	users := data.UserModel{DB: db}
+
+	userId := tests.Data.Users[0].Id
+
+	_, err := tokens.New(userId, -time.Hour, data.ScopeAuthentication)
+	assert.NilError(t, err)
+
+	_, err = tokens.New(userId, -time.Minute, data.ScopeAuthentication)
+	assert.NilError(t, err)
+
+	valid, err := tokens.New(userId, time.Hour, data.ScopeAuthentication)
+	assert.NilError(t, err)
+
+	n, err := tokens.DeleteExpired()
+	assert.NilError(t, err)
+	assert.Equal(t, n, int64(2))
+
+	_, err = users.GetForToken(data.ScopeAuthentication, valid.Plaintext)
+	assert.NilError(t, err)
+}
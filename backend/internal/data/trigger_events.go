@@ -0,0 +1,120 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TriggerEvent records a dedupe key a workflow trigger fired with and the
+// run it started, so the same event doesn't start a second run.
+type TriggerEvent struct {
+	WorkflowId string         `db:"workflow_id" json:"workflowId"`
+	DedupeKey  string         `db:"dedupe_key" json:"dedupeKey"`
+	RunId      sql.NullString `db:"run_id" json:"runId"`
+	CreatedAt  time.Time      `db:"created_at" json:"createdAt"`
+}
+
+type TriggerEventModel struct {
+	DB *sqlx.DB
+}
+
+// Claim records the dedupe key for the workflow and reports whether it was
+// new. A key recorded longer than retention ago is claimed again.
+func (model TriggerEventModel) Claim(workflowId, dedupeKey string, retention time.Duration) (bool, error) {
+	if dedupeKey == "" {
+		return false, fmt.Errorf("dedupe key cannot be empty")
+	}
+
+	query := `INSERT INTO trigger_events (workflow_id, dedupe_key)
+		VALUES ($1, $2)
+		ON CONFLICT (workflow_id, dedupe_key) DO UPDATE SET
+			run_id = NULL,
+			created_at = now()
+		WHERE trigger_events.created_at < now() - make_interval(secs => $3)
+		RETURNING created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var createdAt time.Time
+
+	err := model.DB.QueryRowxContext(ctx, query, workflowId, dedupeKey, retention.Seconds()).Scan(&createdAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// SetRun links a claimed dedupe key to the run it started.
+func (model TriggerEventModel) SetRun(workflowId, dedupeKey, runId string) error {
+	query := `UPDATE trigger_events SET run_id = $1 WHERE workflow_id = $2 AND dedupe_key = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := model.DB.ExecContext(ctx, query, runId, workflowId, dedupeKey)
+
+	return err
+}
+
+// Release drops a claimed dedupe key whose run couldn't be started so the
+// next poll can claim it again.
+func (model TriggerEventModel) Release(workflowId, dedupeKey string) error {
+	query := `DELETE FROM trigger_events WHERE workflow_id = $1 AND dedupe_key = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := model.DB.ExecContext(ctx, query, workflowId, dedupeKey)
+
+	return err
+}
+
+func (model TriggerEventModel) Get(workflowId, dedupeKey string) (*TriggerEvent, error) {
+	query := `SELECT workflow_id, dedupe_key, run_id, created_at
+		FROM trigger_events
+		WHERE workflow_id = $1 AND dedupe_key = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var event TriggerEvent
+
+	err := model.DB.GetContext(ctx, &event, query, workflowId, dedupeKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &event, nil
+}
+
+// DeleteExpired removes the dedupe keys recorded longer than retention ago.
+func (model TriggerEventModel) DeleteExpired(retention time.Duration) (int64, error) {
+	query := `DELETE FROM trigger_events WHERE created_at < now() - make_interval(secs => $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := model.DB.ExecContext(ctx, query, retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
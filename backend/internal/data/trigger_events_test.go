@@ -0,0 +1,63 @@
+package data_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/tests"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestTriggerEventClaim(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.TriggerEventModel{DB: db}
+	runs := data.WorkflowRunModel{DB: db}
+
+	workflowId := tests.Data.Workflows[0].Id
+	otherWorkflowId := tests.Data.Workflows[1].Id
+	key := "luisya22/confluo#42"
+
+	claimed, err := model.Claim(workflowId, key, time.Hour)
+	assert.NilError(t, err)
+	assert.Equal(t, claimed, true)
+
+	run := data.WorkflowRun{WorkflowId: workflowId}
+	assert.NilError(t, runs.Insert(&run))
+	assert.NilError(t, model.SetRun(workflowId, key, run.Id))
+
+	event, err := model.Get(workflowId, key)
+	assert.NilError(t, err)
+	assert.Equal(t, event.RunId.String, run.Id)
+
+	claimed, err = model.Claim(workflowId, key, time.Hour)
+	assert.NilError(t, err)
+	assert.Equal(t, claimed, false)
+
+	claimed, err = model.Claim(otherWorkflowId, key, time.Hour)
+	assert.NilError(t, err)
+	assert.Equal(t, claimed, true)
+
+	// Past the retention window the key can start a run again.
+	claimed, err = model.Claim(workflowId, key, 0)
+	assert.NilError(t, err)
+	assert.Equal(t, claimed, true)
+
+	event, err = model.Get(workflowId, key)
+	assert.NilError(t, err)
+	assert.Equal(t, event.RunId.Valid, false)
+
+	assert.NilError(t, model.Release(workflowId, key))
+
+	_, err = model.Get(workflowId, key)
+	assert.Equal(t, err, data.ErrRecordNotFound)
+
+	n, err := model.DeleteExpired(0)
+	assert.NilError(t, err)
+	assert.Equal(t, n, int64(1))
+
+	_, err = model.Claim(workflowId, "", time.Hour)
+	assert.Error(t, err)
+}
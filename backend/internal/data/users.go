@@ -1,11 +1,95 @@
 package data
 
-import "github.com/jmoiron/sqlx"
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var AnonymousUser = &User{}
 
 type User struct {
-	Id string
+	Id          string    `db:"id" json:"id"`
+	GithubLogin string    `db:"github_login" json:"githubLogin"`
+	Name        string    `db:"name" json:"name"`
+	Email       string    `db:"email" json:"email"`
+	AvatarUrl   string    `db:"avatar_url" json:"avatarUrl"`
+	CreatedAt   time.Time `db:"created_at" json:"-"`
+	Version     int       `db:"version" json:"version"`
+}
+
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
 }
 
-type UserModle struct {
+type UserModel struct {
 	DB *sqlx.DB
 }
+
+// UpsertGithub creates the user for a Github login, or refreshes the profile
+// of the existing one.
+func (model UserModel) UpsertGithub(u *User) error {
+	if u.GithubLogin == "" {
+		return fmt.Errorf("github login cannot be empty")
+	}
+
+	query := `INSERT INTO users (github_login, name, email, avatar_url)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (github_login) DO UPDATE SET
+			name = EXCLUDED.name,
+			email = EXCLUDED.email,
+			avatar_url = EXCLUDED.avatar_url,
+			version = users.version + 1
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return model.DB.QueryRowxContext(ctx, query, u.GithubLogin, u.Name, u.Email, u.AvatarUrl).Scan(
+		&u.Id,
+		&u.CreatedAt,
+		&u.Version,
+	)
+}
+
+func (model UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `SELECT users.id, COALESCE(users.github_login, ''), users.name, users.email,
+			users.avatar_url, users.created_at, users.version
+		FROM users
+		INNER JOIN tokens ON users.id = tokens.user_id
+		WHERE tokens.hash = $1
+		AND tokens.scope = $2
+		AND tokens.expiry > $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var user User
+
+	err := model.DB.QueryRowxContext(ctx, query, tokenHash[:], tokenScope, time.Now()).Scan(
+		&user.Id,
+		&user.GithubLogin,
+		&user.Name,
+		&user.Email,
+		&user.AvatarUrl,
+		&user.CreatedAt,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
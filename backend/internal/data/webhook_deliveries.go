@@ -0,0 +1,315 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusFailed    = "failed"
+)
+
+// WebhookDelivery is one event pushed to a receiver. The same delivery id is
+// reused when it's redelivered so receivers can dedupe. ConnectionId is the
+// connection holding the secret the delivery is signed with.
+type WebhookDelivery struct {
+	Id               string                   `db:"id" json:"id"`
+	WorkflowActionId sql.NullString           `db:"workflow_action_id" json:"workflowActionId"`
+	ConnectionId     sql.NullString           `db:"connection_id" json:"connectionId"`
+	Url              string                   `db:"url" json:"url"`
+	Event            string                   `db:"event" json:"event"`
+	Payload          interface{}              `db:"-" json:"payload"`
+	Headers          map[string]string        `db:"-" json:"headers"`
+	Status           string                   `db:"status" json:"status"`
+	Attempts         []WebhookDeliveryAttempt `db:"-" json:"attempts,omitempty"`
+	AttemptCount     int                      `db:"attempt_count" json:"attemptCount"`
+	CreatedAt        time.Time                `db:"created_at" json:"createdAt"`
+	UpdatedAt        time.Time                `db:"updated_at" json:"updatedAt"`
+	Version          int                      `db:"version" json:"version"`
+}
+
+type WebhookDeliveryAttempt struct {
+	Id             string    `db:"id" json:"id"`
+	DeliveryId     string    `db:"delivery_id" json:"deliveryId"`
+	ResponseStatus *int      `db:"response_status" json:"responseStatus"`
+	LatencyMs      int64     `db:"latency_ms" json:"latencyMs"`
+	Error          string    `db:"error" json:"error,omitempty"`
+	CreatedAt      time.Time `db:"created_at" json:"createdAt"`
+}
+
+type WebhookDeliveryModel struct {
+	DB *sqlx.DB
+}
+
+func (model WebhookDeliveryModel) Insert(d *WebhookDelivery) error {
+	if d.Url == "" {
+		return fmt.Errorf("url cannot be empty")
+	}
+
+	payloadJSON, err := json.Marshal(d.Payload)
+	if err != nil {
+		return err
+	}
+
+	headersJSON, err := json.Marshal(d.Headers)
+	if err != nil {
+		return err
+	}
+
+	if d.Status == "" {
+		d.Status = DeliveryStatusPending
+	}
+
+	query := `INSERT INTO webhook_deliveries (workflow_action_id, connection_id, url, event, payload, headers, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return model.DB.QueryRowxContext(
+		ctx,
+		query,
+		d.WorkflowActionId,
+		d.ConnectionId,
+		d.Url,
+		d.Event,
+		payloadJSON,
+		headersJSON,
+		d.Status,
+	).Scan(&d.Id, &d.CreatedAt, &d.UpdatedAt, &d.Version)
+}
+
+func (model WebhookDeliveryModel) Get(id string) (*WebhookDelivery, error) {
+	query := `SELECT id, workflow_action_id, connection_id, url, event, payload, headers, status, attempt_count,
+			created_at, updated_at, version
+		FROM webhook_deliveries
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	delivery, err := scanDelivery(model.DB.QueryRowxContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	delivery.Attempts, err = model.GetAttempts(delivery.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// GetAllForUser lists the deliveries sent by the workflows in the user's
+// workspaces, newest first. An empty status returns every delivery.
+func (model WebhookDeliveryModel) GetAllForUser(userId string, status string, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	query := `SELECT count(*) OVER(), d.id, d.workflow_action_id, d.connection_id, d.url, d.event, d.payload, d.headers,
+			d.status, d.attempt_count, d.created_at, d.updated_at, d.version
+		FROM webhook_deliveries d
+		INNER JOIN workflow_actions wa ON d.workflow_action_id = wa.id
+		INNER JOIN workflows w ON wa.workflow_id = w.id
+		WHERE w.workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1)
+		AND (d.status = $2 OR $2 = '')
+		ORDER BY d.created_at DESC, d.id
+		LIMIT $3 OFFSET $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryxContext(ctx, query, userId, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	deliveries := []*WebhookDelivery{}
+
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var payload, headers []uint8
+
+		err := rows.Scan(
+			&totalRecords,
+			&delivery.Id,
+			&delivery.WorkflowActionId,
+			&delivery.ConnectionId,
+			&delivery.Url,
+			&delivery.Event,
+			&payload,
+			&headers,
+			&delivery.Status,
+			&delivery.AttemptCount,
+			&delivery.CreatedAt,
+			&delivery.UpdatedAt,
+			&delivery.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		if err := unmarshalDelivery(&delivery, payload, headers); err != nil {
+			return nil, Metadata{}, err
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return deliveries, metadata, nil
+}
+
+// GetWorkspaceId returns the id of the workspace whose workflow sent the
+// delivery.
+func (model WebhookDeliveryModel) GetWorkspaceId(id string) (string, error) {
+	query := `SELECT w.workspace_id
+		FROM webhook_deliveries d
+		INNER JOIN workflow_actions wa ON d.workflow_action_id = wa.id
+		INNER JOIN workflows w ON wa.workflow_id = w.id
+		WHERE d.id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var workspaceId string
+
+	err := model.DB.QueryRowxContext(ctx, query, id).Scan(&workspaceId)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return workspaceId, nil
+}
+
+func (model WebhookDeliveryModel) Update(d *WebhookDelivery) error {
+	query := `UPDATE webhook_deliveries SET
+			status = $1,
+			attempt_count = $2,
+			updated_at = now(),
+			version = version + 1
+		WHERE id = $3
+		AND version = $4
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := model.DB.QueryRowxContext(ctx, query, d.Status, d.AttemptCount, d.Id, d.Version).Scan(&d.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (model WebhookDeliveryModel) InsertAttempt(a *WebhookDeliveryAttempt) error {
+	if a.DeliveryId == "" {
+		return fmt.Errorf("delivery id cannot be empty")
+	}
+
+	query := `INSERT INTO webhook_delivery_attempts (delivery_id, response_status, latency_ms, error)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return model.DB.QueryRowxContext(ctx, query, a.DeliveryId, a.ResponseStatus, a.LatencyMs, a.Error).Scan(
+		&a.Id,
+		&a.CreatedAt,
+	)
+}
+
+func (model WebhookDeliveryModel) GetAttempts(deliveryId string) ([]WebhookDeliveryAttempt, error) {
+	query := `SELECT id, delivery_id, response_status, latency_ms, error, created_at
+		FROM webhook_delivery_attempts
+		WHERE delivery_id = $1
+		ORDER BY created_at, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	attempts := []WebhookDeliveryAttempt{}
+
+	err := model.DB.SelectContext(ctx, &attempts, query, deliveryId)
+	if err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+func scanDelivery(row *sqlx.Row) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var payload, headers []uint8
+
+	err := row.Scan(
+		&delivery.Id,
+		&delivery.WorkflowActionId,
+		&delivery.ConnectionId,
+		&delivery.Url,
+		&delivery.Event,
+		&payload,
+		&headers,
+		&delivery.Status,
+		&delivery.AttemptCount,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+		&delivery.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := unmarshalDelivery(&delivery, payload, headers); err != nil {
+		return nil, err
+	}
+
+	return &delivery, nil
+}
+
+func unmarshalDelivery(d *WebhookDelivery, payload, headers []uint8) error {
+	if payload != nil {
+		if err := json.Unmarshal(payload, &d.Payload); err != nil {
+			return err
+		}
+	}
+
+	if headers != nil {
+		if err := json.Unmarshal(headers, &d.Headers); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package data_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/tests"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+type webhookDeliveryTestResult struct {
+	delivery    data.WebhookDelivery
+	shouldError bool
+}
+
+func TestWebhookDeliveryInsert(t *testing.T) {
+	testMap := []struct {
+		name  string
+		data  data.WebhookDelivery
+		wants webhookDeliveryTestResult
+	}{
+		{
+			name: "Can Insert",
+			data: data.WebhookDelivery{
+				WorkflowActionId: sql.NullString{String: tests.Data.WorkflowActions[1].Id, Valid: true},
+				Url:              "https://example.com/hooks",
+				Event:            "onboarding.completed",
+				Payload:          map[string]interface{}{"user": "octocat"},
+			},
+			wants: webhookDeliveryTestResult{
+				delivery: data.WebhookDelivery{
+					Url:    "https://example.com/hooks",
+					Event:  "onboarding.completed",
+					Status: data.DeliveryStatusPending,
+				},
+				shouldError: false,
+			},
+		},
+		{
+			name: "Missing Url Should Error",
+			data: data.WebhookDelivery{
+				Event: "onboarding.completed",
+			},
+			wants: webhookDeliveryTestResult{
+				shouldError: true,
+			},
+		},
+	}
+
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			model := data.WebhookDeliveryModel{DB: db}
+
+			err := model.Insert(&tt.data)
+
+			if tt.wants.shouldError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.NotEqual(t, tt.data.Id, "")
+
+			delivery, err := model.Get(tt.data.Id)
+
+			assert.NilError(t, err)
+
+			assert.Equal(t, delivery.Url, tt.wants.delivery.Url)
+			assert.Equal(t, delivery.Event, tt.wants.delivery.Event)
+			assert.Equal(t, delivery.Status, tt.wants.delivery.Status)
+			assert.Equal(t, len(delivery.Attempts), 0)
+		})
+	}
+}
+
+func TestWebhookDeliveryAttempts(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.WebhookDeliveryModel{DB: db}
+
+	delivery := data.WebhookDelivery{
+		WorkflowActionId: sql.NullString{String: tests.Data.WorkflowActions[1].Id, Valid: true},
+		Url:              "https://example.com/hooks",
+	}
+
+	err := model.Insert(&delivery)
+	assert.NilError(t, err)
+
+	status := 502
+	err = model.InsertAttempt(&data.WebhookDeliveryAttempt{
+		DeliveryId:     delivery.Id,
+		ResponseStatus: &status,
+		LatencyMs:      120,
+		Error:          "receiver responded with status 502",
+	})
+	assert.NilError(t, err)
+
+	delivery.Status = data.DeliveryStatusFailed
+	delivery.AttemptCount = 1
+
+	err = model.Update(&delivery)
+	assert.NilError(t, err)
+
+	got, err := model.Get(delivery.Id)
+	assert.NilError(t, err)
+
+	assert.Equal(t, got.Status, data.DeliveryStatusFailed)
+	assert.Equal(t, got.AttemptCount, 1)
+	assert.Equal(t, len(got.Attempts), 1)
+	assert.Equal(t, *got.Attempts[0].ResponseStatus, 502)
+
+	workspaceId, err := model.GetWorkspaceId(delivery.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, workspaceId, tests.Data.Workflows[0].WorkspaceId)
+}
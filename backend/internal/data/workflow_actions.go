@@ -9,21 +9,46 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/luisya22/confluo/backend/internal/validator"
 )
 
 type WorkflowAction struct {
-	Id           string                 `db:"id" json:"id"`
-	Text         string                 `db:"text" json:"text"`
-	WorkflowId   string                 `db:"workflow_id" json:"workflowId"`
-	ActionId     string                 `db:"action_id" json:"actionId"`
-	Action       Action                 `db:"-" json:"action"`
-	Type         string                 `db:"type" json:"type"`
-	NextActionId sql.NullString         `db:"next_action_id" json:"next_action_id"`
-	NextAction   string                 `db:"-" json:"nextAction"`
-	Params       map[string]interface{} `db:"params" json:"params"`
-	CreatedAt    time.Time              `db:"created_at" json:"-"`
-	UpdatedAt    time.Time              `db:"updated_at" json:"-"`
-	Version      int                    `db:"version" json:"version"`
+	Id            string                 `db:"id" json:"id"`
+	Text          string                 `db:"text" json:"text"`
+	WorkflowId    string                 `db:"workflow_id" json:"workflowId"`
+	ActionId      string                 `db:"action_id" json:"actionId"`
+	Action        Action                 `db:"-" json:"action"`
+	Type          string                 `db:"type" json:"type"`
+	NextActionId  sql.NullString         `db:"next_action_id" json:"next_action_id"`
+	NextAction    string                 `db:"-" json:"nextAction"`
+	ErrorActionId sql.NullString         `db:"error_action_id" json:"errorActionId"`
+	Branches      []WorkflowBranch       `db:"-" json:"branches"`
+	Params        map[string]interface{} `db:"params" json:"params"`
+	CreatedAt     time.Time              `db:"created_at" json:"-"`
+	UpdatedAt     time.Time              `db:"updated_at" json:"-"`
+	Version       int                    `db:"version" json:"version"`
+}
+
+// WorkflowBranch is an extra outgoing edge of a step. A Parallel step starts
+// one branch per edge, next to the NextActionId that leads to its Join.
+type WorkflowBranch struct {
+	Name         string `db:"name" json:"name"`
+	NextActionId string `db:"next_action_id" json:"nextActionId"`
+}
+
+func ValidateBranches(v *validator.Validator, branches []WorkflowBranch) {
+	names := make([]string, 0, len(branches))
+
+	for _, b := range branches {
+		v.Check(b.Name != "", "branches", "every branch must have a name")
+		v.Check(len(b.Name) <= 50, "branches", "branch names must not be more than 50 bytes long")
+		v.Check(validator.Matches(b.NextActionId, validator.UUIDRX), "branches", "every branch must point to a step")
+
+		names = append(names, b.Name)
+	}
+
+	v.Check(validator.Unique(names), "branches", "branch names must be unique")
 }
 
 type WorkFlowActionModel struct {
@@ -65,6 +90,8 @@ func (model WorkFlowActionModel) Update(wa *WorkflowAction) error {
 	query := `UPDATE workflow_actions SET
 		text = :text,
 		params = :params,
+		next_action_id = :next_action_id,
+		error_action_id = :error_action_id,
 		version = version + 1
 		WHERE id = :id
 		AND version = :version
@@ -73,7 +100,13 @@ func (model WorkFlowActionModel) Update(wa *WorkflowAction) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	stmt, err := model.DB.PrepareNamedContext(ctx, query)
+	tx, err := model.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareNamedContext(ctx, query)
 	if err != nil {
 		return err
 	}
@@ -81,10 +114,12 @@ func (model WorkFlowActionModel) Update(wa *WorkflowAction) error {
 	defer stmt.Close()
 
 	paramMap := map[string]interface{}{
-		"id":      wa.Id,
-		"text":    wa.Text,
-		"params":  paramsJSON,
-		"version": wa.Version,
+		"id":              wa.Id,
+		"text":            wa.Text,
+		"params":          paramsJSON,
+		"next_action_id":  wa.NextActionId,
+		"error_action_id": wa.ErrorActionId,
+		"version":         wa.Version,
 	}
 
 	err = stmt.QueryRowxContext(ctx, paramMap).Scan(&wa.Version)
@@ -97,5 +132,111 @@ func (model WorkFlowActionModel) Update(wa *WorkflowAction) error {
 		}
 	}
 
+	err = saveBranches(ctx, tx, wa.Id, wa.Branches)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (model WorkFlowActionModel) Get(id string) (*WorkflowAction, error) {
+	query := `SELECT id, text, type, params, workflow_id, action_id, next_action_id, error_action_id, version
+		FROM workflow_actions
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var workflowAction WorkflowAction
+	var params []uint8
+
+	err := model.DB.QueryRowxContext(ctx, query, id).Scan(
+		&workflowAction.Id,
+		&workflowAction.Text,
+		&workflowAction.Type,
+		&params,
+		&workflowAction.WorkflowId,
+		&workflowAction.ActionId,
+		&workflowAction.NextActionId,
+		&workflowAction.ErrorActionId,
+		&workflowAction.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if params != nil {
+		if err := json.Unmarshal(params, &workflowAction.Params); err != nil {
+			return nil, err
+		}
+	}
+
+	branches, err := getBranches(ctx, model.DB, []string{workflowAction.Id})
+	if err != nil {
+		return nil, err
+	}
+
+	workflowAction.Branches = branches[workflowAction.Id]
+
+	return &workflowAction, nil
+}
+
+// saveBranches replaces the branches of a step, keeping their order.
+func saveBranches(ctx context.Context, tx *sqlx.Tx, actionId string, branches []WorkflowBranch) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM workflow_action_branches WHERE workflow_action_id = $1`, actionId)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO workflow_action_branches (workflow_action_id, name, next_action_id, position)
+		VALUES ($1, $2, $3, $4)`
+
+	for i, b := range branches {
+		_, err := tx.ExecContext(ctx, query, actionId, b.Name, b.NextActionId, i)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// getBranches loads the branches of the given steps, keyed by step id.
+func getBranches(ctx context.Context, db sqlx.QueryerContext, actionIds []string) (map[string][]WorkflowBranch, error) {
+	query := `SELECT workflow_action_id, name, next_action_id
+		FROM workflow_action_branches
+		WHERE workflow_action_id = ANY($1)
+		ORDER BY workflow_action_id, position`
+
+	rows, err := db.QueryxContext(ctx, query, pq.Array(actionIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	branches := make(map[string][]WorkflowBranch)
+
+	for rows.Next() {
+		var actionId string
+		var b WorkflowBranch
+
+		err := rows.Scan(&actionId, &b.Name, &b.NextActionId)
+		if err != nil {
+			return nil, err
+		}
+
+		branches[actionId] = append(branches[actionId], b)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return branches, nil
+}
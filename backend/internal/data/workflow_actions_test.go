@@ -208,3 +208,48 @@ func TestWorkflowActionUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestWorkflowActionBranches(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.WorkFlowActionModel{DB: db}
+	workflows := data.WorkflowModel{DB: db}
+
+	workflowAction, err := model.Get(tests.Data.WorkflowActions[0].Id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(workflowAction.Branches), 0)
+
+	workflowAction.Branches = []data.WorkflowBranch{
+		{Name: "slack", NextActionId: tests.Data.WorkflowActions[1].Id},
+		{Name: "email", NextActionId: tests.Data.WorkflowActions[1].Id},
+	}
+
+	err = model.Update(workflowAction)
+	assert.NilError(t, err)
+
+	workflow, err := workflows.Get(tests.Data.Workflows[0].Id)
+	assert.NilError(t, err)
+
+	for _, a := range workflow.Actions {
+		if a.Id != workflowAction.Id {
+			assert.Equal(t, len(a.Branches), 0)
+			continue
+		}
+
+		assert.Equal(t, len(a.Branches), 2)
+		assert.Equal(t, a.Branches[0].Name, "slack")
+		assert.Equal(t, a.Branches[1].Name, "email")
+		assert.Equal(t, a.Branches[1].NextActionId, tests.Data.WorkflowActions[1].Id)
+		assert.Equal(t, a.NextActionId, tests.Data.WorkflowActions[0].NextActionId)
+	}
+
+	workflowAction.Branches = nil
+
+	err = model.Update(workflowAction)
+	assert.NilError(t, err)
+
+	workflowAction, err = model.Get(workflowAction.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(workflowAction.Branches), 0)
+}
@@ -10,18 +10,69 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/luisya22/confluo/backend/internal/validator"
 )
 
 type Workflow struct {
-	Id        string           `db:"id" json:"id"`
-	UserId    string           `db:"user_id" json:"user_id"`
-	Name      string           `db:"name" json:"name"`
-	TriggerId sql.NullString   `db:"trigger_id" json:"trigger_id"`
-	Trigger   WorkflowAction   `db:"-" json:"trigger"`
-	Actions   []WorkflowAction `db:"-" json:"actions"`
-	CreatedAt time.Time        `db:"created_at" json:"-"`
-	UpdatedAt time.Time        `db:"updated_at" json:"-"`
-	Version   int              `db:"version" json:"version"`
+	Id              string           `db:"id" json:"id"`
+	UserId          string           `db:"user_id" json:"user_id"`
+	WorkspaceId     string           `db:"workspace_id" json:"workspaceId"`
+	Name            string           `db:"name" json:"name"`
+	TriggerId       sql.NullString   `db:"trigger_id" json:"trigger_id"`
+	ErrorWorkflowId sql.NullString   `db:"error_workflow_id" json:"errorWorkflowId"`
+	Tags            pq.StringArray   `db:"tags" json:"tags"`
+	Trigger         WorkflowAction   `db:"-" json:"trigger"`
+	Actions         []WorkflowAction `db:"-" json:"actions"`
+	LastRunStatus   string           `db:"-" json:"lastRunStatus,omitempty"`
+	LastRunAt       *time.Time       `db:"-" json:"lastRunAt,omitempty"`
+	CreatedAt       time.Time        `db:"created_at" json:"-"`
+	UpdatedAt       time.Time        `db:"updated_at" json:"-"`
+	Version         int              `db:"version" json:"version"`
+}
+
+// WorkflowFilters narrows a list of workflows. WorkspaceId keeps the
+// workflows of one of the user's workspaces, Name matches any part of the
+// name, Providers keeps the workflows with a step of any of the providers,
+// Statuses the ones whose last run has any of the statuses and Tags the ones
+// with all the tags. Empty fields don't filter.
+type WorkflowFilters struct {
+	WorkspaceId string
+	Name        string
+	Providers   []string
+	Statuses    []string
+	Tags        []string
+}
+
+func ValidateWorkflowFilters(v *validator.Validator, f WorkflowFilters) {
+	v.Check(f.WorkspaceId == "" || validator.Matches(f.WorkspaceId, validator.UUIDRX), "workspace_id", "must be a valid id")
+	v.Check(len(f.Name) <= 50, "name", "must not be more than 50 bytes long")
+
+	for _, status := range f.Statuses {
+		v.Check(
+			validator.PermittedValue(status, RunStatusQueued, RunStatusRunning, RunStatusWaiting, RunStatusSucceeded, RunStatusFailed, RunStatusCancelled),
+			"status",
+			"invalid status value",
+		)
+	}
+
+	for _, provider := range f.Providers {
+		v.Check(provider != "", "provider", "must not be empty")
+	}
+
+	for _, tag := range f.Tags {
+		v.Check(tag != "", "tag", "must not be empty")
+	}
+}
+
+func ValidateTags(v *validator.Validator, tags []string) {
+	v.Check(len(tags) <= 20, "tags", "must not contain more than 20 tags")
+	v.Check(validator.Unique(tags), "tags", "must not contain duplicate values")
+
+	for _, tag := range tags {
+		v.Check(tag != "", "tags", "every tag must be provided")
+		v.Check(len(tag) <= 50, "tags", "tags must not be more than 50 bytes long")
+	}
 }
 
 type WorkflowModel struct {
@@ -33,11 +84,15 @@ func (wm WorkflowModel) Insert(w *Workflow) error {
 		return fmt.Errorf("user id cannot be empty")
 	}
 
+	if w.WorkspaceId == "" {
+		return fmt.Errorf("workspace id cannot be empty")
+	}
+
 	if w.Name == "" {
 		return fmt.Errorf("name cannot be empty")
 	}
 
-	query := `INSERT INTO workflows (name, user_id) values (:name, :user_id) RETURNING id`
+	query := `INSERT INTO workflows (name, user_id, workspace_id) values (:name, :user_id, :workspace_id) RETURNING id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -56,6 +111,9 @@ func (wm WorkflowModel) Insert(w *Workflow) error {
 func (wm WorkflowModel) Update(w *Workflow) error {
 	query := `UPDATE workflows SET 
 			name = :name,
+			error_workflow_id = :error_workflow_id,
+			tags = COALESCE(CAST(:tags AS text[]), '{}'),
+			updated_at = now(),
 			version = version + 1
 		WHERE id = :id
 		AND version = :version
@@ -88,8 +146,8 @@ func (wm WorkflowModel) Get(id string) (*Workflow, error) {
 	rowsFound := false
 
 	query := `SELECT 
-			workflows.id, workflows.name, workflows.trigger_id, workflows.user_id, workflows.version,
-			workflow_actions.id, workflow_actions.text, workflow_actions.type, workflow_actions.next_action_id, workflow_actions.params, workflow_actions.workflow_id, workflow_actions.action_id,
+			workflows.id, workflows.name, workflows.trigger_id, workflows.error_workflow_id, workflows.user_id, workflows.workspace_id, workflows.tags, workflows.version,
+			workflow_actions.id, workflow_actions.text, workflow_actions.type, workflow_actions.next_action_id, workflow_actions.error_action_id, workflow_actions.params, workflow_actions.workflow_id, workflow_actions.action_id, workflow_actions.version,
 			actions.id, actions.provider_id, actions.operation,
 			providers.id, providers.name, providers.logo
 		FROM workflows
@@ -119,15 +177,20 @@ func (wm WorkflowModel) Get(id string) (*Workflow, error) {
 			&workflow.Id,
 			&workflow.Name,
 			&workflow.TriggerId,
+			&workflow.ErrorWorkflowId,
 			&workflow.UserId,
+			&workflow.WorkspaceId,
+			&workflow.Tags,
 			&workflow.Version,
 			&workflowAction.Id,
 			&workflowAction.Text,
 			&workflowAction.Type,
 			&workflowAction.NextActionId,
+			&workflowAction.ErrorActionId,
 			&params,
 			&workflowAction.WorkflowId,
 			&workflowAction.ActionId,
+			&workflowAction.Version,
 			&workflowAction.Action.Id,
 			&workflowAction.Action.ProviderId,
 			&workflowAction.Action.Operation,
@@ -152,71 +215,246 @@ func (wm WorkflowModel) Get(id string) (*Workflow, error) {
 		return nil, ErrRecordNotFound
 	}
 
+	actionIds := make([]string, 0, len(workflow.Actions))
+	for _, a := range workflow.Actions {
+		actionIds = append(actionIds, a.Id)
+	}
+
+	branches, err := getBranches(ctx, wm.DB, actionIds)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range workflow.Actions {
+		workflow.Actions[i].Branches = branches[workflow.Actions[i].Id]
+	}
+
 	return &workflow, nil
 }
 
-func (wm WorkflowModel) GetAll(userId string, filters Filters) ([]*Workflow, Metadata, error) {
-	query := `SELECT w.id, w.name. w.trigger_id, w.version, STRING_AGG(a.operation), STRING_AGG(p.name, ',')
-		FROM workflows w
-		LEFT JOIN workflow_actions wa ON w.id = wa.workflow_id
-		LEFT JOIN actions a ON wa.action_id = a.id
-		LEFT JOIN provider p ON a.provider_id = a.action_id
-		WHERE uerId = $1
-		GROUP BY w.id	
-	`
+// workflowSortKeys maps the sort columns of a workflow list to what they
+// sort by. Workflows that never ran sort before the ones that did.
+var workflowSortKeys = map[string]string{
+	"name":        "w.name",
+	"created_at":  "w.created_at",
+	"updated_at":  "w.updated_at",
+	"last_run_at": "COALESCE(lr.created_at, '-infinity')",
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// GetAll lists the workflows in the user's workspaces with their steps and last run. The list
+// is paged by filters.Page or, when filters.Cursor is set, by keyset from
+// the workflow the cursor points to. Either way the metadata has the cursor
+// of the next page when there is one.
+func (wm WorkflowModel) GetAll(userId string, wf WorkflowFilters, filters Filters) ([]*Workflow, Metadata, error) {
+	sortColumn, err := filters.sortColumn()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	sortKey, ok := workflowSortKeys[sortColumn]
+	if !ok {
+		return nil, Metadata{}, UnsafeSort
+	}
+
+	providers := make([]string, 0, len(wf.Providers))
+	for _, provider := range wf.Providers {
+		providers = append(providers, strings.ToLower(provider))
+	}
+
+	args := []any{
+		userId,
+		likeEscaper.Replace(wf.Name),
+		pq.Array(providers),
+		pq.Array(append([]string{}, wf.Statuses...)),
+		pq.Array(append([]string{}, wf.Tags...)),
+		wf.WorkspaceId,
+		filters.limit() + 1,
+		filters.offset(),
+	}
+
+	after := ""
+	if filters.Cursor != "" {
+		c, err := decodeCursor(filters.Cursor)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		comparison := ">"
+		if filters.sortDirection() == "DESC" {
+			comparison = "<"
+		}
+
+		after = fmt.Sprintf("WHERE (l.sort_key, l.id) %s ($9, $10)", comparison)
+		args = append(args, c.Value, c.Id)
+	}
+
+	query := fmt.Sprintf(`WITH listed AS (
+			SELECT count(*) OVER() AS total_records, w.id, w.user_id, w.workspace_id, w.name, w.trigger_id, w.error_workflow_id, w.tags,
+				w.created_at, w.updated_at, w.version, lr.status AS last_run_status, lr.created_at AS last_run_at,
+				%[1]s AS sort_key
+			FROM workflows w
+			LEFT JOIN LATERAL (
+				SELECT r.status, r.created_at
+				FROM workflow_runs r
+				WHERE r.workflow_id = w.id
+				ORDER BY r.created_at DESC, r.id DESC
+				LIMIT 1
+			) lr ON true
+			WHERE w.workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $1)
+			AND (w.workspace_id::text = $6 OR $6 = '')
+			AND (w.name ILIKE '%%' || $2 || '%%' OR $2 = '')
+			AND (cardinality($3::text[]) = 0 OR EXISTS (
+				SELECT 1
+				FROM workflow_actions wa
+				INNER JOIN actions a ON wa.action_id = a.id
+				INNER JOIN providers p ON a.provider_id = p.id
+				WHERE wa.workflow_id = w.id
+				AND lower(p.name) = ANY($3)
+			))
+			AND (cardinality($4::text[]) = 0 OR lr.status = ANY($4))
+			AND w.tags @> $5::text[]
+		)
+		SELECT l.total_records, l.id, l.user_id, l.workspace_id, l.name, l.trigger_id, l.error_workflow_id, l.tags, l.created_at,
+			l.updated_at, l.version, l.last_run_status, l.last_run_at, l.sort_key::text,
+			steps.ids, steps.operations, steps.providers
+		FROM listed l
+		LEFT JOIN LATERAL (
+			SELECT array_agg(wa.id::text ORDER BY wa.created_at, wa.id) AS ids,
+				array_agg(a.operation ORDER BY wa.created_at, wa.id) AS operations,
+				array_agg(p.name ORDER BY wa.created_at, wa.id) AS providers
+			FROM workflow_actions wa
+			INNER JOIN actions a ON wa.action_id = a.id
+			INNER JOIN providers p ON a.provider_id = p.id
+			WHERE wa.workflow_id = l.id
+		) steps ON true
+		%[2]s
+		ORDER BY l.sort_key %[3]s, l.id %[3]s
+		LIMIT $7 OFFSET $8`, sortKey, after, filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := wm.DB.QueryContext(ctx, query, userId)
+	rows, err := wm.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
 
 	defer rows.Close()
 
+	totalRecords := 0
 	workflows := []*Workflow{}
+	var sortValues []string
 
 	for rows.Next() {
 		var workflow Workflow
-		var actionsStr string
-		var providerStr string
-		var actions []WorkflowAction
+		var lastRunStatus sql.NullString
+		var sortValue string
+		var ids, operations, providers []string
 
 		err := rows.Scan(
+			&totalRecords,
 			&workflow.Id,
+			&workflow.UserId,
+			&workflow.WorkspaceId,
 			&workflow.Name,
 			&workflow.TriggerId,
+			&workflow.ErrorWorkflowId,
+			&workflow.Tags,
+			&workflow.CreatedAt,
+			&workflow.UpdatedAt,
 			&workflow.Version,
-			&actionsStr,
-			&providerStr,
+			&lastRunStatus,
+			&workflow.LastRunAt,
+			&sortValue,
+			pq.Array(&ids),
+			pq.Array(&operations),
+			pq.Array(&providers),
 		)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
 
-		actionsSpl := strings.Split(actionsStr, ",")
-		providersSpl := strings.Split(providerStr, ",")
+		workflow.LastRunStatus = lastRunStatus.String
 
-		for i := 0; i < len(actionsSpl); i++ {
-			a := WorkflowAction{
+		for i := range ids {
+			workflow.Actions = append(workflow.Actions, WorkflowAction{
+				Id:         ids[i],
+				WorkflowId: workflow.Id,
 				Action: Action{
-					Operation: actionsSpl[i],
+					Operation: operations[i],
 					Provider: Provider{
-						Name: providersSpl[i],
+						Name: providers[i],
 					},
 				},
-			}
-			actions = append(actions, a)
+			})
 		}
 
-		workflow.Actions = actions
-
 		workflows = append(workflows, &workflow)
+		sortValues = append(sortValues, sortValue)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	nextCursor := ""
+	if len(workflows) > filters.limit() {
+		workflows = workflows[:filters.limit()]
+
+		last := workflows[len(workflows)-1]
+		nextCursor = encodeCursor(cursor{Sort: filters.Sort, Value: sortValues[len(workflows)-1], Id: last.Id})
+	}
+
+	if filters.Cursor != "" {
+		return workflows, calculateCursorMetadata(totalRecords, filters.PageSize, nextCursor), nil
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	metadata.NextCursor = nextCursor
+
+	return workflows, metadata, nil
+}
 
+// GetWorkspaceId returns the id of the workspace the workflow belongs to.
+func (wm WorkflowModel) GetWorkspaceId(id string) (string, error) {
+	query := `SELECT workspace_id FROM workflows WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var workspaceId string
+
+	err := wm.DB.QueryRowxContext(ctx, query, id).Scan(&workspaceId)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return workspaceId, nil
+}
+
+// GetIdsWithTrigger returns the ids of the workflows that have a trigger
+// to poll.
+func (wm WorkflowModel) GetIdsWithTrigger() ([]string, error) {
+	query := `SELECT id FROM workflows WHERE trigger_id IS NOT NULL ORDER BY created_at, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	ids := []string{}
+
+	err := wm.DB.SelectContext(ctx, &ids, query)
+	if err != nil {
+		return nil, err
 	}
 
-	return workflows, Metadata{}, nil
+	return ids, nil
 }
 
 func (wm WorkflowModel) Delete(id string) error {
@@ -2,6 +2,7 @@ package data_test
 
 import (
 	"context"
+	"database/sql"
 	"math"
 	"testing"
 	"time"
@@ -25,13 +26,15 @@ func TestWorkflowInsert(t *testing.T) {
 		{
 			name: "Can Insert",
 			data: data.Workflow{
-				UserId: tests.Data.Users[0].Id,
-				Name:   "Flow 1",
+				UserId:      tests.Data.Users[0].Id,
+				WorkspaceId: tests.Data.Workspaces[0].Id,
+				Name:        "Flow 1",
 			},
 			wants: workflowTestResult{
 				workflow: data.Workflow{
-					UserId: tests.Data.Users[0].Id,
-					Name:   "Flow 1",
+					UserId:      tests.Data.Users[0].Id,
+					WorkspaceId: tests.Data.Workspaces[0].Id,
+					Name:        "Flow 1",
 				},
 				shouldError: false,
 			},
@@ -39,7 +42,18 @@ func TestWorkflowInsert(t *testing.T) {
 		{
 			name: "Missing UserId Should Error",
 			data: data.Workflow{
-				UserId: "",
+				UserId:      "",
+				WorkspaceId: tests.Data.Workspaces[0].Id,
+				Name:        "Flow 1",
+			},
+			wants: workflowTestResult{
+				shouldError: true,
+			},
+		},
+		{
+			name: "Missing WorkspaceId Should Error",
+			data: data.Workflow{
+				UserId: tests.Data.Users[0].Id,
 				Name:   "Flow 1",
 			},
 			wants: workflowTestResult{
@@ -49,8 +63,9 @@ func TestWorkflowInsert(t *testing.T) {
 		{
 			name: "Missing Name Should Error",
 			data: data.Workflow{
-				UserId: tests.Data.Users[0].Id,
-				Name:   "",
+				UserId:      tests.Data.Users[0].Id,
+				WorkspaceId: tests.Data.Workspaces[0].Id,
+				Name:        "",
 			},
 			wants: workflowTestResult{
 				shouldError: true,
@@ -76,7 +91,7 @@ func TestWorkflowInsert(t *testing.T) {
 
 			assert.NotEqual(t, tt.data.Id, "")
 
-			query := `SELECT * FROM workflows WHERE id = $1`
+			query := `SELECT id, user_id, workspace_id, name, trigger_id, error_workflow_id, tags, created_at, updated_at, version FROM workflows WHERE id = $1`
 
 			var workflow data.Workflow
 
@@ -89,6 +104,7 @@ func TestWorkflowInsert(t *testing.T) {
 
 			assert.Equal(t, tt.data.UserId, workflow.UserId)
 			assert.Equal(t, tt.data.Name, workflow.Name)
+			assert.Equal(t, tt.data.WorkspaceId, workflow.WorkspaceId)
 		})
 	}
 }
@@ -116,6 +132,25 @@ func TestWorkflowUpdate(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Can Set Error Workflow",
+			data: data.Workflow{
+				Id:              tests.Data.Workflows[0].Id,
+				UserId:          tests.Data.Workflows[0].UserId,
+				Name:            "User Onboarding",
+				ErrorWorkflowId: sql.NullString{String: tests.Data.Workflows[1].Id, Valid: true},
+				Version:         2,
+			},
+			wants: workflowTestResult{
+				workflow: data.Workflow{
+					Id:              tests.Data.Workflows[0].Id,
+					UserId:          tests.Data.Workflows[0].UserId,
+					Name:            "User Onboarding",
+					ErrorWorkflowId: sql.NullString{String: tests.Data.Workflows[1].Id, Valid: true},
+					Version:         3,
+				},
+			},
+		},
 	}
 
 	tests.SetupDb(db)
@@ -134,7 +169,7 @@ func TestWorkflowUpdate(t *testing.T) {
 
 			assert.NilError(t, err)
 
-			query := `SELECT * FROM workflows WHERE id = $1`
+			query := `SELECT id, user_id, name, trigger_id, error_workflow_id, tags, created_at, updated_at, version FROM workflows WHERE id = $1`
 
 			var workflow data.Workflow
 
@@ -147,6 +182,7 @@ func TestWorkflowUpdate(t *testing.T) {
 
 			assert.Equal(t, tt.data.UserId, workflow.UserId)
 			assert.Equal(t, tt.data.Name, workflow.Name)
+			assert.Equal(t, workflow.ErrorWorkflowId, tt.wants.workflow.ErrorWorkflowId)
 		})
 	}
 
@@ -247,7 +283,7 @@ func TestWorkflowDelete(t *testing.T) {
 
 			assert.NilError(t, err)
 
-			query := `SELECT * FROM workflows WHERE id = $1`
+			query := `SELECT id, user_id, name, trigger_id, error_workflow_id, tags, created_at, updated_at, version FROM workflows WHERE id = $1`
 
 			var workflow data.Workflow
 
@@ -263,8 +299,9 @@ func TestWorkflowDelete(t *testing.T) {
 
 func TestWorkflowGetAll(t *testing.T) {
 	type params struct {
-		userId  string
-		filters data.Filters
+		userId          string
+		workflowFilters data.WorkflowFilters
+		filters         data.Filters
 	}
 
 	type getAllWorkflowsTestResult struct {
@@ -285,7 +322,7 @@ func TestWorkflowGetAll(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			model := data.WorkflowModel{DB: db}
 
-			workflows, metadata, err := model.GetAll(tt.data.userId, tt.data.filters)
+			workflows, metadata, err := model.GetAll(tt.data.userId, tt.data.workflowFilters, tt.data.filters)
 
 			if tt.wants.shouldError {
 				assert.Error(t, err)
@@ -331,3 +368,72 @@ func TestWorkflowGetAll(t *testing.T) {
 		})
 	}
 }
+
+func TestWorkflowGetAllFilters(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.WorkflowModel{DB: db}
+	runs := data.WorkflowRunModel{DB: db}
+
+	userId := tests.Data.Users[0].Id
+	onboarding := tests.Data.Workflows[0]
+
+	reports := data.Workflow{UserId: userId, WorkspaceId: onboarding.WorkspaceId, Name: "Weekly_Reports"}
+	assert.NilError(t, model.Insert(&reports))
+
+	reports.Tags = []string{"reports", "weekly"}
+	assert.NilError(t, model.Update(&reports))
+
+	run := data.WorkflowRun{WorkflowId: onboarding.Id, Status: data.RunStatusFailed}
+	assert.NilError(t, runs.Insert(&run))
+
+	filters := data.Filters{Page: 1, PageSize: 20, Sort: "name", SortSafeList: []string{"name", "-last_run_at"}}
+
+	workflows, metadata, err := model.GetAll(userId, data.WorkflowFilters{}, filters)
+	assert.NilError(t, err)
+	assert.Equal(t, len(workflows), 2)
+	assert.Equal(t, workflows[0].Id, onboarding.Id)
+	assert.Equal(t, len(workflows[0].Actions), 2)
+	assert.Equal(t, workflows[0].LastRunStatus, data.RunStatusFailed)
+	assert.Equal(t, metadata.TotalRecords, 2)
+	assert.Equal(t, metadata.NextCursor, "")
+
+	workflows, _, err = model.GetAll(userId, data.WorkflowFilters{Name: "_"}, filters)
+	assert.NilError(t, err)
+	assert.Equal(t, len(workflows), 1)
+	assert.Equal(t, workflows[0].Id, reports.Id)
+
+	workflows, _, err = model.GetAll(userId, data.WorkflowFilters{Providers: []string{"system"}}, filters)
+	assert.NilError(t, err)
+	assert.Equal(t, len(workflows), 1)
+	assert.Equal(t, workflows[0].Id, onboarding.Id)
+
+	workflows, _, err = model.GetAll(userId, data.WorkflowFilters{Statuses: []string{data.RunStatusSucceeded}}, filters)
+	assert.NilError(t, err)
+	assert.Equal(t, len(workflows), 0)
+
+	workflows, _, err = model.GetAll(userId, data.WorkflowFilters{Tags: []string{"weekly", "reports"}}, filters)
+	assert.NilError(t, err)
+	assert.Equal(t, len(workflows), 1)
+	assert.Equal(t, workflows[0].Id, reports.Id)
+
+	filters.Sort = "-last_run_at"
+	filters.PageSize = 1
+
+	workflows, metadata, err = model.GetAll(userId, data.WorkflowFilters{}, filters)
+	assert.NilError(t, err)
+	assert.Equal(t, len(workflows), 1)
+	assert.Equal(t, workflows[0].Id, onboarding.Id)
+	assert.Equal(t, metadata.LastPage, 2)
+	assert.NotEqual(t, metadata.NextCursor, "")
+
+	filters.Cursor = metadata.NextCursor
+
+	workflows, metadata, err = model.GetAll(userId, data.WorkflowFilters{}, filters)
+	assert.NilError(t, err)
+	assert.Equal(t, len(workflows), 1)
+	assert.Equal(t, workflows[0].Id, reports.Id)
+	assert.Equal(t, metadata.TotalRecords, 2)
+	assert.Equal(t, metadata.NextCursor, "")
+}
@@ -0,0 +1,524 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/luisya22/confluo/backend/internal/validator"
+)
+
+var ErrLastOwner = errors.New("a workspace must keep an owner")
+
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleRunner = "runner"
+	RoleViewer = "viewer"
+)
+
+var Roles = []string{RoleOwner, RoleAdmin, RoleEditor, RoleRunner, RoleViewer}
+
+// Permissions are what a member can do in a workspace. View covers reading
+// everything in it; Run covers starting, cancelling and re-running runs,
+// deciding approvals, requeueing dead letters and redelivering webhooks;
+// Edit covers changing workflows and connections.
+const (
+	PermissionView            = "view"
+	PermissionRun             = "run"
+	PermissionEdit            = "edit"
+	PermissionManageMembers   = "manage_members"
+	PermissionManageWorkspace = "manage_workspace"
+)
+
+const ScopeWorkspaceInvitation = "workspace_invitation"
+
+var rolePermissions = map[string][]string{
+	RoleOwner:  {PermissionView, PermissionRun, PermissionEdit, PermissionManageMembers, PermissionManageWorkspace},
+	RoleAdmin:  {PermissionView, PermissionRun, PermissionEdit, PermissionManageMembers},
+	RoleEditor: {PermissionView, PermissionRun, PermissionEdit},
+	RoleRunner: {PermissionView, PermissionRun},
+	RoleViewer: {PermissionView},
+}
+
+// RoleCan reports whether the role has the permission. An empty role, the
+// role of someone who isn't a member, has none.
+func RoleCan(role string, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RolesWith returns the roles that have the permission.
+func RolesWith(permission string) []string {
+	roles := []string{}
+
+	for _, role := range Roles {
+		if RoleCan(role, permission) {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles
+}
+
+// Workspace groups the workflows and connections a team shares. Role is the
+// role of the user the workspace was loaded for.
+type Workspace struct {
+	Id        string    `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	Role      string    `db:"-" json:"role,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+	UpdatedAt time.Time `db:"updated_at" json:"-"`
+	Version   int       `db:"version" json:"version"`
+}
+
+type WorkspaceMember struct {
+	WorkspaceId string    `db:"workspace_id" json:"workspaceId"`
+	UserId      string    `db:"user_id" json:"userId"`
+	Role        string    `db:"role" json:"role"`
+	GithubLogin string    `db:"github_login" json:"githubLogin"`
+	Name        string    `db:"name" json:"name"`
+	AvatarUrl   string    `db:"avatar_url" json:"avatarUrl"`
+	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
+}
+
+// WorkspaceInvitation lets whoever has its token join the workspace with
+// its role. Only the hash of the token is stored, so the plaintext is only
+// there when the invitation has just been created.
+type WorkspaceInvitation struct {
+	Id          string         `db:"id" json:"id"`
+	WorkspaceId string         `db:"workspace_id" json:"workspaceId"`
+	Plaintext   string         `db:"-" json:"token,omitempty"`
+	Hash        []byte         `db:"hash" json:"-"`
+	Email       string         `db:"email" json:"email"`
+	Role        string         `db:"role" json:"role"`
+	InvitedBy   sql.NullString `db:"invited_by" json:"invitedBy"`
+	Expiry      time.Time      `db:"expiry" json:"expiry"`
+	CreatedAt   time.Time      `db:"created_at" json:"createdAt"`
+}
+
+func ValidateWorkspace(v *validator.Validator, ws *Workspace) {
+	v.Check(ws.Name != "", "name", "must be provided")
+	v.Check(len(ws.Name) <= 50, "name", "must not be more than 50 bytes long")
+}
+
+func ValidateRole(v *validator.Validator, role string) {
+	v.Check(role != "", "role", "must be provided")
+	v.Check(validator.PermittedValue(role, Roles...), "role", "invalid role value")
+}
+
+type WorkspaceModel struct {
+	DB *sqlx.DB
+}
+
+// Insert creates the workspace with ownerId as its owner.
+func (model WorkspaceModel) Insert(ws *Workspace, ownerId string) error {
+	if ownerId == "" {
+		return fmt.Errorf("owner id cannot be empty")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := model.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO workspaces (name) VALUES ($1) RETURNING id, created_at, updated_at, version`
+
+	err = tx.QueryRowxContext(ctx, query, ws.Name).Scan(&ws.Id, &ws.CreatedAt, &ws.UpdatedAt, &ws.Version)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, $3)`
+
+	_, err = tx.ExecContext(ctx, query, ws.Id, ownerId, RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	ws.Role = RoleOwner
+
+	return tx.Commit()
+}
+
+// InsertPersonal creates a personal workspace for a user that doesn't
+// belong to any, so everyone has somewhere to keep their workflows.
+func (model WorkspaceModel) InsertPersonal(userId string) error {
+	query := `WITH workspace AS (
+			INSERT INTO workspaces (name)
+			SELECT 'Personal'
+			WHERE NOT EXISTS (SELECT 1 FROM workspace_members WHERE user_id = $1)
+			RETURNING id
+		)
+		INSERT INTO workspace_members (workspace_id, user_id, role)
+		SELECT id, $1, $2 FROM workspace`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := model.DB.ExecContext(ctx, query, userId, RoleOwner)
+
+	return err
+}
+
+// Get returns the workspace with the role userId has in it.
+func (model WorkspaceModel) Get(id string, userId string) (*Workspace, error) {
+	query := `SELECT ws.id, ws.name, COALESCE(m.role, ''), ws.created_at, ws.updated_at, ws.version
+		FROM workspaces ws
+		LEFT JOIN workspace_members m ON m.workspace_id = ws.id AND m.user_id = $2
+		WHERE ws.id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var ws Workspace
+
+	err := model.DB.QueryRowxContext(ctx, query, id, userId).Scan(
+		&ws.Id,
+		&ws.Name,
+		&ws.Role,
+		&ws.CreatedAt,
+		&ws.UpdatedAt,
+		&ws.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &ws, nil
+}
+
+// GetAllForUser lists the workspaces the user belongs to, oldest first.
+func (model WorkspaceModel) GetAllForUser(userId string) ([]*Workspace, error) {
+	query := `SELECT ws.id, ws.name, m.role, ws.created_at, ws.updated_at, ws.version
+		FROM workspaces ws
+		INNER JOIN workspace_members m ON m.workspace_id = ws.id
+		WHERE m.user_id = $1
+		ORDER BY ws.created_at, ws.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryxContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workspaces := []*Workspace{}
+
+	for rows.Next() {
+		var ws Workspace
+
+		err := rows.Scan(&ws.Id, &ws.Name, &ws.Role, &ws.CreatedAt, &ws.UpdatedAt, &ws.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		workspaces = append(workspaces, &ws)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return workspaces, nil
+}
+
+func (model WorkspaceModel) Update(ws *Workspace) error {
+	query := `UPDATE workspaces SET
+			name = $1,
+			updated_at = now(),
+			version = version + 1
+		WHERE id = $2
+		AND version = $3
+		RETURNING updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := model.DB.QueryRowxContext(ctx, query, ws.Name, ws.Id, ws.Version).Scan(&ws.UpdatedAt, &ws.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetRole returns the role of the user in the workspace. It returns
+// ErrRecordNotFound when the user isn't a member.
+func (model WorkspaceModel) GetRole(workspaceId string, userId string) (string, error) {
+	query := `SELECT role FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var role string
+
+	err := model.DB.QueryRowxContext(ctx, query, workspaceId, userId).Scan(&role)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return role, nil
+}
+
+func (model WorkspaceModel) GetMembers(workspaceId string) ([]*WorkspaceMember, error) {
+	query := `SELECT m.workspace_id, m.user_id, m.role, COALESCE(u.github_login, '') AS github_login, u.name, u.avatar_url, m.created_at
+		FROM workspace_members m
+		INNER JOIN users u ON m.user_id = u.id
+		WHERE m.workspace_id = $1
+		ORDER BY m.created_at, m.user_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	members := []*WorkspaceMember{}
+
+	err := model.DB.SelectContext(ctx, &members, query, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// SetRole changes the role of a member. It returns ErrRecordNotFound when
+// the user isn't a member and ErrLastOwner when the member is the only
+// owner left.
+func (model WorkspaceModel) SetRole(workspaceId string, userId string, role string) error {
+	return model.changeMember(workspaceId, userId, role,
+		`UPDATE workspace_members SET role = $3 WHERE workspace_id = $1 AND user_id = $2`)
+}
+
+// RemoveMember takes the user out of the workspace. What the user made in
+// it stays there. It returns ErrRecordNotFound when the user isn't a member
+// and ErrLastOwner when the member is the only owner left.
+func (model WorkspaceModel) RemoveMember(workspaceId string, userId string) error {
+	return model.changeMember(workspaceId, userId, "",
+		`DELETE FROM workspace_members WHERE workspace_id = $1 AND user_id = $2`)
+}
+
+// changeMember runs query, which gives the member role or removes the
+// member when role is empty, unless the workspace would be left without
+// an owner.
+func (model WorkspaceModel) changeMember(workspaceId string, userId string, role string, query string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := model.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the members so two owners can't step down at the same time.
+	var roles []struct {
+		UserId string `db:"user_id"`
+		Role   string `db:"role"`
+	}
+
+	err = tx.SelectContext(ctx, &roles, `SELECT user_id, role FROM workspace_members WHERE workspace_id = $1 FOR UPDATE`, workspaceId)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	otherOwners := 0
+
+	for _, member := range roles {
+		switch {
+		case member.UserId == userId:
+			found = true
+		case member.Role == RoleOwner:
+			otherOwners++
+		}
+	}
+
+	if !found {
+		return ErrRecordNotFound
+	}
+
+	if role != RoleOwner && otherOwners == 0 {
+		return ErrLastOwner
+	}
+
+	args := []any{workspaceId, userId}
+	if role != "" {
+		args = append(args, role)
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Invite creates an invitation to join the workspace with the role that
+// expires after ttl.
+func (model WorkspaceModel) Invite(workspaceId string, email string, role string, invitedBy string, ttl time.Duration) (*WorkspaceInvitation, error) {
+	token, err := generateToken(invitedBy, ttl, ScopeWorkspaceInvitation)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := &WorkspaceInvitation{
+		WorkspaceId: workspaceId,
+		Plaintext:   token.Plaintext,
+		Hash:        token.Hash,
+		Email:       email,
+		Role:        role,
+		InvitedBy:   sql.NullString{String: invitedBy, Valid: invitedBy != ""},
+		Expiry:      token.Expiry,
+	}
+
+	query := `INSERT INTO workspace_invitations (workspace_id, hash, email, role, invited_by, expiry)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = model.DB.QueryRowxContext(
+		ctx,
+		query,
+		invitation.WorkspaceId,
+		invitation.Hash,
+		invitation.Email,
+		invitation.Role,
+		invitation.InvitedBy,
+		invitation.Expiry,
+	).Scan(&invitation.Id, &invitation.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+// GetInvitations lists the invitations of the workspace that haven't
+// expired, newest first.
+func (model WorkspaceModel) GetInvitations(workspaceId string) ([]*WorkspaceInvitation, error) {
+	query := `SELECT id, workspace_id, hash, email, role, invited_by, expiry, created_at
+		FROM workspace_invitations
+		WHERE workspace_id = $1
+		AND expiry > now()
+		ORDER BY created_at DESC, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	invitations := []*WorkspaceInvitation{}
+
+	err := model.DB.SelectContext(ctx, &invitations, query, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// DeleteInvitation revokes an invitation of the workspace.
+func (model WorkspaceModel) DeleteInvitation(workspaceId string, id string) error {
+	query := `DELETE FROM workspace_invitations WHERE id = $1 AND workspace_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := model.DB.ExecContext(ctx, query, id, workspaceId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// AcceptInvitation adds the user to the workspace of the invitation and
+// uses the invitation up. A user that is already a member keeps their role.
+// It returns ErrRecordNotFound when the token doesn't belong to an
+// invitation that is still valid.
+func (model WorkspaceModel) AcceptInvitation(tokenPlaintext string, userId string) (*Workspace, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := model.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var workspaceId, role string
+
+	query := `DELETE FROM workspace_invitations
+		WHERE hash = $1
+		AND expiry > now()
+		RETURNING workspace_id, role`
+
+	err = tx.QueryRowxContext(ctx, query, tokenHash[:]).Scan(&workspaceId, &role)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `INSERT INTO workspace_members (workspace_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (workspace_id, user_id) DO NOTHING`
+
+	_, err = tx.ExecContext(ctx, query, workspaceId, userId, role)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return model.Get(workspaceId, userId)
+}
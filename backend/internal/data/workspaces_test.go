@@ -0,0 +1,81 @@
+package data_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/tests"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestWorkspaces(t *testing.T) {
+	tests.SetupDb(db)
+	defer tests.TeardownDb(db)
+
+	model := data.WorkspaceModel{DB: db}
+
+	ownerId := tests.Data.Users[0].Id
+	memberId := tests.Data.Users[1].Id
+
+	workspace := data.Workspace{Name: "Platform"}
+	assert.NilError(t, model.Insert(&workspace, ownerId))
+	assert.NotEqual(t, workspace.Id, "")
+	assert.Equal(t, workspace.Role, data.RoleOwner)
+
+	_, err := model.GetRole(workspace.Id, memberId)
+	assert.Equal(t, errors.Is(err, data.ErrRecordNotFound), true)
+
+	invitation, err := model.Invite(workspace.Id, "dev@example.com", data.RoleViewer, ownerId, time.Hour)
+	assert.NilError(t, err)
+	assert.NotEqual(t, invitation.Plaintext, "")
+
+	invitations, err := model.GetInvitations(workspace.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(invitations), 1)
+
+	joined, err := model.AcceptInvitation(invitation.Plaintext, memberId)
+	assert.NilError(t, err)
+	assert.Equal(t, joined.Id, workspace.Id)
+	assert.Equal(t, joined.Role, data.RoleViewer)
+
+	_, err = model.AcceptInvitation(invitation.Plaintext, memberId)
+	assert.Equal(t, errors.Is(err, data.ErrRecordNotFound), true)
+
+	members, err := model.GetMembers(workspace.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(members), 2)
+
+	workspaces, err := model.GetAllForUser(memberId)
+	assert.NilError(t, err)
+	assert.Equal(t, len(workspaces), 2)
+
+	err = model.SetRole(workspace.Id, ownerId, data.RoleAdmin)
+	assert.Equal(t, errors.Is(err, data.ErrLastOwner), true)
+
+	err = model.RemoveMember(workspace.Id, ownerId)
+	assert.Equal(t, errors.Is(err, data.ErrLastOwner), true)
+
+	assert.NilError(t, model.SetRole(workspace.Id, memberId, data.RoleOwner))
+	assert.NilError(t, model.RemoveMember(workspace.Id, ownerId))
+
+	role, err := model.GetRole(workspace.Id, memberId)
+	assert.NilError(t, err)
+	assert.Equal(t, role, data.RoleOwner)
+
+	err = model.RemoveMember(workspace.Id, ownerId)
+	assert.Equal(t, errors.Is(err, data.ErrRecordNotFound), true)
+}
+
+func TestRoleCan(t *testing.T) {
+	assert.Equal(t, data.RoleCan(data.RoleOwner, data.PermissionManageWorkspace), true)
+	assert.Equal(t, data.RoleCan(data.RoleAdmin, data.PermissionManageMembers), true)
+	assert.Equal(t, data.RoleCan(data.RoleAdmin, data.PermissionManageWorkspace), false)
+	assert.Equal(t, data.RoleCan(data.RoleEditor, data.PermissionEdit), true)
+	assert.Equal(t, data.RoleCan(data.RoleRunner, data.PermissionRun), true)
+	assert.Equal(t, data.RoleCan(data.RoleRunner, data.PermissionEdit), false)
+	assert.Equal(t, data.RoleCan(data.RoleViewer, data.PermissionView), true)
+	assert.Equal(t, data.RoleCan(data.RoleViewer, data.PermissionRun), false)
+	assert.Equal(t, data.RoleCan("", data.PermissionView), false)
+}
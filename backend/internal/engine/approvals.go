@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/providers/system"
+	"github.com/luisya22/confluo/backend/internal/validator"
+)
+
+// paramPendingApproval marks a run parked on an approval so the approval
+// step knows, when the run is resumed, that it has to act on the decision
+// instead of asking again. QueueDue also uses it to find runs whose
+// approval was decided before they were saved as waiting.
+const paramPendingApproval = data.ParamPendingApproval
+
+// approvalStep pauses the run until someone approves or rejects it. The run
+// stays on this step while it waits; when it is resumed, either by a
+// decision or by the expiry timer, the step runs again and sends the run
+// down the approve or the reject branch.
+//
+// Params:
+//   - assignees: user ids allowed to decide. They have to be members of the
+//     workspace. Without assignees, the members with the run permission
+//     decide.
+//   - expiresIn / expiresAt: when the approval expires. Expired approvals
+//     take the reject branch.
+//   - rejectActionId: the step to run when rejected or expired. Without it
+//     the run fails.
+func (e *Engine) approvalStep(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, step *data.WorkflowAction) (stepResult, error) {
+	if e.dry != nil {
+		return e.dryApproval(run, workflow, step), nil
+	}
+
+	if id, ok := run.Params[paramPendingApproval].(string); ok && id != "" {
+		return e.resolveApproval(ctx, run, workflow, step, id)
+	}
+
+	input := stepInput(run.Params, workflow, step)
+	startedAt := time.Now()
+
+	approval, err := newApproval(run, step, input)
+	if err == nil {
+		err = e.models.Approvals.Insert(approval)
+	}
+
+	if err != nil {
+		e.recordStep(run, step, data.RunStatusFailed, input, nil, err, startedAt)
+		return stepResult{}, err
+	}
+
+	output := map[string]interface{}{"approvalId": approval.Id}
+	e.recordStep(run, step, data.RunStatusWaiting, input, output, nil, startedAt)
+
+	params := copyParams(run.Params)
+	params[paramPendingApproval] = approval.Id
+
+	return stepResult{
+		params:   params,
+		next:     nullString(step.Id),
+		suspend:  true,
+		resumeAt: approval.ExpiresAt,
+	}, nil
+}
+
+func (e *Engine) resolveApproval(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, step *data.WorkflowAction, id string) (stepResult, error) {
+	startedAt := time.Now()
+
+	approval, err := e.models.Approvals.Get(id)
+	if err != nil {
+		return stepResult{}, fmt.Errorf("approval %s: %w", id, err)
+	}
+
+	if approval.Status == data.ApprovalStatusPending {
+		if !approval.Expired(time.Now()) {
+			return stepResult{
+				params:   run.Params,
+				next:     nullString(step.Id),
+				suspend:  true,
+				resumeAt: approval.ExpiresAt,
+			}, nil
+		}
+
+		approval, err = e.expireApproval(approval)
+		if err != nil {
+			return stepResult{}, err
+		}
+	}
+
+	params := copyParams(run.Params)
+	delete(params, paramPendingApproval)
+
+	params["approvalId"] = approval.Id
+	params["approvalStatus"] = approval.Status
+	params["approvalComment"] = approval.Comment
+	params["approvalDecidedBy"] = approval.DecidedBy.String
+
+	output := map[string]interface{}{
+		"approvalId":        approval.Id,
+		"approvalStatus":    approval.Status,
+		"approvalComment":   approval.Comment,
+		"approvalDecidedBy": approval.DecidedBy.String,
+	}
+
+	input := stepInput(run.Params, workflow, step)
+	delete(input, paramPendingApproval)
+
+	if approval.Status == data.ApprovalStatusApproved {
+		e.recordStep(run, step, data.RunStatusSucceeded, input, output, nil, startedAt)
+		return stepResult{params: params, next: step.NextActionId}, nil
+	}
+
+	rejectActionId, _ := step.Params["rejectActionId"].(string)
+	if rejectActionId == "" {
+		err := fmt.Errorf("approval %s was %s", approval.Id, approval.Status)
+		e.recordStep(run, step, data.RunStatusFailed, input, output, err, startedAt)
+		return stepResult{}, err
+	}
+
+	e.recordStep(run, step, data.RunStatusSucceeded, input, output, nil, startedAt)
+
+	return stepResult{params: params, next: nullString(rejectActionId)}, nil
+}
+
+// expireApproval marks an approval as expired. A decision that lands at the
+// same moment wins.
+func (e *Engine) expireApproval(approval *data.Approval) (*data.Approval, error) {
+	err := e.models.Approvals.Expire(approval)
+	if errors.Is(err, data.ErrEditConflict) {
+		return e.models.Approvals.Get(approval.Id)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return approval, nil
+}
+
+func newApproval(run *data.WorkflowRun, step *data.WorkflowAction, params map[string]interface{}) (*data.Approval, error) {
+	approval := &data.Approval{
+		RunId:            run.Id,
+		WorkflowActionId: nullString(step.Id),
+		Assignees:        []string{},
+	}
+
+	switch v := params["assignees"].(type) {
+	case nil:
+	case string:
+		approval.Assignees = append(approval.Assignees, v)
+	case []interface{}:
+		for _, assignee := range v {
+			s, ok := assignee.(string)
+			if !ok {
+				return nil, fmt.Errorf("assignees must be a list of user ids")
+			}
+
+			approval.Assignees = append(approval.Assignees, s)
+		}
+	default:
+		return nil, fmt.Errorf("assignees must be a list of user ids")
+	}
+
+	for _, assignee := range approval.Assignees {
+		if !validator.Matches(assignee, validator.UUIDRX) {
+			return nil, fmt.Errorf("assignee %q is not a valid user id", assignee)
+		}
+	}
+
+	expiresAt, hasExpiresAt, err := system.TimeParam(params, "expiresAt")
+	if err != nil {
+		return nil, err
+	}
+
+	expiresIn, hasExpiresIn, err := system.DurationParam(params, "expiresIn")
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case hasExpiresAt:
+		approval.ExpiresAt = &expiresAt
+	case hasExpiresIn:
+		if expiresIn <= 0 {
+			return nil, fmt.Errorf("expiresIn must be positive")
+		}
+
+		t := time.Now().Add(expiresIn)
+		approval.ExpiresAt = &t
+	}
+
+	return approval, nil
+}
@@ -0,0 +1,355 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+)
+
+const (
+	maxCallDepth = 5
+
+	// childPollInterval is how often a parent waiting on a child checks on
+	// it, in case the child finished without waking the parent up.
+	childPollInterval = time.Minute
+)
+
+// paramPendingChildRun marks a run parked on a child run so the Call
+// Workflow step knows, when the run is resumed, that it has to collect the
+// child's outputs instead of starting another child.
+const paramPendingChildRun = "pendingChildRunId"
+
+// callWorkflowStep starts a run of another workflow of the same workspace.
+// In sync mode the run waits on this step until the child finishes and then
+// gets the child's final params; a failed child fails the step. In async
+// mode the run goes on right away.
+//
+// Params:
+//   - workflowId: the workflow to run.
+//   - inputs: the child params, each one naming the param of this run it
+//     takes its value from. Nested params are reached with dots.
+//   - mode: "sync" (default) or "async".
+//   - outputKey: the param the child's outputs are stored in. Defaults to
+//     "childOutputs".
+func (e *Engine) callWorkflowStep(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, step *data.WorkflowAction) (stepResult, error) {
+	if e.dry != nil {
+		return e.dryCallWorkflow(ctx, run, workflow, step)
+	}
+
+	if id, ok := run.Params[paramPendingChildRun].(string); ok && id != "" {
+		return e.collectChildRun(ctx, run, workflow, step, id)
+	}
+
+	input := stepInput(run.Params, workflow, step)
+	startedAt := time.Now()
+
+	child, async, err := e.newChildRun(ctx, run, workflow, input)
+	if err == nil {
+		err = e.models.Runs.Insert(child)
+	}
+
+	if err != nil {
+		e.recordStep(run, step, data.RunStatusFailed, input, nil, err, startedAt)
+		return stepResult{}, err
+	}
+
+	output := map[string]interface{}{"childRunId": child.Id}
+
+	if async {
+		e.recordStep(run, step, data.RunStatusSucceeded, input, output, nil, startedAt)
+
+		params := copyParams(run.Params)
+		params["childRunId"] = child.Id
+
+		return stepResult{params: params, next: step.NextActionId}, nil
+	}
+
+	e.recordStep(run, step, data.RunStatusWaiting, input, output, nil, startedAt)
+
+	params := copyParams(run.Params)
+	params[paramPendingChildRun] = child.Id
+
+	resumeAt := time.Now().Add(childPollInterval)
+
+	return stepResult{
+		params:   params,
+		next:     nullString(step.Id),
+		suspend:  true,
+		resumeAt: &resumeAt,
+	}, nil
+}
+
+// newChildRun builds the run a Call Workflow step starts and reports
+// whether the step goes on without waiting for it.
+func (e *Engine) newChildRun(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, params map[string]interface{}) (*data.WorkflowRun, bool, error) {
+	if run.Depth+1 > maxCallDepth {
+		return nil, false, fmt.Errorf("workflow calls can't be nested more than %d deep", maxCallDepth)
+	}
+
+	var async bool
+
+	switch mode, _ := params["mode"].(string); mode {
+	case "", "sync":
+	case "async":
+		async = true
+	default:
+		return nil, false, fmt.Errorf("mode must be sync or async")
+	}
+
+	workflowId, _ := params["workflowId"].(string)
+	if workflowId == "" {
+		return nil, false, fmt.Errorf("workflowId not found")
+	}
+
+	target, err := e.models.Workflows.Get(workflowId)
+	if err != nil {
+		return nil, false, fmt.Errorf("workflow %s: %w", workflowId, err)
+	}
+
+	if target.WorkspaceId != workflow.WorkspaceId {
+		return nil, false, fmt.Errorf("workflow %s: %w", workflowId, data.ErrRecordNotFound)
+	}
+
+	first, err := firstStep(target)
+	if err != nil {
+		return nil, false, err
+	}
+
+	inputs := map[string]interface{}{}
+
+	switch mapping := params["inputs"].(type) {
+	case nil:
+	case map[string]interface{}:
+		for key, source := range mapping {
+			name, ok := source.(string)
+			if !ok {
+				return nil, false, fmt.Errorf("input %s must name a param", key)
+			}
+
+			value, ok := lookupParam(run.Params, name)
+			if !ok {
+				return nil, false, fmt.Errorf("input %s: param %q not found", key, name)
+			}
+
+			inputs[key] = value
+		}
+	default:
+		return nil, false, fmt.Errorf("inputs must map child params to params of this run")
+	}
+
+	child := &data.WorkflowRun{
+		WorkflowId:   target.Id,
+		ParentRunId:  nullString(run.Id),
+		Depth:        run.Depth + 1,
+		Status:       data.RunStatusQueued,
+		Params:       inputs,
+		NextActionId: first,
+		TraceContext: traceContext(ctx),
+	}
+
+	return child, async, nil
+}
+
+func (e *Engine) collectChildRun(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, step *data.WorkflowAction, id string) (stepResult, error) {
+	startedAt := time.Now()
+
+	child, err := e.models.Runs.Get(id)
+	if err != nil {
+		return stepResult{}, fmt.Errorf("child run %s: %w", id, err)
+	}
+
+	switch child.Status {
+	case data.RunStatusSucceeded, data.RunStatusFailed, data.RunStatusCancelled:
+	default:
+		resumeAt := time.Now().Add(childPollInterval)
+
+		return stepResult{
+			params:   run.Params,
+			next:     nullString(step.Id),
+			suspend:  true,
+			resumeAt: &resumeAt,
+		}, nil
+	}
+
+	input := stepInput(run.Params, workflow, step)
+	delete(input, paramPendingChildRun)
+
+	output := map[string]interface{}{
+		"childRunId":  child.Id,
+		"childStatus": child.Status,
+	}
+
+	if child.Status != data.RunStatusSucceeded {
+		err := fmt.Errorf("child run %s %s", child.Id, child.Status)
+		if child.Error != "" {
+			err = fmt.Errorf("%w: %s", err, child.Error)
+		}
+
+		e.recordStep(run, step, data.RunStatusFailed, input, output, err, startedAt)
+		return stepResult{}, err
+	}
+
+	outputKey, _ := step.Params["outputKey"].(string)
+	if outputKey == "" {
+		outputKey = "childOutputs"
+	}
+
+	output[outputKey] = child.Params
+
+	e.recordStep(run, step, data.RunStatusSucceeded, input, output, nil, startedAt)
+
+	params := copyParams(run.Params)
+	delete(params, paramPendingChildRun)
+
+	for k, v := range output {
+		params[k] = v
+	}
+
+	return stepResult{params: params, next: step.NextActionId}, nil
+}
+
+// wakeParent queues the run that is waiting on a child that just finished.
+func (e *Engine) wakeParent(child *data.WorkflowRun) {
+	if !child.ParentRunId.Valid {
+		return
+	}
+
+	parent, err := e.models.Runs.Get(child.ParentRunId.String)
+	if err != nil {
+		e.logger.Error(err.Error(), "run_id", child.Id)
+		return
+	}
+
+	if pending, _ := parent.Params[paramPendingChildRun].(string); pending != child.Id {
+		return
+	}
+
+	err = e.models.Runs.Resume(parent.Id)
+	if err != nil && !errors.Is(err, data.ErrEditConflict) {
+		e.logger.Error(err.Error(), "run_id", parent.Id)
+	}
+}
+
+// firstStep finds where a run of the workflow starts: after its trigger or,
+// without one, at the step no other step leads to.
+func firstStep(workflow *data.Workflow) (sql.NullString, error) {
+	if workflow.TriggerId.Valid {
+		trigger, ok := findAction(workflow, workflow.TriggerId.String)
+		if !ok {
+			return sql.NullString{}, fmt.Errorf("trigger %s not found", workflow.TriggerId.String)
+		}
+
+		return trigger.NextActionId, nil
+	}
+
+	targets := make(map[string]bool)
+
+	for _, a := range workflow.Actions {
+		if a.NextActionId.Valid {
+			targets[a.NextActionId.String] = true
+		}
+
+		for _, b := range a.Branches {
+			targets[b.NextActionId] = true
+		}
+
+		if a.ErrorActionId.Valid {
+			targets[a.ErrorActionId.String] = true
+		}
+
+		for _, key := range []string{"bodyActionId", "rejectActionId"} {
+			if id, ok := a.Params[key].(string); ok {
+				targets[id] = true
+			}
+		}
+	}
+
+	var first sql.NullString
+
+	for _, a := range workflow.Actions {
+		if a.Id == "" || targets[a.Id] {
+			continue
+		}
+
+		if first.Valid {
+			return sql.NullString{}, fmt.Errorf("workflow %s has more than one first step", workflow.Id)
+		}
+
+		first = nullString(a.Id)
+	}
+
+	if !first.Valid {
+		return sql.NullString{}, fmt.Errorf("workflow %s has no first step", workflow.Id)
+	}
+
+	return first, nil
+}
+
+// startErrorHandler starts the error-handler workflow of the failed run's
+// workflow, passing the failed run's context in the failedRun param. The
+// handler run is linked to the failed run like a called workflow, which also
+// keeps handlers that fail from setting each other off forever.
+func (e *Engine) startErrorHandler(ctx context.Context, run *data.WorkflowRun, failedActionId sql.NullString) {
+	workflow, err := e.models.Workflows.Get(run.WorkflowId)
+	if err != nil {
+		e.logger.Error(err.Error(), "run_id", run.Id)
+		return
+	}
+
+	if !workflow.ErrorWorkflowId.Valid || workflow.ErrorWorkflowId.String == workflow.Id {
+		return
+	}
+
+	if run.Depth+1 > maxCallDepth {
+		e.logger.Warn("error handler not started, calls nested too deep", "run_id", run.Id)
+		return
+	}
+
+	handler, err := e.models.Workflows.Get(workflow.ErrorWorkflowId.String)
+	if err != nil {
+		e.logger.Error(err.Error(), "run_id", run.Id, "workflow_id", workflow.ErrorWorkflowId.String)
+		return
+	}
+
+	if handler.WorkspaceId != workflow.WorkspaceId {
+		e.logger.Warn("error handler not started, it belongs to another workspace", "run_id", run.Id)
+		return
+	}
+
+	first, err := firstStep(handler)
+	if err != nil {
+		e.logger.Error(err.Error(), "run_id", run.Id)
+		return
+	}
+
+	failedRun := map[string]interface{}{
+		"runId":        run.Id,
+		"workflowId":   workflow.Id,
+		"workflowName": workflow.Name,
+		"stepId":       failedActionId.String,
+		"error":        run.Error,
+		"params":       run.Params,
+	}
+
+	handlerRun := &data.WorkflowRun{
+		WorkflowId:   handler.Id,
+		ParentRunId:  nullString(run.Id),
+		Depth:        run.Depth + 1,
+		Status:       data.RunStatusQueued,
+		Params:       map[string]interface{}{"failedRun": failedRun},
+		NextActionId: first,
+		TraceContext: traceContext(ctx),
+	}
+
+	err = e.models.Runs.Insert(handlerRun)
+	if err != nil {
+		e.logger.Error(err.Error(), "run_id", run.Id)
+		return
+	}
+
+	e.logger.Info("error handler started", "run_id", run.Id, "handler_run_id", handlerRun.Id)
+}
@@ -0,0 +1,310 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/executor"
+	"github.com/luisya22/confluo/backend/internal/tests"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+type callTestResult struct {
+	err      string
+	notFound bool
+	async    bool
+}
+
+// callStep returns a Call Workflow step for the seeded "User Onboarding"
+// workflow. It takes the id of the workflow's Update step so the steps it
+// records point to a step that exists.
+func callStep(params map[string]interface{}) *data.WorkflowAction {
+	step := systemStep(tests.Data.WorkflowActions[1].Id, "Call Workflow", "", params)
+	return &step
+}
+
+// insertParent inserts the run that calls another workflow.
+func insertParent(t *testing.T, e *Engine, depth int) *data.WorkflowRun {
+	t.Helper()
+
+	run := &data.WorkflowRun{
+		WorkflowId: tests.Data.Workflows[0].Id,
+		Depth:      depth,
+		Params:     map[string]interface{}{"user": map[string]interface{}{"name": "Ada"}},
+	}
+
+	assert.NilError(t, e.models.Runs.Insert(run))
+
+	return run
+}
+
+func TestCallWorkflowStep(t *testing.T) {
+	e := newTestEngine(t, executor.Provider{}, Config{})
+
+	testMap := []struct {
+		name   string
+		params map[string]interface{}
+		depth  int
+		wants  callTestResult
+	}{
+		{
+			name:   "Sync Waits On The Child",
+			params: map[string]interface{}{"inputs": map[string]interface{}{"who": "user.name"}},
+		},
+		{
+			name:   "Async Goes On Right Away",
+			params: map[string]interface{}{"mode": "async", "inputs": map[string]interface{}{"who": "user.name"}},
+			wants:  callTestResult{async: true},
+		},
+		{
+			name:  "Nested Up To Max Call Depth",
+			depth: maxCallDepth - 1,
+		},
+		{
+			name:  "Nested Deeper Than Max Call Depth Fails",
+			depth: maxCallDepth,
+			wants: callTestResult{err: fmt.Sprintf("can't be nested more than %d deep", maxCallDepth)},
+		},
+		{
+			name:   "Workflow Of Another Workspace Is Not Found",
+			params: map[string]interface{}{"workflowId": tests.Data.Workflows[1].Id},
+			wants:  callTestResult{err: tests.Data.Workflows[1].Id, notFound: true},
+		},
+		{
+			name:   "Invalid Mode Fails",
+			params: map[string]interface{}{"mode": "later"},
+			wants:  callTestResult{err: "mode must be sync or async"},
+		},
+		{
+			name:   "Missing Input Param Fails",
+			params: map[string]interface{}{"inputs": map[string]interface{}{"who": "user.email"}},
+			wants:  callTestResult{err: `param "user.email" not found`},
+		},
+	}
+
+	workflow, err := e.models.Workflows.Get(tests.Data.Workflows[0].Id)
+	assert.NilError(t, err)
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			params := map[string]interface{}{"workflowId": workflow.Id}
+			for k, v := range tt.params {
+				params[k] = v
+			}
+
+			run := insertParent(t, e, tt.depth)
+			step := callStep(params)
+
+			result, err := e.callWorkflowStep(context.Background(), run, workflow, step)
+
+			children, childErr := e.models.Runs.GetChildren(run.Id)
+			assert.NilError(t, childErr)
+
+			if tt.wants.err != "" {
+				assert.Error(t, err)
+				assert.StringContains(t, err.Error(), tt.wants.err)
+				assert.Equal(t, errors.Is(err, data.ErrRecordNotFound), tt.wants.notFound)
+				assert.Equal(t, len(children), 0)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, len(children), 1)
+
+			child := children[0]
+			assert.Equal(t, child.WorkflowId, workflow.Id)
+			assert.Equal(t, child.Status, data.RunStatusQueued)
+			assert.Equal(t, child.Depth, tt.depth+1)
+			assert.Equal(t, child.NextActionId.String, tests.Data.WorkflowActions[0].NextActionId.String)
+
+			if _, ok := tt.params["inputs"]; ok {
+				assert.Equal(t, child.Params["who"], interface{}("Ada"))
+			}
+
+			if tt.wants.async {
+				assert.Equal(t, result.suspend, false)
+				assert.Equal(t, result.next.Valid, false)
+				assert.Equal(t, result.params["childRunId"], interface{}(child.Id))
+				return
+			}
+
+			assert.Equal(t, result.suspend, true)
+			assert.Equal(t, result.next.String, step.Id)
+			assert.Equal(t, result.params[paramPendingChildRun], interface{}(child.Id))
+		})
+	}
+}
+
+func TestCallWorkflowCollectsChild(t *testing.T) {
+	e := newTestEngine(t, executor.Provider{}, Config{})
+
+	testMap := []struct {
+		name        string
+		childStatus string
+		childError  string
+		wants       callTestResult
+	}{
+		{
+			name:        "Succeeded Child Hands Over Its Params",
+			childStatus: data.RunStatusSucceeded,
+		},
+		{
+			name:        "Failed Child Fails The Step",
+			childStatus: data.RunStatusFailed,
+			childError:  "service unavailable",
+			wants:       callTestResult{err: "failed: service unavailable"},
+		},
+		{
+			name:        "Cancelled Child Fails The Step",
+			childStatus: data.RunStatusCancelled,
+			wants:       callTestResult{err: "cancelled"},
+		},
+	}
+
+	workflow, err := e.models.Workflows.Get(tests.Data.Workflows[0].Id)
+	assert.NilError(t, err)
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			run := insertParent(t, e, 0)
+			step := callStep(map[string]interface{}{"workflowId": workflow.Id, "outputKey": "onboarding"})
+
+			started, err := e.callWorkflowStep(context.Background(), run, workflow, step)
+			assert.NilError(t, err)
+
+			// The worker saves the parent as waiting on the step.
+			run.Params = started.params
+			run.Status = data.RunStatusWaiting
+			run.ResumeAt = started.resumeAt
+			assert.NilError(t, e.models.Runs.Update(run))
+
+			childId, _ := started.params[paramPendingChildRun].(string)
+			child := getRun(t, e, childId)
+
+			// A child that is still going keeps the parent waiting.
+			result, err := e.callWorkflowStep(context.Background(), run, workflow, step)
+			assert.NilError(t, err)
+			assert.Equal(t, result.suspend, true)
+			assert.Equal(t, result.next.String, step.Id)
+
+			child.Params["welcomed"] = true
+			assert.Equal(t, e.finishRun(child, tt.childStatus, tt.childError), true)
+
+			// Finishing the child wakes the parent up.
+			parent := getRun(t, e, run.Id)
+			assert.Equal(t, parent.Status, data.RunStatusQueued)
+
+			result, err = e.callWorkflowStep(context.Background(), parent, workflow, step)
+
+			if tt.wants.err != "" {
+				assert.Error(t, err)
+				assert.StringContains(t, err.Error(), tt.wants.err)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, result.suspend, false)
+			assert.Equal(t, result.next.Valid, false)
+			assert.Equal(t, result.params[paramPendingChildRun], nil)
+			assert.Equal(t, result.params["childStatus"], interface{}(data.RunStatusSucceeded))
+
+			outputs, _ := result.params["onboarding"].(map[string]interface{})
+			assert.Equal(t, outputs["welcomed"], interface{}(true))
+		})
+	}
+}
+
+func TestStartErrorHandler(t *testing.T) {
+	e := newTestEngine(t, executor.Provider{}, Config{})
+
+	handler := &data.Workflow{
+		UserId:      tests.Data.Users[0].Id,
+		WorkspaceId: tests.Data.Workspaces[0].Id,
+		Name:        "Report Failures",
+	}
+	assert.NilError(t, e.models.Workflows.Insert(handler))
+
+	notify := &data.WorkflowAction{
+		Text:       "Notify",
+		Type:       "Finish",
+		WorkflowId: handler.Id,
+		ActionId:   tests.Data.Actions[1].Id,
+	}
+	assert.NilError(t, e.models.WorkflowActions.Insert(notify))
+
+	testMap := []struct {
+		name            string
+		errorWorkflowId string
+		depth           int
+		started         bool
+	}{
+		{
+			name:            "Starts The Handler",
+			errorWorkflowId: handler.Id,
+			started:         true,
+		},
+		{
+			name:            "Starts The Handler Of A Nested Run",
+			errorWorkflowId: handler.Id,
+			depth:           maxCallDepth - 1,
+			started:         true,
+		},
+		{
+			name:            "Stops At Max Call Depth",
+			errorWorkflowId: handler.Id,
+			depth:           maxCallDepth,
+		},
+		{
+			name:            "Workflow Handling Its Own Errors",
+			errorWorkflowId: tests.Data.Workflows[0].Id,
+		},
+		{
+			name:            "Handler Of Another Workspace",
+			errorWorkflowId: tests.Data.Workflows[1].Id,
+		},
+		{
+			name: "No Handler",
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			workflow, err := e.models.Workflows.Get(tests.Data.Workflows[0].Id)
+			assert.NilError(t, err)
+
+			workflow.ErrorWorkflowId = nullString(tt.errorWorkflowId)
+			assert.NilError(t, e.models.Workflows.Update(workflow))
+
+			run := insertParent(t, e, tt.depth)
+			run.Error = "boom"
+
+			failedActionId := nullString(tests.Data.WorkflowActions[1].Id)
+
+			e.startErrorHandler(context.Background(), run, failedActionId)
+
+			children, err := e.models.Runs.GetChildren(run.Id)
+			assert.NilError(t, err)
+
+			if !tt.started {
+				assert.Equal(t, len(children), 0)
+				return
+			}
+
+			assert.Equal(t, len(children), 1)
+
+			handlerRun := children[0]
+			assert.Equal(t, handlerRun.WorkflowId, handler.Id)
+			assert.Equal(t, handlerRun.Status, data.RunStatusQueued)
+			assert.Equal(t, handlerRun.Depth, tt.depth+1)
+			assert.Equal(t, handlerRun.NextActionId.String, notify.Id)
+
+			failedRun, _ := handlerRun.Params["failedRun"].(map[string]interface{})
+			assert.Equal(t, failedRun["runId"], interface{}(run.Id))
+			assert.Equal(t, failedRun["stepId"], interface{}(failedActionId.String))
+			assert.Equal(t, failedRun["error"], interface{}("boom"))
+		})
+	}
+}
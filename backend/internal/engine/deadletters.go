@@ -0,0 +1,34 @@
+package engine
+
+import (
+	"database/sql"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+)
+
+// deadLetter keeps a failed run in the dead letters with the params it
+// failed with and the step and provider that failed, so it can be inspected
+// and requeued later.
+func (e *Engine) deadLetter(run *data.WorkflowRun, failedActionId sql.NullString) {
+	d := &data.DeadLetter{
+		RunId:            run.Id,
+		WorkflowId:       run.WorkflowId,
+		WorkflowActionId: failedActionId,
+		Params:           run.Params,
+		Error:            run.Error,
+	}
+
+	if failedActionId.Valid {
+		workflow, err := e.models.Workflows.Get(run.WorkflowId)
+		if err == nil {
+			if step, ok := findAction(workflow, failedActionId.String); ok {
+				d.Provider = step.Action.Provider.Name
+			}
+		}
+	}
+
+	err := e.models.DeadLetters.Upsert(d)
+	if err != nil {
+		e.logger.Error(err.Error(), "run_id", run.Id)
+	}
+}
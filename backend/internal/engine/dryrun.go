@@ -0,0 +1,216 @@
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+)
+
+// RunStatusMocked marks the steps of a dry run whose output was mocked.
+const RunStatusMocked = "mocked"
+
+// DryRunResult is what a dry run went through, step by step. Nothing of it
+// is stored.
+type DryRunResult struct {
+	Status string                 `json:"status"`
+	Error  string                 `json:"error,omitempty"`
+	Params map[string]interface{} `json:"params"`
+	Steps  []*data.RunStep        `json:"steps"`
+}
+
+// dryRun collects the steps of a dry run instead of the run history. Steps
+// with a mock return it as their output instead of executing.
+type dryRun struct {
+	mu    sync.Mutex
+	steps []*data.RunStep
+	mocks map[string]map[string]interface{}
+}
+
+func (d *dryRun) add(step *data.RunStep) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.steps = append(d.steps, step)
+}
+
+// DryRun executes the workflow from its first step with params as the
+// trigger output. The run and its steps aren't stored: timers are skipped,
+// approvals are approved right away and called workflows run inline. Other
+// steps execute for real unless mocks, keyed by step id, has an output for
+// them; they get executor.ParamDryRun so they don't keep records of what
+// they did, like webhook deliveries.
+func (e *Engine) DryRun(ctx context.Context, workflow *data.Workflow, params map[string]interface{}, mocks map[string]map[string]interface{}) *DryRunResult {
+	dry := e.dryCopy(mocks)
+
+	run := newDryRun(workflow, params)
+
+	first, err := firstStep(workflow)
+	if err != nil {
+		return dry.dryRunResult(run, err)
+	}
+
+	run.NextActionId = first
+
+	for steps := 0; run.NextActionId.Valid; steps++ {
+		if steps == maxStepsPerRun {
+			return dry.dryRunResult(run, fmt.Errorf("run exceeded %d steps", maxStepsPerRun))
+		}
+
+		step, ok := findAction(workflow, run.NextActionId.String)
+		if !ok {
+			return dry.dryRunResult(run, fmt.Errorf("step %s not found", run.NextActionId.String))
+		}
+
+		result, err := dry.runStep(ctx, run, workflow, step)
+		if err != nil {
+			return dry.dryRunResult(run, err)
+		}
+
+		run.Params = result.params
+		run.NextActionId = result.next
+	}
+
+	run.Status = data.RunStatusSucceeded
+
+	return dry.dryRunResult(run, nil)
+}
+
+// TestStep executes a single step of the workflow with params as the run
+// params, the same way DryRun does.
+func (e *Engine) TestStep(ctx context.Context, workflow *data.Workflow, step *data.WorkflowAction, params map[string]interface{}, mocks map[string]map[string]interface{}) *DryRunResult {
+	dry := e.dryCopy(mocks)
+
+	run := newDryRun(workflow, params)
+
+	result, err := dry.runStep(ctx, run, workflow, step)
+	if err != nil {
+		return dry.dryRunResult(run, err)
+	}
+
+	run.Params = result.params
+	run.Status = data.RunStatusSucceeded
+
+	return dry.dryRunResult(run, nil)
+}
+
+// newDryRun returns the run a dry run executes. It is never stored, but it
+// gets an id of its own so its steps don't share idempotency keys with the
+// steps of other dry runs.
+func newDryRun(workflow *data.Workflow, params map[string]interface{}) *data.WorkflowRun {
+	return &data.WorkflowRun{
+		Id:         dryRunId(),
+		WorkflowId: workflow.Id,
+		Status:     data.RunStatusRunning,
+		Params:     copyParams(params),
+	}
+}
+
+func dryRunId() string {
+	b := make([]byte, 16)
+
+	// crypto/rand doesn't fail on the platforms we run on.
+	_, _ = rand.Read(b)
+
+	return "dry-" + hex.EncodeToString(b)
+}
+
+func (e *Engine) dryCopy(mocks map[string]map[string]interface{}) *Engine {
+	dry := *e
+	dry.dry = &dryRun{mocks: mocks}
+
+	return &dry
+}
+
+func (e *Engine) dryRunResult(run *data.WorkflowRun, err error) *DryRunResult {
+	result := &DryRunResult{
+		Status: run.Status,
+		Params: run.Params,
+		Steps:  e.dry.steps,
+	}
+
+	if err != nil {
+		result.Status = data.RunStatusFailed
+		result.Error = err.Error()
+	}
+
+	if result.Steps == nil {
+		result.Steps = []*data.RunStep{}
+	}
+
+	return result
+}
+
+// mockStep stands in for a step with a mock: the mock is merged into the
+// params as if the step had output it.
+func (e *Engine) mockStep(run *data.WorkflowRun, workflow *data.Workflow, step *data.WorkflowAction, mock map[string]interface{}) stepResult {
+	input := stepInput(run.Params, workflow, step)
+
+	e.recordStep(run, step, RunStatusMocked, input, mock, nil, time.Now())
+
+	params := copyParams(run.Params)
+	for k, v := range mock {
+		params[k] = v
+	}
+
+	return stepResult{params: params, next: step.NextActionId}
+}
+
+func (e *Engine) dryApproval(run *data.WorkflowRun, workflow *data.Workflow, step *data.WorkflowAction) stepResult {
+	input := stepInput(run.Params, workflow, step)
+
+	output := map[string]interface{}{"approvalStatus": data.ApprovalStatusApproved}
+
+	e.recordStep(run, step, data.RunStatusSucceeded, input, output, nil, time.Now())
+
+	params := copyParams(run.Params)
+	for k, v := range output {
+		params[k] = v
+	}
+
+	return stepResult{params: params, next: step.NextActionId}
+}
+
+func (e *Engine) dryCallWorkflow(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, step *data.WorkflowAction) (stepResult, error) {
+	input := stepInput(run.Params, workflow, step)
+	startedAt := time.Now()
+
+	child, _, err := e.newChildRun(ctx, run, workflow, input)
+	if err != nil {
+		e.recordStep(run, step, data.RunStatusFailed, input, nil, err, startedAt)
+		return stepResult{}, err
+	}
+
+	child.Id = dryRunId()
+
+	target, err := e.models.Workflows.Get(child.WorkflowId)
+	if err != nil {
+		e.recordStep(run, step, data.RunStatusFailed, input, nil, err, startedAt)
+		return stepResult{}, err
+	}
+
+	outputs, err := e.runChain(ctx, child, target, child.NextActionId.String, "", child.Params, new(atomic.Bool))
+	if err != nil {
+		e.recordStep(run, step, data.RunStatusFailed, input, nil, err, startedAt)
+		return stepResult{}, err
+	}
+
+	outputKey, _ := step.Params["outputKey"].(string)
+	if outputKey == "" {
+		outputKey = "childOutputs"
+	}
+
+	output := map[string]interface{}{outputKey: outputs}
+
+	e.recordStep(run, step, data.RunStatusSucceeded, input, output, nil, startedAt)
+
+	params := copyParams(run.Params)
+	params[outputKey] = outputs
+
+	return stepResult{params: params, next: step.NextActionId}, nil
+}
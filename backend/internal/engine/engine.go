@@ -0,0 +1,303 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/executor"
+	"github.com/luisya22/confluo/backend/internal/metrics"
+)
+
+const (
+	defaultWorkers      = 4
+	defaultPollInterval = 30 * time.Second
+	timerInterval       = 5 * time.Second
+	idleWait            = time.Second
+	maxStepsPerRun      = 1000
+
+	defaultDedupeRetention = 24 * time.Hour
+	defaultRunLease        = 2 * time.Minute
+	defaultRetryBackoff    = 30 * time.Second
+	maxRetryBackoff        = time.Hour
+
+	// maxRunRecoveries is how many times a run is queued again after the
+	// worker executing it died before it is failed instead, so a run that
+	// crashes its worker doesn't take down every worker in turn.
+	maxRunRecoveries = 3
+)
+
+type Config struct {
+	Workers      int
+	PollInterval time.Duration
+	// DedupeRetention is how long the dedupe key of a trigger event is
+	// kept.
+	DedupeRetention time.Duration
+	// RunLease is how long a claimed run stays with its worker without a
+	// heartbeat. Runs whose lease expired are taken back by the scheduler.
+	RunLease time.Duration
+	// RetryAttempts is how many times a run whose step failed is retried
+	// before it fails and is dead lettered. Zero fails it right away.
+	RetryAttempts int
+	// RetryBackoff is the wait before the first retry. It doubles with
+	// every retry up to maxRetryBackoff.
+	RetryBackoff time.Duration
+}
+
+// Engine polls workflow triggers and executes the runs they start. Runs are
+// stored in the database, which doubles as the job queue.
+type Engine struct {
+	models   data.Models
+	executor *executor.Executor
+	logger   *slog.Logger
+	config   Config
+
+	// dry is set on the copies of the engine that execute dry runs.
+	dry *dryRun
+
+	loops *loops
+}
+
+// loops tracks the scheduler and worker loops for Health. It is a pointer
+// so the copies made for dry runs share it.
+type loops struct {
+	schedulerRunning atomic.Bool
+	schedulerTick    atomic.Int64
+	workers          atomic.Int32
+}
+
+// Health reports whether the scheduler and the workers are running. The
+// scheduler is stalled when it hasn't gone around its loop for two trigger
+// polls, e.g. because polling hangs.
+type Health struct {
+	SchedulerRunning  bool
+	SchedulerStalled  bool
+	LastSchedulerTick time.Time
+	Workers           int
+	ExpectedWorkers   int
+}
+
+func New(models data.Models, exec *executor.Executor, logger *slog.Logger, cfg Config) *Engine {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+
+	if cfg.DedupeRetention <= 0 {
+		cfg.DedupeRetention = defaultDedupeRetention
+	}
+
+	if cfg.RunLease <= 0 {
+		cfg.RunLease = defaultRunLease
+	}
+
+	if cfg.RetryAttempts < 0 {
+		cfg.RetryAttempts = 0
+	}
+
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaultRetryBackoff
+	}
+
+	return &Engine{
+		models:   models,
+		executor: exec,
+		logger:   logger,
+		config:   cfg,
+		loops:    &loops{},
+	}
+}
+
+func (e *Engine) Health() Health {
+	lastTick := time.Unix(0, e.loops.schedulerTick.Load())
+	running := e.loops.schedulerRunning.Load()
+
+	return Health{
+		SchedulerRunning:  running,
+		SchedulerStalled:  running && time.Since(lastTick) > 2*e.config.PollInterval+timerInterval,
+		LastSchedulerTick: lastTick,
+		Workers:           int(e.loops.workers.Load()),
+		ExpectedWorkers:   e.config.Workers,
+	}
+}
+
+func (e *Engine) Workers() int {
+	return e.config.Workers
+}
+
+// RunScheduler polls every trigger each PollInterval and queues the runs
+// whose timers expired until ctx is cancelled. Runs left behind by workers
+// that died are taken back when it starts and with every trigger poll.
+func (e *Engine) RunScheduler(ctx context.Context) {
+	e.loops.schedulerRunning.Store(true)
+	defer e.loops.schedulerRunning.Store(false)
+
+	e.tick()
+
+	triggers := time.NewTicker(e.config.PollInterval)
+	defer triggers.Stop()
+
+	timers := time.NewTicker(timerInterval)
+	defer timers.Stop()
+
+	e.recoverRuns()
+	e.pollTriggers()
+	e.queueDueRuns()
+	e.updateQueueMetrics()
+
+	for {
+		e.tick()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-triggers.C:
+			e.recoverRuns()
+			e.pollTriggers()
+			e.deleteExpiredTriggerEvents()
+		case <-timers.C:
+			e.queueDueRuns()
+			e.updateQueueMetrics()
+		}
+	}
+}
+
+func (e *Engine) tick() {
+	e.loops.schedulerTick.Store(time.Now().UnixNano())
+}
+
+func (e *Engine) deleteExpiredTriggerEvents() {
+	_, err := e.models.TriggerEvents.DeleteExpired(e.config.DedupeRetention)
+	if err != nil {
+		e.logger.Error(err.Error())
+	}
+}
+
+func (e *Engine) queueDueRuns() {
+	n, err := e.models.Runs.QueueDue()
+	if err != nil {
+		e.logger.Error(err.Error())
+		return
+	}
+
+	if n > 0 {
+		e.logger.Info("resumed waiting runs", "count", n)
+	}
+}
+
+// recoverRuns takes back the runs whose lease expired because the worker
+// executing them crashed or was killed. They are queued again to continue
+// from the step they were on, which may execute that step a second time;
+// steps get the same idempotency key when they do. Runs that already lost
+// their worker maxRunRecoveries times are failed.
+func (e *Engine) recoverRuns() {
+	n, err := e.models.Runs.RequeueExpired(maxRunRecoveries)
+	if err != nil {
+		e.logger.Error(err.Error())
+	} else if n > 0 {
+		e.logger.Warn("requeued runs whose worker stopped", "count", n)
+	}
+
+	runs, err := e.models.Runs.GetExpired(maxRunRecoveries)
+	if err != nil {
+		e.logger.Error(err.Error())
+		return
+	}
+
+	for _, run := range runs {
+		e.failRun(context.Background(), run, fmt.Errorf("run lost its worker %d times", run.Recoveries+1))
+	}
+}
+
+// updateQueueMetrics refreshes the queue depth, the scheduler lag and the
+// dead letter gauges.
+func (e *Engine) updateQueueMetrics() {
+	stats, err := e.models.Runs.QueueStats()
+	if err != nil {
+		e.logger.Error(err.Error())
+	} else {
+		metrics.SetQueue(stats.Runs, stats.Lag)
+	}
+
+	depth, err := e.models.DeadLetters.Depth("")
+	if err != nil {
+		e.logger.Error(err.Error())
+	} else {
+		metrics.SetDeadLetters(depth.ByProvider)
+	}
+}
+
+// RunWorker claims queued runs and executes them until ctx is cancelled. A
+// run that is executing when ctx is cancelled is finished first.
+func (e *Engine) RunWorker(ctx context.Context) {
+	e.loops.workers.Add(1)
+	defer e.loops.workers.Add(-1)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		run, err := e.models.Runs.ClaimNext(e.config.RunLease)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				e.logger.Error(err.Error())
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(idleWait):
+			}
+
+			continue
+		}
+
+		stop := e.keepLease(run.Id)
+		e.execute(run)
+		stop()
+	}
+}
+
+// keepLease renews the lease of the run every third of the lease until the
+// returned func is called.
+func (e *Engine) keepLease(runId string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(e.config.RunLease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := e.models.Runs.Heartbeat(runId, e.config.RunLease)
+				switch {
+				case errors.Is(err, data.ErrEditConflict):
+					return
+				case err != nil:
+					e.logger.Error(err.Error(), "run_id", runId)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,327 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/executor"
+	"github.com/luisya22/confluo/backend/internal/providers/system"
+	"github.com/luisya22/confluo/backend/internal/tests"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+var db *sqlx.DB
+
+func TestMain(m *testing.M) {
+	var err error
+
+	db, err = tests.NewTestDB()
+	if err != nil {
+		// The tests that execute runs need a database; the others don't.
+		fmt.Println("error creating db:", err)
+		db = nil
+	}
+
+	exitCode := m.Run()
+
+	if db != nil {
+		db.Close()
+	}
+
+	os.Exit(exitCode)
+}
+
+// newTestEngine returns an engine on the test database whose System
+// provider executes actions instead of the real one. The seeded "User
+// Onboarding" workflow is triggered by its Create step and runs its Update
+// step.
+func newTestEngine(t *testing.T, actions executor.Provider, cfg Config) *Engine {
+	t.Helper()
+
+	if db == nil {
+		t.Skip("no test database")
+	}
+
+	tests.SetupDb(db)
+	t.Cleanup(func() { tests.TeardownDb(db) })
+
+	exec := executor.NewExecutor()
+	exec.Subscribe(system.ProviderName, actions)
+
+	return New(data.NewModels(db), exec, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+}
+
+// newDryEngine returns an engine without a database whose System provider
+// executes actions. It is for tests that go through DryRun, which doesn't
+// store anything.
+func newDryEngine(actions executor.Provider) *Engine {
+	exec := executor.NewExecutor()
+	exec.Subscribe(system.ProviderName, actions)
+
+	return New(data.Models{}, exec, slog.New(slog.NewTextHandler(io.Discard, nil)), Config{})
+}
+
+// systemStep returns a step of an in-memory workflow that runs operation of
+// the System provider and goes on to next.
+func systemStep(id, operation, next string, params map[string]interface{}) data.WorkflowAction {
+	return data.WorkflowAction{
+		Id:           id,
+		Text:         id,
+		Action:       data.Action{Operation: operation, Provider: data.Provider{Name: system.ProviderName}},
+		NextActionId: nullString(next),
+		Params:       params,
+	}
+}
+
+// stepActions are System actions for the in-memory workflows. Set marks
+// the step as visited in the params under its id, Slow does the same a
+// little later and Fail fails.
+var stepActions = executor.Provider{
+	"Set": func(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+		id, _ := params[executor.ParamWorkflowActionId].(string)
+		params[id] = true
+		return params, nil
+	},
+	"Slow": func(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+		time.Sleep(200 * time.Millisecond)
+
+		id, _ := params[executor.ParamWorkflowActionId].(string)
+		params[id] = true
+		return params, nil
+	},
+	"Fail": func(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+		return params, errors.New("boom")
+	},
+}
+
+// stepIndex returns where the step with the id was recorded in the steps,
+// or -1.
+func stepIndex(steps []*data.RunStep, id string) int {
+	for i, step := range steps {
+		if step.WorkflowActionId.String == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// insertRun queues a run of the seeded workflow on its Update step.
+func insertRun(t *testing.T, e *Engine) *data.WorkflowRun {
+	t.Helper()
+
+	run := &data.WorkflowRun{
+		WorkflowId:   tests.Data.Workflows[0].Id,
+		Params:       map[string]interface{}{"name": "Ada"},
+		NextActionId: nullString(tests.Data.WorkflowActions[1].Id),
+	}
+
+	assert.NilError(t, e.models.Runs.Insert(run))
+
+	return run
+}
+
+func getRun(t *testing.T, e *Engine, id string) *data.WorkflowRun {
+	t.Helper()
+
+	run, err := e.models.Runs.Get(id)
+	assert.NilError(t, err)
+
+	return run
+}
+
+func TestRunWorker(t *testing.T) {
+	e := newTestEngine(t, executor.Provider{
+		"Update": func(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+			params["updated"] = true
+			return params, nil
+		},
+	}, Config{Workers: 1})
+
+	run := insertRun(t, e)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		e.RunWorker(ctx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !getRun(t, e, run.Id).Finished() && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	got := getRun(t, e, run.Id)
+	assert.Equal(t, got.Status, data.RunStatusSucceeded)
+	assert.Equal(t, got.Params["updated"], interface{}(true))
+	assert.Equal(t, got.Params["name"], interface{}("Ada"))
+	assert.Equal(t, got.LockedUntil == nil, true)
+	assert.NotEqual(t, got.StartedAt, nil)
+
+	steps, err := e.models.RunSteps.GetAllForRun(run.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(steps), 1)
+	assert.Equal(t, steps[0].Status, data.RunStatusSucceeded)
+
+	assert.Equal(t, e.Health().Workers, 0)
+}
+
+func TestKeepLease(t *testing.T) {
+	e := newTestEngine(t, executor.Provider{}, Config{RunLease: 3 * time.Second})
+
+	run := insertRun(t, e)
+
+	claimed, err := e.models.Runs.ClaimNext(e.config.RunLease)
+	assert.NilError(t, err)
+	assert.Equal(t, claimed.Id, run.Id)
+
+	// The lease is renewed every second, so after two and a half it ends
+	// at least two seconds later than when the run was claimed.
+	stop := e.keepLease(run.Id)
+	time.Sleep(2500 * time.Millisecond)
+	stop()
+
+	got := getRun(t, e, run.Id)
+	assert.Equal(t, got.LockedUntil.After(claimed.LockedUntil.Add(time.Second)), true)
+
+	// The renewal gives up on its own once the run isn't running anymore.
+	assert.NilError(t, e.models.Runs.Cancel(run.Id))
+
+	stop = e.keepLease(run.Id)
+	time.Sleep(1500 * time.Millisecond)
+	stop()
+
+	got = getRun(t, e, run.Id)
+	assert.Equal(t, got.Status, data.RunStatusCancelled)
+}
+
+func TestRecoverRuns(t *testing.T) {
+	e := newTestEngine(t, executor.Provider{}, Config{})
+
+	run := insertRun(t, e)
+
+	// A negative lease stands in for a worker that died a minute ago.
+	for i := 1; i <= maxRunRecoveries; i++ {
+		_, err := e.models.Runs.ClaimNext(-time.Minute)
+		assert.NilError(t, err)
+
+		e.recoverRuns()
+
+		got := getRun(t, e, run.Id)
+		assert.Equal(t, got.Status, data.RunStatusQueued)
+		assert.Equal(t, got.Recoveries, i)
+	}
+
+	_, err := e.models.Runs.ClaimNext(-time.Minute)
+	assert.NilError(t, err)
+
+	e.recoverRuns()
+
+	got := getRun(t, e, run.Id)
+	assert.Equal(t, got.Status, data.RunStatusFailed)
+	assert.StringContains(t, got.Error, fmt.Sprintf("run lost its worker %d times", maxRunRecoveries+1))
+
+	depth, err := e.models.DeadLetters.Depth("")
+	assert.NilError(t, err)
+	assert.Equal(t, depth.ByWorkflow[run.WorkflowId], 1)
+}
+
+func TestQueueDueRuns(t *testing.T) {
+	e := newTestEngine(t, executor.Provider{}, Config{})
+
+	due := insertRun(t, e)
+	later := insertRun(t, e)
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	due.Status = data.RunStatusWaiting
+	due.ResumeAt = &past
+	assert.NilError(t, e.models.Runs.Update(due))
+
+	later.Status = data.RunStatusWaiting
+	later.ResumeAt = &future
+	assert.NilError(t, e.models.Runs.Update(later))
+
+	e.queueDueRuns()
+
+	got := getRun(t, e, due.Id)
+	assert.Equal(t, got.Status, data.RunStatusQueued)
+	assert.Equal(t, got.ResumeAt == nil, true)
+
+	got = getRun(t, e, later.Id)
+	assert.Equal(t, got.Status, data.RunStatusWaiting)
+}
+
+func TestRetryThenDeadLetter(t *testing.T) {
+	e := newTestEngine(t, executor.Provider{
+		"Update": func(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+			return params, errors.New("service unavailable")
+		},
+	}, Config{RetryAttempts: 1, RetryBackoff: time.Minute})
+
+	run := insertRun(t, e)
+
+	claimed, err := e.models.Runs.ClaimNext(time.Minute)
+	assert.NilError(t, err)
+
+	e.execute(claimed)
+
+	// The first failure parks the run on the failed step until its retry.
+	got := getRun(t, e, run.Id)
+	assert.Equal(t, got.Status, data.RunStatusWaiting)
+	assert.Equal(t, got.Retries, 1)
+	assert.Equal(t, got.NextActionId.String, run.NextActionId.String)
+	assert.StringContains(t, got.Error, "service unavailable")
+	assert.Equal(t, got.ResumeAt.After(time.Now()), true)
+
+	attempts, err := e.models.DeadLetters.GetAttempts(run.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(attempts), 1)
+	assert.Equal(t, attempts[0].WorkflowActionId.String, run.NextActionId.String)
+
+	depth, err := e.models.DeadLetters.Depth("")
+	assert.NilError(t, err)
+	assert.Equal(t, depth.Total, 0)
+
+	// Bring the retry forward instead of waiting for the backoff.
+	past := time.Now().Add(-time.Second)
+	got.ResumeAt = &past
+	assert.NilError(t, e.models.Runs.Update(got))
+
+	e.queueDueRuns()
+
+	claimed, err = e.models.Runs.ClaimNext(time.Minute)
+	assert.NilError(t, err)
+	assert.Equal(t, claimed.Id, run.Id)
+
+	e.execute(claimed)
+
+	// The retry used up the attempts, so the run fails and is dead
+	// lettered under the provider of the failed step.
+	got = getRun(t, e, run.Id)
+	assert.Equal(t, got.Status, data.RunStatusFailed)
+	assert.StringContains(t, got.Error, "service unavailable")
+
+	depth, err = e.models.DeadLetters.Depth("")
+	assert.NilError(t, err)
+	assert.Equal(t, depth.Total, 1)
+	assert.Equal(t, depth.ByProvider[system.ProviderName], 1)
+
+	attempts, err = e.models.DeadLetters.GetAttempts(run.Id)
+	assert.NilError(t, err)
+	assert.Equal(t, len(attempts), 1)
+}
@@ -0,0 +1,315 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+)
+
+const (
+	defaultMaxItems = 100
+	maxItemsLimit   = 1000
+	maxParallelism  = 10
+)
+
+type loop struct {
+	items           []interface{}
+	bodyActionId    string
+	parallelism     int
+	continueOnError bool
+	resultsKey      string
+}
+
+// forEachStep runs a chain of steps once for every item of a list and
+// collects what each pass produced. Every pass starts from the run params
+// plus item and itemIndex, and its result holds the params it added or
+// changed.
+//
+// Params:
+//   - items: the list, or the name of the run param holding it. Nested
+//     params are reached with dots, like "responseBody.items".
+//   - bodyActionId: the first step of the chain. The chain ends at the first
+//     step without a next step.
+//   - parallelism: items processed at once. Defaults to 1, up to 10.
+//   - maxItems: items processed at most. Defaults to 100, up to 1000.
+//   - continueOnError: keep going when an item fails. Its result holds the
+//     error instead.
+//   - resultsKey: the param the results are stored in. Defaults to "results".
+func (e *Engine) forEachStep(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, step *data.WorkflowAction) (stepResult, error) {
+	input := stepInput(run.Params, workflow, step)
+	startedAt := time.Now()
+
+	l, err := newLoop(run.Params, input)
+	if err != nil {
+		e.recordStep(run, step, data.RunStatusFailed, input, nil, err, startedAt)
+		return stepResult{}, err
+	}
+
+	results, failed, err := e.runLoop(ctx, run, workflow, l)
+
+	output := map[string]interface{}{
+		l.resultsKey:  results,
+		"itemCount":   len(l.items),
+		"failedCount": failed,
+	}
+
+	if err != nil {
+		e.recordStep(run, step, data.RunStatusFailed, input, output, err, startedAt)
+		return stepResult{}, err
+	}
+
+	e.recordStep(run, step, data.RunStatusSucceeded, input, output, nil, startedAt)
+
+	params := copyParams(run.Params)
+	for k, v := range output {
+		params[k] = v
+	}
+
+	return stepResult{params: params, next: step.NextActionId}, nil
+}
+
+// runLoop processes the items, at most parallelism at a time. Without
+// continueOnError the first failure stops the other items at their next
+// step and is returned once they have.
+func (e *Engine) runLoop(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, l *loop) ([]interface{}, int, error) {
+	results := make([]interface{}, len(l.items))
+	errs := make([]error, len(l.items))
+
+	sem := make(chan struct{}, l.parallelism)
+
+	var wg sync.WaitGroup
+	var stopped atomic.Bool
+
+	for i, item := range l.items {
+		if stopped.Load() {
+			break
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(i int, item interface{}) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			params := copyParams(run.Params)
+			params["item"] = item
+			params["itemIndex"] = i
+
+			output, err := e.runChain(ctx, run, workflow, l.bodyActionId, "", params, &stopped)
+			if errors.Is(err, errChainStopped) {
+				return
+			}
+
+			if err != nil {
+				errs[i] = err
+				results[i] = map[string]interface{}{"item": item, "itemIndex": i, "error": err.Error()}
+
+				if !l.continueOnError {
+					stopped.Store(true)
+				}
+
+				return
+			}
+
+			results[i] = changedParams(run.Params, output)
+		}(i, item)
+	}
+
+	wg.Wait()
+
+	failed := 0
+	var firstErr error
+
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		failed++
+
+		if firstErr == nil {
+			firstErr = fmt.Errorf("item %d: %w", i, err)
+		}
+	}
+
+	if firstErr != nil && !l.continueOnError {
+		return results, failed, firstErr
+	}
+
+	return results, failed, nil
+}
+
+// errChainStopped is returned by a chain that stopped early because its
+// siblings made the result of the step that started it known.
+var errChainStopped = errors.New("stopped")
+
+// runChain runs the steps from firstActionId until one has no next step or
+// the next step is stopAt, and returns the resulting params. The chain stops
+// between steps once stopped is set. Steps inside a chain can't make the
+// run wait.
+func (e *Engine) runChain(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, firstActionId string, stopAt string, params map[string]interface{}, stopped *atomic.Bool) (map[string]interface{}, error) {
+	chain := *run
+	chain.Params = params
+	chain.NextActionId = nullString(firstActionId)
+
+	for steps := 0; chain.NextActionId.Valid && chain.NextActionId.String != stopAt; steps++ {
+		if stopped.Load() {
+			return nil, errChainStopped
+		}
+
+		if steps == maxStepsPerRun {
+			return nil, fmt.Errorf("chain exceeded %d steps", maxStepsPerRun)
+		}
+
+		step, ok := findAction(workflow, chain.NextActionId.String)
+		if !ok {
+			return nil, fmt.Errorf("step %s not found", chain.NextActionId.String)
+		}
+
+		result, err := e.runStep(ctx, &chain, workflow, step)
+		if err != nil {
+			return nil, err
+		}
+
+		if result.suspend {
+			return nil, fmt.Errorf("step %s cannot wait inside a for-each or parallel branch", step.Id)
+		}
+
+		chain.Params = result.params
+		chain.NextActionId = result.next
+	}
+
+	return chain.Params, nil
+}
+
+func newLoop(runParams map[string]interface{}, params map[string]interface{}) (*loop, error) {
+	l := &loop{parallelism: 1, resultsKey: "results"}
+
+	switch v := params["items"].(type) {
+	case []interface{}:
+		l.items = v
+	case string:
+		value, ok := lookupParam(runParams, v)
+		if !ok {
+			return nil, fmt.Errorf("items param %q not found", v)
+		}
+
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("items param %q is not a list", v)
+		}
+
+		l.items = items
+	case nil:
+		return nil, fmt.Errorf("items not found")
+	default:
+		return nil, fmt.Errorf("items must be a list or the name of a param holding one")
+	}
+
+	l.bodyActionId, _ = params["bodyActionId"].(string)
+	if l.bodyActionId == "" {
+		return nil, fmt.Errorf("bodyActionId not found")
+	}
+
+	parallelism, ok, err := intParam(params, "parallelism")
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		if parallelism < 1 || parallelism > maxParallelism {
+			return nil, fmt.Errorf("parallelism must be between 1 and %d", maxParallelism)
+		}
+
+		l.parallelism = parallelism
+	}
+
+	maxItems, ok, err := intParam(params, "maxItems")
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		maxItems = defaultMaxItems
+	}
+
+	if maxItems < 1 || maxItems > maxItemsLimit {
+		return nil, fmt.Errorf("maxItems must be between 1 and %d", maxItemsLimit)
+	}
+
+	if len(l.items) > maxItems {
+		l.items = l.items[:maxItems]
+	}
+
+	l.continueOnError, _ = params["continueOnError"].(bool)
+
+	if key, _ := params["resultsKey"].(string); key != "" {
+		l.resultsKey = key
+	}
+
+	return l, nil
+}
+
+// lookupParam finds a param by name, following dots into nested objects.
+func lookupParam(params map[string]interface{}, name string) (interface{}, bool) {
+	if v, ok := params[name]; ok {
+		return v, true
+	}
+
+	var current interface{} = params
+
+	for _, key := range strings.Split(name, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		current, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// changedParams returns the params in after that are new or differ from
+// before.
+func changedParams(before, after map[string]interface{}) map[string]interface{} {
+	changed := make(map[string]interface{})
+
+	for k, v := range after {
+		if old, ok := before[k]; ok && reflect.DeepEqual(old, v) {
+			continue
+		}
+
+		changed[k] = v
+	}
+
+	return changed
+}
+
+func intParam(params map[string]interface{}, key string) (int, bool, error) {
+	switch v := params[key].(type) {
+	case nil:
+		return 0, false, nil
+	case float64:
+		if v != float64(int(v)) {
+			return 0, false, fmt.Errorf("%s must be a whole number", key)
+		}
+
+		return int(v), true, nil
+	case int:
+		return v, true, nil
+	default:
+		return 0, false, fmt.Errorf("%s must be a number", key)
+	}
+}
@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/executor"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+type forEachTestResult struct {
+	status      string
+	err         string
+	results     string
+	itemCount   int
+	failedCount int
+}
+
+func TestForEachStep(t *testing.T) {
+	actions := executor.Provider{
+		"Double": func(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+			n, ok := params["item"].(float64)
+			if !ok {
+				return params, fmt.Errorf("item %v is not a number", params["item"])
+			}
+
+			params["doubled"] = n * 2
+			return params, nil
+		},
+		"Label": func(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+			params["label"] = fmt.Sprintf("item %v", params["itemIndex"])
+			return params, nil
+		},
+		"Set": stepActions["Set"],
+	}
+
+	testMap := []struct {
+		name   string
+		params map[string]interface{}
+		loop   map[string]interface{}
+		wants  forEachTestResult
+	}{
+		{
+			name: "Runs The Chain Once Per Item",
+			loop: map[string]interface{}{"items": []interface{}{1.0, 2.0}},
+			wants: forEachTestResult{
+				status:    data.RunStatusSucceeded,
+				results:   "[map[doubled:2 item:1 itemIndex:0 label:item 0] map[doubled:4 item:2 itemIndex:1 label:item 1]]",
+				itemCount: 2,
+			},
+		},
+		{
+			name:   "Takes The Items From A Nested Param",
+			params: map[string]interface{}{"order": map[string]interface{}{"lines": []interface{}{3.0}}},
+			loop:   map[string]interface{}{"items": "order.lines", "parallelism": 2.0},
+			wants: forEachTestResult{
+				status:    data.RunStatusSucceeded,
+				results:   "[map[doubled:6 item:3 itemIndex:0 label:item 0]]",
+				itemCount: 1,
+			},
+		},
+		{
+			name: "Empty List Goes Straight On",
+			loop: map[string]interface{}{"items": []interface{}{}},
+			wants: forEachTestResult{
+				status:  data.RunStatusSucceeded,
+				results: "[]",
+			},
+		},
+		{
+			name: "Stops At Max Items",
+			loop: map[string]interface{}{"items": []interface{}{1.0, 2.0, 3.0}, "maxItems": 1.0},
+			wants: forEachTestResult{
+				status:    data.RunStatusSucceeded,
+				results:   "[map[doubled:2 item:1 itemIndex:0 label:item 0]]",
+				itemCount: 1,
+			},
+		},
+		{
+			name: "Failed Item Fails The Step",
+			loop: map[string]interface{}{"items": []interface{}{1.0, "x"}},
+			wants: forEachTestResult{
+				status: data.RunStatusFailed,
+				err:    "item 1: item x is not a number",
+			},
+		},
+		{
+			name: "Continue On Error Keeps The Error As The Result",
+			loop: map[string]interface{}{"items": []interface{}{1.0, "x"}, "continueOnError": true},
+			wants: forEachTestResult{
+				status:      data.RunStatusSucceeded,
+				results:     "[map[doubled:2 item:1 itemIndex:0 label:item 0] map[error:item x is not a number item:x itemIndex:1]]",
+				itemCount:   2,
+				failedCount: 1,
+			},
+		},
+		{
+			name: "Missing Items Param Fails",
+			loop: map[string]interface{}{"items": "lines"},
+			wants: forEachTestResult{
+				status: data.RunStatusFailed,
+				err:    `items param "lines" not found`,
+			},
+		},
+		{
+			name: "Invalid Parallelism Fails",
+			loop: map[string]interface{}{"items": []interface{}{1.0}, "parallelism": 11.0},
+			wants: forEachTestResult{
+				status: data.RunStatusFailed,
+				err:    "parallelism must be between 1 and 10",
+			},
+		},
+	}
+
+	e := newDryEngine(actions)
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			loopParams := map[string]interface{}{"bodyActionId": "double"}
+			for k, v := range tt.loop {
+				loopParams[k] = v
+			}
+
+			workflow := &data.Workflow{
+				Id: "w1",
+				Actions: []data.WorkflowAction{
+					systemStep("loop", "For Each", "after", loopParams),
+					systemStep("double", "Double", "label", nil),
+					systemStep("label", "Label", "", nil),
+					systemStep("after", "Set", "", nil),
+				},
+			}
+
+			result := e.DryRun(context.Background(), workflow, tt.params, nil)
+
+			assert.Equal(t, result.Status, tt.wants.status)
+
+			if tt.wants.status != data.RunStatusSucceeded {
+				assert.StringContains(t, result.Error, tt.wants.err)
+				assert.Equal(t, result.Params["after"], nil)
+				return
+			}
+
+			assert.Equal(t, fmt.Sprint(result.Params["results"]), tt.wants.results)
+			assert.Equal(t, result.Params["itemCount"], interface{}(tt.wants.itemCount))
+			assert.Equal(t, result.Params["failedCount"], interface{}(tt.wants.failedCount))
+			assert.Equal(t, result.Params["after"], interface{}(true))
+
+			// Per-item params stay inside the results.
+			assert.Equal(t, result.Params["item"], nil)
+		})
+	}
+}
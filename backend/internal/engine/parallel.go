@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/providers/system"
+)
+
+type join struct {
+	step              *data.WorkflowAction
+	need              int
+	continueOnFailure bool
+}
+
+// parallelStep runs the branches of the step at the same time, each one a
+// chain of steps that ends when it reaches the Join step the parallel step
+// points to. The params of the Join decide when the branches are done:
+//   - wait: "all" (default), "any" or how many branches have to succeed.
+//   - onFailure: "fail" (default) fails as soon as a branch fails.
+//     "continue" only fails when too few branches succeeded.
+//
+// Once enough branches succeeded, or one failed with onFailure "fail", the
+// rest stop at their next step. What each branch added or changed is
+// merged under branches.<name> and its outcome under branchStatus.<name>.
+func (e *Engine) parallelStep(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, step *data.WorkflowAction) (stepResult, error) {
+	input := stepInput(run.Params, workflow, step)
+	startedAt := time.Now()
+
+	j, err := newJoin(workflow, step)
+	if err != nil {
+		e.recordStep(run, step, data.RunStatusFailed, input, nil, err, startedAt)
+		return stepResult{}, err
+	}
+
+	outputs, statuses, err := e.runBranches(ctx, run, workflow, step, j)
+
+	output := map[string]interface{}{
+		"branches":     outputs,
+		"branchStatus": statuses,
+	}
+
+	if err != nil {
+		e.recordStep(run, step, data.RunStatusFailed, input, output, err, startedAt)
+		return stepResult{}, err
+	}
+
+	e.recordStep(run, step, data.RunStatusSucceeded, input, output, nil, startedAt)
+
+	params := copyParams(run.Params)
+	for k, v := range output {
+		params[k] = v
+	}
+
+	return stepResult{params: params, next: nullString(j.step.Id)}, nil
+}
+
+func (e *Engine) runBranches(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, step *data.WorkflowAction, j *join) (map[string]interface{}, map[string]interface{}, error) {
+	outputs := make(map[string]interface{}, len(step.Branches))
+	statuses := make(map[string]interface{}, len(step.Branches))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var stopped atomic.Bool
+
+	succeeded := 0
+	var firstErr error
+
+	for _, b := range step.Branches {
+		wg.Add(1)
+
+		go func(b data.WorkflowBranch) {
+			defer wg.Done()
+
+			params := copyParams(run.Params)
+
+			output, err := e.runChain(ctx, run, workflow, b.NextActionId, j.step.Id, params, &stopped)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case errors.Is(err, errChainStopped):
+				statuses[b.Name] = data.RunStatusCancelled
+			case err != nil:
+				statuses[b.Name] = data.RunStatusFailed
+				outputs[b.Name] = map[string]interface{}{"error": err.Error()}
+
+				if firstErr == nil {
+					firstErr = fmt.Errorf("branch %s: %w", b.Name, err)
+				}
+
+				if !j.continueOnFailure {
+					stopped.Store(true)
+				}
+			default:
+				statuses[b.Name] = data.RunStatusSucceeded
+				outputs[b.Name] = changedParams(params, output)
+
+				succeeded++
+				if succeeded >= j.need {
+					stopped.Store(true)
+				}
+			}
+		}(b)
+	}
+
+	wg.Wait()
+
+	switch {
+	case succeeded >= j.need:
+		return outputs, statuses, nil
+	case firstErr != nil && !j.continueOnFailure:
+		return outputs, statuses, firstErr
+	default:
+		return outputs, statuses, fmt.Errorf("%d of %d branches succeeded, %d needed", succeeded, len(step.Branches), j.need)
+	}
+}
+
+// joinStep continues the run after a Parallel step. The branches were
+// already joined by then, so it only records that the run got past it.
+func (e *Engine) joinStep(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, step *data.WorkflowAction) (stepResult, error) {
+	input := stepInput(run.Params, workflow, step)
+
+	e.recordStep(run, step, data.RunStatusSucceeded, input, nil, nil, time.Now())
+
+	return stepResult{params: run.Params, next: step.NextActionId}, nil
+}
+
+func newJoin(workflow *data.Workflow, step *data.WorkflowAction) (*join, error) {
+	if len(step.Branches) == 0 {
+		return nil, fmt.Errorf("parallel step %s has no branches", step.Id)
+	}
+
+	joinStep, ok := findAction(workflow, step.NextActionId.String)
+	if !ok || joinStep.Action.Provider.Name != system.ProviderName || joinStep.Action.Operation != "Join" {
+		return nil, fmt.Errorf("parallel step %s must be followed by a Join step", step.Id)
+	}
+
+	j := &join{step: joinStep, need: len(step.Branches)}
+
+	switch v := joinStep.Params["wait"].(type) {
+	case nil:
+	case string:
+		switch v {
+		case "", "all":
+		case "any":
+			j.need = 1
+		default:
+			return nil, fmt.Errorf("wait must be all, any or a number of branches")
+		}
+	default:
+		n, _, err := intParam(joinStep.Params, "wait")
+		if err != nil {
+			return nil, err
+		}
+
+		if n < 1 || n > len(step.Branches) {
+			return nil, fmt.Errorf("wait must be between 1 and %d branches", len(step.Branches))
+		}
+
+		j.need = n
+	}
+
+	switch policy, _ := joinStep.Params["onFailure"].(string); policy {
+	case "", "fail":
+	case "continue":
+		j.continueOnFailure = true
+	default:
+		return nil, fmt.Errorf("onFailure must be fail or continue")
+	}
+
+	return j, nil
+}
@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+type parallelTestResult struct {
+	status       string
+	err          string
+	branchStatus string
+}
+
+func TestParallelStep(t *testing.T) {
+	testMap := []struct {
+		name        string
+		joinParams  map[string]interface{}
+		a1, b1      string
+		withoutJoin bool
+		wants       parallelTestResult
+	}{
+		{
+			name: "Join Waits For All Branches",
+			a1:   "Set",
+			b1:   "Slow",
+			wants: parallelTestResult{
+				status:       data.RunStatusSucceeded,
+				branchStatus: "map[a:succeeded b:succeeded]",
+			},
+		},
+		{
+			name:       "Wait Any Stops The Other Branches",
+			joinParams: map[string]interface{}{"wait": "any"},
+			a1:         "Set",
+			b1:         "Slow",
+			wants: parallelTestResult{
+				status:       data.RunStatusSucceeded,
+				branchStatus: "map[a:succeeded b:cancelled]",
+			},
+		},
+		{
+			name: "Failed Branch Fails The Step",
+			a1:   "Slow",
+			b1:   "Fail",
+			wants: parallelTestResult{
+				status: data.RunStatusFailed,
+				err:    "branch b: boom",
+			},
+		},
+		{
+			name:       "Continue On Failure Succeeds With Enough Branches",
+			joinParams: map[string]interface{}{"wait": 1.0, "onFailure": "continue"},
+			a1:         "Slow",
+			b1:         "Fail",
+			wants: parallelTestResult{
+				status:       data.RunStatusSucceeded,
+				branchStatus: "map[a:succeeded b:failed]",
+			},
+		},
+		{
+			name:       "Continue On Failure Fails With Too Few Branches",
+			joinParams: map[string]interface{}{"onFailure": "continue"},
+			a1:         "Set",
+			b1:         "Fail",
+			wants: parallelTestResult{
+				status: data.RunStatusFailed,
+				err:    "1 of 2 branches succeeded, 2 needed",
+			},
+		},
+		{
+			name:       "Invalid Wait Fails",
+			joinParams: map[string]interface{}{"wait": 3.0},
+			a1:         "Set",
+			b1:         "Set",
+			wants: parallelTestResult{
+				status: data.RunStatusFailed,
+				err:    "wait must be between 1 and 2 branches",
+			},
+		},
+		{
+			name:        "Parallel Without Join Fails",
+			a1:          "Set",
+			b1:          "Set",
+			withoutJoin: true,
+			wants: parallelTestResult{
+				status: data.RunStatusFailed,
+				err:    "must be followed by a Join step",
+			},
+		},
+	}
+
+	e := newDryEngine(stepActions)
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			join := systemStep("join", "Join", "after", tt.joinParams)
+			if tt.withoutJoin {
+				join = systemStep("join", "Set", "after", nil)
+			}
+
+			parallel := systemStep("parallel", "Parallel", "join", nil)
+			parallel.Branches = []data.WorkflowBranch{
+				{Name: "a", NextActionId: "a1"},
+				{Name: "b", NextActionId: "b1"},
+			}
+
+			workflow := &data.Workflow{
+				Id: "w1",
+				Actions: []data.WorkflowAction{
+					parallel,
+					systemStep("a1", tt.a1, "join", nil),
+					systemStep("b1", tt.b1, "b2", nil),
+					systemStep("b2", "Set", "join", nil),
+					join,
+					systemStep("after", "Set", "", nil),
+				},
+			}
+
+			result := e.DryRun(context.Background(), workflow, nil, nil)
+
+			assert.Equal(t, result.Status, tt.wants.status)
+
+			if tt.wants.status != data.RunStatusSucceeded {
+				assert.StringContains(t, result.Error, tt.wants.err)
+				assert.Equal(t, stepIndex(result.Steps, "join"), -1)
+				return
+			}
+
+			assert.Equal(t, fmt.Sprint(result.Params["branchStatus"]), tt.wants.branchStatus)
+			assert.Equal(t, result.Params["after"], interface{}(true))
+
+			// The Join runs once, after every branch stopped.
+			joined := stepIndex(result.Steps, "join")
+			for _, id := range []string{"a1", "b1", "b2"} {
+				assert.Equal(t, stepIndex(result.Steps, id) < joined, true)
+			}
+		})
+	}
+}
+
+func TestParallelBranchOutputs(t *testing.T) {
+	e := newDryEngine(stepActions)
+
+	parallel := systemStep("parallel", "Parallel", "join", nil)
+	parallel.Branches = []data.WorkflowBranch{
+		{Name: "a", NextActionId: "a1"},
+		{Name: "b", NextActionId: "b1"},
+	}
+
+	workflow := &data.Workflow{
+		Id: "w1",
+		Actions: []data.WorkflowAction{
+			parallel,
+			systemStep("a1", "Set", "join", nil),
+			systemStep("b1", "Set", "b2", nil),
+			systemStep("b2", "Set", "join", nil),
+			systemStep("join", "Join", "", nil),
+		},
+	}
+
+	result := e.DryRun(context.Background(), workflow, map[string]interface{}{"name": "Ada"}, nil)
+
+	assert.Equal(t, result.Status, data.RunStatusSucceeded)
+	assert.Equal(t, fmt.Sprint(result.Params["branches"]), "map[a:map[a1:true] b:map[b1:true b2:true]]")
+	assert.Equal(t, result.Params["name"], interface{}("Ada"))
+
+	// What the branches did stays under branches.
+	assert.Equal(t, result.Params["a1"], nil)
+}
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+)
+
+// ReplayFromStart and ReplayFromFailedStep are the points a run can be
+// replayed from besides a step id.
+const (
+	ReplayFromStart      = "start"
+	ReplayFromFailedStep = "failed"
+)
+
+// maxBulkReplays caps how many runs a single bulk re-run queues.
+const maxBulkReplays = 500
+
+// ErrNotReplayable is returned when a run can't be replayed from the point
+// asked for.
+var ErrNotReplayable = errors.New("run can't be replayed")
+
+// Replay queues a new run of the workflow of a finished run, linked to it.
+// The new run starts from the beginning, from the step that failed or from
+// the step with the given id, with the params recorded for that step in the
+// run history, so no trigger has to fire again. The workflow is executed as
+// it is now, not as it was when the run happened.
+func (e *Engine) Replay(ctx context.Context, run *data.WorkflowRun, from string) (*data.WorkflowRun, error) {
+	replay, err := e.newReplay(run, from)
+	if err != nil {
+		return nil, err
+	}
+
+	replay.TraceContext = traceContext(ctx)
+
+	err = e.models.Runs.Insert(replay)
+	if err != nil {
+		return nil, err
+	}
+
+	return replay, nil
+}
+
+// BulkReplay is what a bulk re-run queued. More is set when the window has
+// failed runs beyond maxBulkReplays that weren't looked at; repeating the
+// same re-run queues them, since the runs already re-run are left out.
+type BulkReplay struct {
+	Runs    []*data.WorkflowRun
+	Skipped map[string]string
+	More    bool
+}
+
+// ReplayFailed replays the failed runs of the workflow that finished between
+// since and until, at most maxBulkReplays of them. Runs that were already
+// re-run are left out, so repeating the same bulk re-run doesn't queue them
+// twice. Runs that can't be replayed from the point asked for are returned
+// in Skipped with the reason.
+func (e *Engine) ReplayFailed(ctx context.Context, workflowId string, since, until time.Time, from string) (*BulkReplay, error) {
+	runs, err := e.models.Runs.GetFailed(workflowId, since, until, maxBulkReplays+1)
+	if err != nil {
+		return nil, err
+	}
+
+	bulk := &BulkReplay{
+		Runs:    []*data.WorkflowRun{},
+		Skipped: make(map[string]string),
+	}
+
+	if len(runs) > maxBulkReplays {
+		runs = runs[:maxBulkReplays]
+		bulk.More = true
+	}
+
+	for _, run := range runs {
+		replay, err := e.Replay(ctx, run, from)
+		switch {
+		case errors.Is(err, ErrNotReplayable):
+			bulk.Skipped[run.Id] = err.Error()
+		case err != nil:
+			return bulk, err
+		default:
+			bulk.Runs = append(bulk.Runs, replay)
+		}
+	}
+
+	return bulk, nil
+}
+
+func (e *Engine) newReplay(run *data.WorkflowRun, from string) (*data.WorkflowRun, error) {
+	switch run.Status {
+	case data.RunStatusSucceeded, data.RunStatusFailed, data.RunStatusCancelled:
+	default:
+		return nil, fmt.Errorf("%w: run %s hasn't finished", ErrNotReplayable, run.Id)
+	}
+
+	workflow, err := e.models.Workflows.Get(run.WorkflowId)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := e.models.RunSteps.GetAllForRun(run.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(history) == 0 {
+		return nil, fmt.Errorf("%w: run %s has no recorded steps", ErrNotReplayable, run.Id)
+	}
+
+	replay := &data.WorkflowRun{
+		WorkflowId:    run.WorkflowId,
+		Depth:         run.Depth,
+		ReplayOfRunId: nullString(run.Id),
+	}
+
+	switch from {
+	case "", ReplayFromStart:
+		first := history[0]
+
+		// A run started by a trigger begins with the trigger's output;
+		// any other run begins with the input of its first step.
+		if workflow.TriggerId.Valid && first.WorkflowActionId.String == workflow.TriggerId.String {
+			next, err := firstStep(workflow)
+			if err != nil {
+				return nil, err
+			}
+
+			replay.Params = copyParams(first.Output)
+			replay.NextActionId = next
+		} else {
+			replay.Params = replayParams(first.Input)
+			replay.NextActionId = first.WorkflowActionId
+		}
+	case ReplayFromFailedStep:
+		if run.Status != data.RunStatusFailed || !run.NextActionId.Valid {
+			return nil, fmt.Errorf("%w: run %s has no failed step", ErrNotReplayable, run.Id)
+		}
+
+		return e.replayFromStep(replay, workflow, history, run.NextActionId.String)
+	default:
+		return e.replayFromStep(replay, workflow, history, from)
+	}
+
+	if !replay.NextActionId.Valid {
+		return nil, fmt.Errorf("%w: workflow %s has no step to start from", ErrNotReplayable, workflow.Id)
+	}
+
+	return replay, nil
+}
+
+// replayFromStep starts the replay at the step with the input it was last
+// executed with.
+func (e *Engine) replayFromStep(replay *data.WorkflowRun, workflow *data.Workflow, history []*data.RunStep, stepId string) (*data.WorkflowRun, error) {
+	if _, ok := findAction(workflow, stepId); !ok {
+		return nil, fmt.Errorf("%w: step %s is not part of the workflow", ErrNotReplayable, stepId)
+	}
+
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].WorkflowActionId.String != stepId {
+			continue
+		}
+
+		replay.Params = replayParams(history[i].Input)
+		replay.NextActionId = nullString(stepId)
+
+		return replay, nil
+	}
+
+	return nil, fmt.Errorf("%w: step %s wasn't executed in the run", ErrNotReplayable, stepId)
+}
+
+// replayParams drops the markers a waiting step leaves behind so the step
+// starts over instead of resuming a wait that belongs to the old run.
+func replayParams(input map[string]interface{}) map[string]interface{} {
+	params := copyParams(input)
+
+	delete(params, paramPendingApproval)
+	delete(params, paramPendingChildRun)
+
+	return params
+}
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/executor"
+	"github.com/luisya22/confluo/backend/internal/tests"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+type replayTestResult struct {
+	notReplayable bool
+	params        string
+	next          string
+}
+
+// insertHistory saves the run with status and the steps as its history.
+func insertHistory(t *testing.T, e *Engine, status string, steps ...*data.RunStep) *data.WorkflowRun {
+	t.Helper()
+
+	run := insertRun(t, e)
+
+	// The history is ordered by when the steps started.
+	startedAt := time.Now().Add(-time.Minute)
+
+	for i, step := range steps {
+		step.RunId = run.Id
+		step.StartedAt = startedAt.Add(time.Duration(i) * time.Second)
+		step.FinishedAt = step.StartedAt
+		assert.NilError(t, e.models.RunSteps.Insert(step))
+	}
+
+	run.Status = status
+	if run.Finished() {
+		finishedAt := time.Now()
+		run.FinishedAt = &finishedAt
+	}
+
+	assert.NilError(t, e.models.Runs.Update(run))
+
+	return run
+}
+
+func TestReplay(t *testing.T) {
+	e := newTestEngine(t, executor.Provider{}, Config{})
+
+	trigger := tests.Data.WorkflowActions[0]
+	update := tests.Data.WorkflowActions[1]
+
+	// The trigger fired with an issue and the Update step failed while it
+	// was waiting on a child run.
+	triggered := func() *data.RunStep {
+		return &data.RunStep{
+			WorkflowActionId: nullString(trigger.Id),
+			Status:           data.RunStatusSucceeded,
+			Input:            map[string]interface{}{},
+			Output:           map[string]interface{}{"issue": "Broken build"},
+		}
+	}
+
+	updated := &data.RunStep{
+		WorkflowActionId: nullString(update.Id),
+		Status:           data.RunStatusFailed,
+		Input:            map[string]interface{}{"issue": "Broken build", "attempt": 2.0, paramPendingChildRun: "child"},
+		Error:            "service unavailable",
+	}
+
+	failed := insertHistory(t, e, data.RunStatusFailed, triggered(), updated)
+	succeeded := insertHistory(t, e, data.RunStatusSucceeded, triggered())
+	running := insertHistory(t, e, data.RunStatusRunning, triggered())
+
+	testMap := []struct {
+		name  string
+		run   *data.WorkflowRun
+		from  string
+		wants replayTestResult
+	}{
+		{
+			name:  "From The Start Uses The Trigger Output",
+			run:   failed,
+			from:  ReplayFromStart,
+			wants: replayTestResult{params: "map[issue:Broken build]", next: update.Id},
+		},
+		{
+			name:  "Replays From The Start By Default",
+			run:   succeeded,
+			wants: replayTestResult{params: "map[issue:Broken build]", next: update.Id},
+		},
+		{
+			name:  "From The Failed Step Uses Its Input",
+			run:   failed,
+			from:  ReplayFromFailedStep,
+			wants: replayTestResult{params: "map[attempt:2 issue:Broken build]", next: update.Id},
+		},
+		{
+			name:  "From A Step Uses Its Input",
+			run:   failed,
+			from:  update.Id,
+			wants: replayTestResult{params: "map[attempt:2 issue:Broken build]", next: update.Id},
+		},
+		{
+			name:  "From A Step That Wasn't Executed",
+			run:   succeeded,
+			from:  update.Id,
+			wants: replayTestResult{notReplayable: true},
+		},
+		{
+			name:  "From A Step Of Another Workflow",
+			run:   failed,
+			from:  tests.Data.WorkflowActions[2].Id,
+			wants: replayTestResult{notReplayable: true},
+		},
+		{
+			name:  "From The Failed Step Of A Run That Succeeded",
+			run:   succeeded,
+			from:  ReplayFromFailedStep,
+			wants: replayTestResult{notReplayable: true},
+		},
+		{
+			name:  "Run That Hasn't Finished",
+			run:   running,
+			wants: replayTestResult{notReplayable: true},
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			replay, err := e.Replay(context.Background(), tt.run, tt.from)
+
+			if tt.wants.notReplayable {
+				assert.Equal(t, errors.Is(err, ErrNotReplayable), true)
+				return
+			}
+
+			assert.NilError(t, err)
+
+			got := getRun(t, e, replay.Id)
+			assert.Equal(t, got.Status, data.RunStatusQueued)
+			assert.Equal(t, got.ReplayOfRunId.String, tt.run.Id)
+			assert.Equal(t, got.NextActionId.String, tt.wants.next)
+			assert.Equal(t, fmt.Sprint(got.Params), tt.wants.params)
+		})
+	}
+}
+
+func TestReplayFailed(t *testing.T) {
+	e := newTestEngine(t, executor.Provider{}, Config{})
+
+	step := func() *data.RunStep {
+		return &data.RunStep{
+			WorkflowActionId: nullString(tests.Data.WorkflowActions[1].Id),
+			Status:           data.RunStatusFailed,
+			Input:            map[string]interface{}{"issue": "Broken build"},
+		}
+	}
+
+	first := insertHistory(t, e, data.RunStatusFailed, step())
+	second := insertHistory(t, e, data.RunStatusFailed, step())
+	insertHistory(t, e, data.RunStatusSucceeded, step())
+
+	// Without recorded steps the run can't be replayed.
+	noHistory := insertHistory(t, e, data.RunStatusFailed)
+
+	since := time.Now().Add(-time.Hour)
+	until := time.Now().Add(time.Hour)
+
+	bulk, err := e.ReplayFailed(context.Background(), tests.Data.Workflows[0].Id, since, until, ReplayFromFailedStep)
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(bulk.Runs), 2)
+	assert.Equal(t, bulk.Runs[0].ReplayOfRunId.String, first.Id)
+	assert.Equal(t, bulk.Runs[1].ReplayOfRunId.String, second.Id)
+	assert.Equal(t, len(bulk.Skipped), 1)
+	assert.StringContains(t, bulk.Skipped[noHistory.Id], "no recorded steps")
+	assert.Equal(t, bulk.More, false)
+
+	// Runs that were re-run are left out of the next bulk re-run.
+	bulk, err = e.ReplayFailed(context.Background(), tests.Data.Workflows[0].Id, since, until, ReplayFromFailedStep)
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(bulk.Runs), 0)
+	assert.Equal(t, len(bulk.Skipped), 1)
+}
@@ -0,0 +1,395 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/executor"
+	"github.com/luisya22/confluo/backend/internal/metrics"
+	"github.com/luisya22/confluo/backend/internal/providers/system"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// stepResult is what executing a step leaves behind: the params for the
+// rest of the run, the step that runs next and whether the run has to wait
+// before moving on.
+type stepResult struct {
+	params   map[string]interface{}
+	next     sql.NullString
+	suspend  bool
+	resumeAt *time.Time
+}
+
+// controlStep is a System step the engine runs itself because it decides
+// where the run goes next instead of just producing output.
+type controlStep func(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, step *data.WorkflowAction) (stepResult, error)
+
+func (e *Engine) controlStep(step *data.WorkflowAction) (controlStep, bool) {
+	if step.Action.Provider.Name != system.ProviderName {
+		return nil, false
+	}
+
+	switch step.Action.Operation {
+	case "Approve":
+		return e.approvalStep, true
+	case "For Each":
+		return e.forEachStep, true
+	case "Parallel":
+		return e.parallelStep, true
+	case "Join":
+		return e.joinStep, true
+	case "Call Workflow":
+		return e.callWorkflowStep, true
+	}
+
+	return nil, false
+}
+
+// execute runs the steps of a claimed run one after the other, saving the
+// run after each one so progress survives a restart.
+func (e *Engine) execute(run *data.WorkflowRun) {
+	ctx, span := startRunSpan(run)
+	defer span.End()
+
+	workflow, err := e.models.Workflows.Get(run.WorkflowId)
+	if err != nil {
+		e.failRun(ctx, run, err)
+		return
+	}
+
+	for steps := 0; run.NextActionId.Valid; steps++ {
+		if steps == maxStepsPerRun {
+			e.failRun(ctx, run, fmt.Errorf("run exceeded %d steps", maxStepsPerRun))
+			return
+		}
+
+		step, ok := findAction(workflow, run.NextActionId.String)
+		if !ok {
+			e.failRun(ctx, run, fmt.Errorf("step %s not found", run.NextActionId.String))
+			return
+		}
+
+		result, err := e.runStep(ctx, run, workflow, step)
+		if err != nil {
+			if !e.retryRun(run, err) {
+				e.failRun(ctx, run, err)
+			}
+			return
+		}
+
+		run.Params = result.params
+		run.NextActionId = result.next
+
+		if result.suspend {
+			run.Status = data.RunStatusWaiting
+			run.ResumeAt = result.resumeAt
+			e.saveRun(run)
+			return
+		}
+
+		if !e.saveRun(run) {
+			return
+		}
+	}
+
+	e.finishRun(run, data.RunStatusSucceeded, "")
+}
+
+// runStep runs a step and, when it fails and has an on-error edge, sends the
+// run down that edge with the error in the params instead of failing it.
+func (e *Engine) runStep(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, step *data.WorkflowAction) (stepResult, error) {
+	ctx, span := startStepSpan(ctx, step)
+
+	result, err := e.dispatchStep(ctx, run, workflow, step)
+	endSpan(span, err)
+
+	if err == nil || !step.ErrorActionId.Valid {
+		return result, err
+	}
+
+	params := copyParams(run.Params)
+	params["error"] = map[string]interface{}{
+		"message":  err.Error(),
+		"stepId":   step.Id,
+		"stepText": step.Text,
+		"failedAt": time.Now().Format(time.RFC3339),
+	}
+
+	return stepResult{params: params, next: step.ErrorActionId}, nil
+}
+
+// dispatchStep runs a control step through the engine and any other step
+// through the executor. A step that returns executor.ErrWaiting suspends
+// the run until the resumeAt it set, after which the run continues with the
+// next step.
+func (e *Engine) dispatchStep(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, step *data.WorkflowAction) (stepResult, error) {
+	if e.dry != nil {
+		if mock, ok := e.dry.mocks[step.Id]; ok {
+			return e.mockStep(run, workflow, step, mock), nil
+		}
+	}
+
+	if control, ok := e.controlStep(step); ok {
+		return control(ctx, run, workflow, step)
+	}
+
+	output, err := e.executeStep(ctx, run, workflow, step)
+	switch {
+	case errors.Is(err, executor.ErrWaiting) && e.dry != nil:
+		delete(output, executor.ParamResumeAt)
+
+		return stepResult{params: output, next: step.NextActionId}, nil
+	case errors.Is(err, executor.ErrWaiting):
+		raw, _ := output[executor.ParamResumeAt].(string)
+
+		resumeAt, parseErr := time.Parse(time.RFC3339, raw)
+		if parseErr != nil {
+			return stepResult{}, fmt.Errorf("step %s returned an invalid resume time %q", step.Id, raw)
+		}
+
+		delete(output, executor.ParamResumeAt)
+
+		return stepResult{params: output, next: step.NextActionId, suspend: true, resumeAt: &resumeAt}, nil
+	case err != nil:
+		return stepResult{}, err
+	}
+
+	return stepResult{params: output, next: step.NextActionId}, nil
+}
+
+// executeStep executes one step with the run params and records it in the
+// run history.
+func (e *Engine) executeStep(ctx context.Context, run *data.WorkflowRun, workflow *data.Workflow, step *data.WorkflowAction) (map[string]interface{}, error) {
+	input := stepInput(run.Params, workflow, step)
+	recordedInput := copyParams(input)
+
+	if key, _ := input[executor.ParamIdempotencyKey].(string); key == "" {
+		input[executor.ParamIdempotencyKey] = idempotencyKey(run, step, recordedInput)
+	}
+
+	if e.dry != nil {
+		input[executor.ParamDryRun] = true
+	}
+
+	startedAt := time.Now()
+
+	output, err := e.executor.Execute(ctx, step.Action.Provider.Name, step.Action.Operation, input)
+	output = stripReserved(output)
+
+	status := data.RunStatusSucceeded
+
+	switch {
+	case errors.Is(err, executor.ErrWaiting):
+		status = data.RunStatusWaiting
+	case err != nil:
+		status = data.RunStatusFailed
+	}
+
+	e.recordStep(run, step, status, recordedInput, output, err, startedAt)
+
+	return output, err
+}
+
+// recordStep adds an entry to the run history, or to the dry run trace on a
+// dry run. Failing to record is logged but doesn't stop the run.
+func (e *Engine) recordStep(run *data.WorkflowRun, step *data.WorkflowAction, status string, input, output map[string]interface{}, err error, startedAt time.Time) {
+	record := &data.RunStep{
+		RunId:            run.Id,
+		WorkflowActionId: nullString(step.Id),
+		Status:           status,
+		Input:            stripReserved(input),
+		Output:           output,
+		StartedAt:        startedAt,
+		FinishedAt:       time.Now(),
+	}
+
+	if err != nil && !errors.Is(err, executor.ErrWaiting) {
+		record.Error = err.Error()
+	}
+
+	if e.dry != nil {
+		e.dry.add(record)
+		return
+	}
+
+	if insertErr := e.models.RunSteps.Insert(record); insertErr != nil {
+		e.logger.Error(insertErr.Error(), "run_id", run.Id)
+	}
+}
+
+func (e *Engine) failRun(ctx context.Context, run *data.WorkflowRun, err error) {
+	e.logger.Error(err.Error(), "run_id", run.Id, "workflow_id", run.WorkflowId)
+
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	failedActionId := run.NextActionId
+
+	if e.finishRun(run, data.RunStatusFailed, err.Error()) {
+		e.deadLetter(run, failedActionId)
+		e.startErrorHandler(ctx, run, failedActionId)
+	}
+}
+
+// retryRun parks a run whose step failed until its next retry, keeping it
+// on the failed step, and records the failure as an attempt. It reports
+// whether the run will be retried; runs that used up their retries are
+// left to fail.
+func (e *Engine) retryRun(run *data.WorkflowRun, err error) bool {
+	if run.Retries >= e.config.RetryAttempts {
+		return false
+	}
+
+	attempt := &data.DeadLetterAttempt{
+		RunId:            run.Id,
+		WorkflowActionId: run.NextActionId,
+		Error:            err.Error(),
+	}
+
+	if err := e.models.DeadLetters.InsertAttempt(attempt); err != nil {
+		e.logger.Error(err.Error(), "run_id", run.Id)
+	}
+
+	resumeAt := time.Now().Add(e.retryBackoff(run.Retries))
+
+	run.Retries++
+	run.Status = data.RunStatusWaiting
+	run.Error = err.Error()
+	run.ResumeAt = &resumeAt
+
+	if e.saveRun(run) {
+		e.logger.Warn("run will be retried", "run_id", run.Id, "retries", run.Retries, "resume_at", resumeAt, "error", err.Error())
+	}
+
+	return true
+}
+
+// retryBackoff is the wait before retry number retries+1.
+func (e *Engine) retryBackoff(retries int) time.Duration {
+	backoff := e.config.RetryBackoff
+	for i := 0; i < retries && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, maxRetryBackoff)
+}
+
+// finishRun saves the run as finished and reports whether it was saved.
+func (e *Engine) finishRun(run *data.WorkflowRun, status string, message string) bool {
+	finishedAt := time.Now()
+
+	run.Status = status
+	run.Error = message
+	run.FinishedAt = &finishedAt
+
+	if !e.saveRun(run) {
+		return false
+	}
+
+	metrics.ObserveRunFinished(status, finishedAt.Sub(run.CreatedAt))
+
+	e.wakeParent(run)
+
+	return true
+}
+
+// saveRun persists the run and reports whether its execution can go on.
+// An edit conflict means the run changed underneath the worker, which is
+// how a cancellation reaches a run that is executing.
+func (e *Engine) saveRun(run *data.WorkflowRun) bool {
+	err := e.models.Runs.Update(run)
+	if err == nil {
+		return true
+	}
+
+	if errors.Is(err, data.ErrEditConflict) {
+		current, getErr := e.models.Runs.Get(run.Id)
+		if getErr == nil && current.Status == data.RunStatusCancelled {
+			e.logger.Info("run cancelled", "run_id", run.Id)
+			return false
+		}
+	}
+
+	e.logger.Error(err.Error(), "run_id", run.Id)
+
+	return false
+}
+
+// stepInput builds the params for a step: the run params, overridden by the
+// params configured on the step, plus the keys the runner provides.
+func stepInput(params map[string]interface{}, workflow *data.Workflow, step *data.WorkflowAction) map[string]interface{} {
+	input := copyParams(params)
+
+	for k, v := range step.Params {
+		input[k] = v
+	}
+
+	input[executor.ParamWorkflowActionId] = step.Id
+	input[executor.ParamUserId] = workflow.UserId
+	input[executor.ParamWorkspaceId] = workflow.WorkspaceId
+
+	return input
+}
+
+func stripReserved(params map[string]interface{}) map[string]interface{} {
+	stripped := copyParams(params)
+
+	delete(stripped, executor.ParamWorkflowActionId)
+	delete(stripped, executor.ParamUserId)
+	delete(stripped, executor.ParamWorkspaceId)
+	delete(stripped, executor.ParamIdempotencyKey)
+	delete(stripped, executor.ParamDryRun)
+
+	return stripped
+}
+
+// idempotencyKey derives the key a step passes to providers from the run,
+// the step and its input, so executing the step again after a crash or a
+// retry sends the same key while each item of a for-each gets its own.
+func idempotencyKey(run *data.WorkflowRun, step *data.WorkflowAction, input map[string]interface{}) string {
+	h := sha256.New()
+
+	h.Write([]byte(run.Id))
+	h.Write([]byte{0})
+	h.Write([]byte(step.Id))
+	h.Write([]byte{0})
+
+	// encoding/json sorts map keys, so equal params hash the same.
+	inputJSON, _ := json.Marshal(stripReserved(input))
+	h.Write(inputJSON)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func copyParams(params map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(params))
+
+	for k, v := range params {
+		c[k] = v
+	}
+
+	return c
+}
+
+func findAction(workflow *data.Workflow, id string) (*data.WorkflowAction, bool) {
+	for i := range workflow.Actions {
+		if workflow.Actions[i].Id == id {
+			return &workflow.Actions[i], true
+		}
+	}
+
+	return nil, false
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
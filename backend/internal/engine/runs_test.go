@@ -0,0 +1,127 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	e := &Engine{config: Config{RetryBackoff: 30 * time.Second}}
+
+	testMap := []struct {
+		retries int
+		backoff time.Duration
+	}{
+		{retries: 0, backoff: 30 * time.Second},
+		{retries: 1, backoff: time.Minute},
+		{retries: 2, backoff: 2 * time.Minute},
+		{retries: 6, backoff: 32 * time.Minute},
+		{retries: 7, backoff: maxRetryBackoff},
+		{retries: 1000, backoff: maxRetryBackoff},
+	}
+
+	for _, tt := range testMap {
+		assert.Equal(t, e.retryBackoff(tt.retries), tt.backoff)
+	}
+}
+
+func TestDryRunsGetTheirOwnIdempotencyKeys(t *testing.T) {
+	workflow := &data.Workflow{Id: "w1"}
+	step := &data.WorkflowAction{Id: "s1"}
+	params := map[string]interface{}{"issueTitle": "Broken build"}
+
+	first := newDryRun(workflow, params)
+	second := newDryRun(workflow, params)
+
+	assert.NotEqual(t, first.Id, "")
+	assert.NotEqual(t, idempotencyKey(first, step, params), idempotencyKey(second, step, params))
+}
+
+type errorEdgeTestResult struct {
+	status  string
+	err     string
+	visited string
+	skipped string
+}
+
+func TestErrorEdge(t *testing.T) {
+	testMap := []struct {
+		name      string
+		operation string
+		edge      bool
+		wants     errorEdgeTestResult
+	}{
+		{
+			name:      "Failed Step Takes Its Error Edge",
+			operation: "Fail",
+			edge:      true,
+			wants: errorEdgeTestResult{
+				status:  data.RunStatusSucceeded,
+				visited: "handle",
+				skipped: "next",
+			},
+		},
+		{
+			name:      "Failed Step Without Error Edge Fails The Run",
+			operation: "Fail",
+			wants: errorEdgeTestResult{
+				status: data.RunStatusFailed,
+				err:    "boom",
+			},
+		},
+		{
+			name:      "Succeeded Step Ignores Its Error Edge",
+			operation: "Set",
+			edge:      true,
+			wants: errorEdgeTestResult{
+				status:  data.RunStatusSucceeded,
+				visited: "next",
+				skipped: "handle",
+			},
+		},
+	}
+
+	e := newDryEngine(stepActions)
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			step := systemStep("step", tt.operation, "next", nil)
+
+			workflow := &data.Workflow{
+				Id:      "w1",
+				Actions: []data.WorkflowAction{step, systemStep("next", "Set", "", nil)},
+			}
+
+			if tt.edge {
+				workflow.Actions[0].ErrorActionId = nullString("handle")
+				workflow.Actions = append(workflow.Actions, systemStep("handle", "Set", "", nil))
+			}
+
+			result := e.DryRun(context.Background(), workflow, nil, nil)
+
+			assert.Equal(t, result.Status, tt.wants.status)
+
+			if tt.wants.status != data.RunStatusSucceeded {
+				assert.StringContains(t, result.Error, tt.wants.err)
+				return
+			}
+
+			assert.Equal(t, result.Params[tt.wants.visited], interface{}(true))
+			assert.Equal(t, result.Params[tt.wants.skipped], nil)
+
+			// The error edge gets what failed in the error param.
+			failure, _ := result.Params["error"].(map[string]interface{})
+			if tt.operation != "Fail" {
+				assert.Equal(t, failure == nil, true)
+				return
+			}
+
+			assert.Equal(t, failure["message"], interface{}("boom"))
+			assert.Equal(t, failure["stepId"], interface{}("step"))
+		})
+	}
+}
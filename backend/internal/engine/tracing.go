@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"context"
+	"errors"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/executor"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/luisya22/confluo/backend/internal/engine")
+
+// traceContext returns the trace context of ctx the way it is stored on a
+// run, or nil when ctx isn't traced.
+func traceContext(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	if len(carrier) == 0 {
+		return nil
+	}
+
+	return carrier
+}
+
+// startRunSpan starts the span of an execution of the run. A run can sit in
+// the queue or wait on a timer for days, so instead of joining the trace of
+// whatever queued it, like the request that re-ran it or the step that
+// called it, the execution starts a trace of its own linked to that one.
+func startRunSpan(run *data.WorkflowRun) (context.Context, trace.Span) {
+	opts := []trace.SpanStartOption{
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("confluo.run.id", run.Id),
+			attribute.String("confluo.workflow.id", run.WorkflowId),
+			attribute.Int("confluo.run.depth", run.Depth),
+		),
+	}
+
+	queued := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(run.TraceContext))
+	if sc := trace.SpanContextFromContext(queued); sc.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: sc}))
+	}
+
+	return tracer.Start(context.Background(), "run", opts...)
+}
+
+func startStepSpan(ctx context.Context, step *data.WorkflowAction) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "step "+step.Action.Provider.Name+"/"+step.Action.Operation, trace.WithAttributes(
+		attribute.String("confluo.step.id", step.Id),
+		attribute.String("confluo.provider", step.Action.Provider.Name),
+		attribute.String("confluo.action", step.Action.Operation),
+	))
+}
+
+// endSpan marks the span as failed when err is an actual failure and ends
+// it.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, executor.ErrWaiting) && !errors.Is(err, executor.ErrNotTriggered) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/executor"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func (e *Engine) pollTriggers() {
+	ids, err := e.models.Workflows.GetIdsWithTrigger()
+	if err != nil {
+		e.logger.Error(err.Error())
+		return
+	}
+
+	for _, id := range ids {
+		ctx, span := tracer.Start(context.Background(), "trigger poll", trace.WithAttributes(
+			attribute.String("confluo.workflow.id", id),
+		))
+
+		err := e.pollTrigger(ctx, id)
+		endSpan(span, err)
+
+		if err != nil {
+			e.logger.Error(err.Error(), "workflow_id", id)
+		}
+	}
+}
+
+// pollTrigger executes the workflow trigger and queues a run when it fires.
+// Whatever state the trigger returns, like a cursor, is saved back to its
+// params for the next poll. The run is linked to the trace of the poll.
+func (e *Engine) pollTrigger(ctx context.Context, workflowId string) error {
+	workflow, err := e.models.Workflows.Get(workflowId)
+	if err != nil {
+		return err
+	}
+
+	trigger, ok := findAction(workflow, workflow.TriggerId.String)
+	if !ok {
+		return fmt.Errorf("trigger %s not found", workflow.TriggerId.String)
+	}
+
+	input := stepInput(nil, workflow, trigger)
+	recordedInput := copyParams(input)
+
+	startedAt := time.Now()
+
+	output, err := e.executor.Execute(ctx, trigger.Action.Provider.Name, trigger.Action.Operation, input)
+	if errors.Is(err, executor.ErrNotTriggered) {
+		return e.saveTriggerState(trigger, output)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	params := stripReserved(output)
+
+	dedupeKey := triggerDedupeKey(params)
+	if dedupeKey != "" {
+		claimed, err := e.models.TriggerEvents.Claim(workflow.Id, dedupeKey, e.config.DedupeRetention)
+		if err != nil {
+			return err
+		}
+
+		if !claimed {
+			e.logger.Info("skipped duplicate trigger event", "workflow_id", workflow.Id, "dedupe_key", dedupeKey)
+			return e.saveTriggerState(trigger, output)
+		}
+	}
+
+	run := &data.WorkflowRun{
+		WorkflowId:   workflow.Id,
+		Status:       data.RunStatusQueued,
+		Params:       params,
+		NextActionId: trigger.NextActionId,
+		TraceContext: traceContext(ctx),
+	}
+
+	err = e.models.Runs.Insert(run)
+	if err != nil {
+		if dedupeKey != "" {
+			if releaseErr := e.models.TriggerEvents.Release(workflow.Id, dedupeKey); releaseErr != nil {
+				e.logger.Error(releaseErr.Error(), "workflow_id", workflow.Id)
+			}
+		}
+
+		return err
+	}
+
+	if dedupeKey != "" {
+		if err := e.models.TriggerEvents.SetRun(workflow.Id, dedupeKey, run.Id); err != nil {
+			e.logger.Error(err.Error(), "run_id", run.Id)
+		}
+	}
+
+	step := &data.RunStep{
+		RunId:            run.Id,
+		WorkflowActionId: nullString(trigger.Id),
+		Status:           data.RunStatusSucceeded,
+		Input:            stripReserved(recordedInput),
+		Output:           params,
+		StartedAt:        startedAt,
+		FinishedAt:       time.Now(),
+	}
+
+	err = e.models.RunSteps.Insert(step)
+	if err != nil {
+		e.logger.Error(err.Error(), "run_id", run.Id)
+	}
+
+	return e.saveTriggerState(trigger, output)
+}
+
+func (e *Engine) saveTriggerState(trigger *data.WorkflowAction, output map[string]interface{}) error {
+	state := stripReserved(output)
+	delete(state, executor.ParamDedupeKey)
+
+	if reflect.DeepEqual(state, trigger.Params) {
+		return nil
+	}
+
+	trigger.Params = state
+
+	return e.models.WorkflowActions.Update(trigger)
+}
+
+// triggerDedupeKey returns the dedupe key the trigger set on its output, if
+// any.
+func triggerDedupeKey(params map[string]interface{}) string {
+	switch v := params[executor.ParamDedupeKey].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/executor"
+	"github.com/luisya22/confluo/backend/internal/tests"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestPollTriggerSavesState(t *testing.T) {
+	// The trigger fires on the first poll only. Every poll moves its cursor,
+	// which it reads back from the params saved by the poll before.
+	e := newTestEngine(t, executor.Provider{
+		"Create": func(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+			cursor, _ := params["cursor"].(float64)
+			params["cursor"] = cursor + 1
+
+			if cursor > 0 {
+				return params, executor.ErrNotTriggered
+			}
+
+			params["issue"] = "Broken build"
+			params[executor.ParamDedupeKey] = "octocat/hello#1"
+
+			return params, nil
+		},
+	}, Config{})
+
+	workflow := tests.Data.Workflows[0]
+	trigger := tests.Data.WorkflowActions[0]
+
+	testMap := []struct {
+		name   string
+		cursor float64
+		queued bool
+	}{
+		{name: "First Poll Queues A Run", cursor: 1, queued: true},
+		{name: "Second Poll Only Saves State", cursor: 2, queued: false},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			err := e.pollTrigger(context.Background(), workflow.Id)
+			assert.NilError(t, err)
+
+			saved, err := e.models.WorkflowActions.Get(trigger.Id)
+			assert.NilError(t, err)
+			assert.Equal(t, saved.Params["cursor"], interface{}(tt.cursor))
+			assert.Equal(t, saved.Params[executor.ParamDedupeKey], nil)
+			assert.Equal(t, saved.Params[executor.ParamWorkflowActionId], nil)
+
+			run, err := e.models.Runs.ClaimNext(e.config.RunLease)
+			if !tt.queued {
+				assert.Equal(t, errors.Is(err, data.ErrRecordNotFound), true)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, run.WorkflowId, workflow.Id)
+			assert.Equal(t, run.NextActionId.String, trigger.NextActionId.String)
+			assert.Equal(t, run.Params["issue"], interface{}("Broken build"))
+			assert.Equal(t, run.Params[executor.ParamUserId], nil)
+
+			steps, err := e.models.RunSteps.GetAllForRun(run.Id)
+			assert.NilError(t, err)
+			assert.Equal(t, len(steps), 1)
+			assert.Equal(t, steps[0].WorkflowActionId.String, trigger.Id)
+		})
+	}
+}
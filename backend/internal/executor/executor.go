@@ -1,6 +1,13 @@
 package executor
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/metrics"
+)
 
 // Interface for all the other packages
 // Way to send to DB providers and actions
@@ -9,13 +16,41 @@ type Executor struct {
 	providers map[string]Provider
 }
 
-type Action func(map[string]interface{}) (map[string]interface{}, error)
+// Action executes one operation of a provider. ctx carries the span of the
+// step being executed, so the calls an action makes are traced under it.
+type Action func(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error)
 type Provider map[string]Action
 
+// Keys the runner sets on params before an action is executed.
+// ParamIdempotencyKey stays the same when a step is executed again with the
+// same input in the same run, so actions can pass it to APIs that support
+// idempotent requests.
+const (
+	ParamWorkflowActionId = "workflowActionId"
+	ParamUserId           = "userId"
+	ParamWorkspaceId      = "workspaceId"
+	ParamIdempotencyKey   = "idempotencyKey"
+)
+
+// ParamDedupeKey is set by triggers to identify the event they fired for,
+// e.g. "owner/repo#42". A workflow doesn't start a second run for a key it
+// has already seen within the dedupe retention window.
+const ParamDedupeKey = "dedupeKey"
+
+// ParamDryRun is set to true when the step is executed by a dry run, so
+// actions with side effects they keep track of, like webhook deliveries,
+// can leave nothing behind.
+const ParamDryRun = "dryRun"
+
+// ParamResumeAt is set by actions that return ErrWaiting to say when the
+// run should continue, as an RFC3339 timestamp.
+const ParamResumeAt = "resumeAt"
+
 var (
 	ErrProviderNotFound = errors.New("provider not found")
 	ErrActionNotFound   = errors.New("action not found")
 	ErrNotTriggered     = errors.New("action not triggered")
+	ErrWaiting          = errors.New("action waiting")
 )
 
 func NewExecutor() *Executor {
@@ -31,16 +66,51 @@ func (e *Executor) Subscribe(name string, p Provider) error {
 	return nil
 }
 
-func (e *Executor) Execute(provider string, action string, params map[string]interface{}) (map[string]interface{}, error) {
+// Providers returns the names of the subscribed providers, sorted.
+func (e *Executor) Providers() []string {
+	names := make([]string, 0, len(e.providers))
+	for name := range e.providers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Execute runs the action of the provider with params and records how long
+// it took and how it went in the executor metrics.
+func (e *Executor) Execute(ctx context.Context, provider string, action string, params map[string]interface{}) (map[string]interface{}, error) {
 	p, ok := e.providers[provider]
 	if !ok {
+		metrics.ObserveExecution(metrics.Unknown, metrics.Unknown, metrics.ResultError, 0)
 		return params, ErrProviderNotFound
 	}
 
 	a, ok := p[action]
 	if !ok {
+		metrics.ObserveExecution(provider, metrics.Unknown, metrics.ResultError, 0)
 		return params, ErrActionNotFound
 	}
 
-	return a(params)
+	start := time.Now()
+
+	output, err := a(ctx, params)
+
+	metrics.ObserveExecution(provider, action, executionResult(err), time.Since(start))
+
+	return output, err
+}
+
+func executionResult(err error) string {
+	switch {
+	case err == nil:
+		return metrics.ResultSuccess
+	case errors.Is(err, ErrWaiting):
+		return metrics.ResultWaiting
+	case errors.Is(err, ErrNotTriggered):
+		return metrics.ResultNotTriggered
+	default:
+		return metrics.ResultError
+	}
 }
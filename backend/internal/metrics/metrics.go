@@ -0,0 +1,168 @@
+// Package metrics holds the Prometheus metrics of confluo. They are
+// registered on Registry, which the API serves at /metrics.
+//
+// Labels only ever hold values from a small, fixed set, like route patterns,
+// run statuses or provider and action names, and never ids, so the number of
+// series stays bounded.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "confluo"
+
+// Unknown is the label value used for a provider or an action that isn't
+// registered, so a bad workflow can't add series.
+const Unknown = "unknown"
+
+// Results of an action execution.
+const (
+	ResultSuccess      = "success"
+	ResultError        = "error"
+	ResultWaiting      = "waiting"
+	ResultNotTriggered = "not_triggered"
+)
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of the HTTP requests by method, route pattern and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+
+	runsFinished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "runs_finished_total",
+		Help:      "Workflow runs that finished, by status.",
+	}, []string{"status"})
+
+	runDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "run_duration_seconds",
+		Help:      "Time from the creation of a workflow run to its end, by status.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 15, 60, 300, 900, 3600, 4 * 3600, 24 * 3600},
+	}, []string{"status"})
+
+	runsInQueue = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "runs",
+		Help:      "Workflow runs that haven't finished, by status.",
+	}, []string{"status"})
+
+	schedulerLag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "scheduler_lag_seconds",
+		Help:      "How long the oldest queued run has waited for a worker, or the most overdue waiting run for its timer.",
+	})
+
+	deadLetters = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "dead_letters_pending",
+		Help:      "Pending dead letters, by provider.",
+	}, []string{"provider"})
+
+	executionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "executor",
+		Name:      "execution_duration_seconds",
+		Help:      "Duration of the action executions, by provider and action.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider", "action"})
+
+	executions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "executor",
+		Name:      "executions_total",
+		Help:      "Action executions, by provider, action and result.",
+	}, []string{"provider", "action", "result"})
+
+	githubRateLimitRemaining = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "github",
+		Name:      "rate_limit_remaining",
+		Help:      "Requests left in the Github API rate limit window, as of the last response.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestDuration,
+		runsFinished,
+		runDuration,
+		runsInQueue,
+		schedulerLag,
+		deadLetters,
+		executionDuration,
+		executions,
+		githubRateLimitRemaining,
+	)
+}
+
+// ObserveHTTPRequest records a served request. route is the route pattern
+// the request matched, not its path, and methods other than the standard
+// ones are recorded as "other".
+func ObserveHTTPRequest(method, route string, code int, duration time.Duration) {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		method = "other"
+	}
+
+	httpRequestDuration.WithLabelValues(method, route, strconv.Itoa(code)).Observe(duration.Seconds())
+}
+
+// ObserveRunFinished records a run that ended with status.
+func ObserveRunFinished(status string, duration time.Duration) {
+	runsFinished.WithLabelValues(status).Inc()
+	runDuration.WithLabelValues(status).Observe(duration.Seconds())
+}
+
+// SetQueue sets the number of unfinished runs per status and the scheduler
+// lag.
+func SetQueue(runs map[string]int, lag time.Duration) {
+	for status, count := range runs {
+		runsInQueue.WithLabelValues(status).Set(float64(count))
+	}
+
+	schedulerLag.Set(lag.Seconds())
+}
+
+// SetDeadLetters sets the pending dead letters per provider. Providers that
+// aren't in byProvider anymore are reset. The depth per workflow is served
+// by the API instead, since workflow ids can't be labels.
+func SetDeadLetters(byProvider map[string]int) {
+	deadLetters.Reset()
+
+	for provider, count := range byProvider {
+		deadLetters.WithLabelValues(provider).Set(float64(count))
+	}
+}
+
+// ObserveExecution records an action execution and its result.
+func ObserveExecution(provider, action, result string, duration time.Duration) {
+	executionDuration.WithLabelValues(provider, action).Observe(duration.Seconds())
+	executions.WithLabelValues(provider, action, result).Inc()
+}
+
+// SetGithubRateLimitRemaining records the rate limit a Github API response
+// reported.
+func SetGithubRateLimitRemaining(remaining int) {
+	githubRateLimitRemaining.Set(float64(remaining))
+}
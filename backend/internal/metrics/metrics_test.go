@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSetDeadLetters(t *testing.T) {
+	SetDeadLetters(map[string]int{"Github": 2, "HTTP": 1})
+
+	assert.Equal(t, testutil.CollectAndCount(deadLetters), 2)
+	assert.Equal(t, testutil.ToFloat64(deadLetters.WithLabelValues("Github")), 2.0)
+
+	// Providers without pending dead letters are dropped.
+	SetDeadLetters(map[string]int{"HTTP": 3})
+
+	assert.Equal(t, testutil.CollectAndCount(deadLetters), 1)
+	assert.Equal(t, testutil.ToFloat64(deadLetters.WithLabelValues("HTTP")), 3.0)
+}
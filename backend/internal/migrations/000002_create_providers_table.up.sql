@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS providers (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name varchar(50) NOT NULL,
+  logo text NOT NULL,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+  version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS actions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  operation varchar(50) NOT NULL,
+  provider_id UUID NOT NULL,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+  version INTEGER NOT NULL DEFAULT 1
+);
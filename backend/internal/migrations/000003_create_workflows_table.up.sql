@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS workflows (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id),
+  name VARCHAR(50) NOT NULL,
+  trigger_id UUID,
+  error_workflow_id UUID REFERENCES workflows(id) ON DELETE SET NULL,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+  version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS workflow_actions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  text VARCHAR(255),
+  type VARCHAR(50),
+  params JSONB,
+  workflow_id UUID NOT NULL REFERENCES workflows(id),
+  action_id uuid NOT NULL REFERENCES actions(id),
+  next_action_id UUID,
+  error_action_id UUID REFERENCES workflow_actions(id) ON DELETE SET NULL,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+  version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS workflow_action_branches (
+  workflow_action_id UUID NOT NULL REFERENCES workflow_actions(id) ON DELETE CASCADE,
+  name VARCHAR(50) NOT NULL,
+  next_action_id UUID NOT NULL REFERENCES workflow_actions(id) ON DELETE CASCADE,
+  position INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (workflow_action_id, name)
+);
+
+ALTER TABLE workflows ADD CONSTRAINT fk_workflow_workflow_actions
+  FOREIGN KEY (trigger_id) REFERENCES workflow_actions(id);
+
+ALTER TABLE workflow_actions ADD CONSTRAINT fk_workflow_actions_workflow
+  FOREIGN KEY (next_action_id) REFERENCES workflow_actions(id);
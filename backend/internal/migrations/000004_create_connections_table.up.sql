@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS connections (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id),
+  name VARCHAR(50) NOT NULL,
+  type VARCHAR(50) NOT NULL,
+  credentials JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+  version INTEGER NOT NULL DEFAULT 1
+);
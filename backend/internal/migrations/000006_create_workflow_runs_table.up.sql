@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS workflow_runs (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  workflow_id UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+  parent_run_id UUID REFERENCES workflow_runs(id) ON DELETE SET NULL,
+  depth INTEGER NOT NULL DEFAULT 0,
+  replay_of_run_id UUID REFERENCES workflow_runs(id) ON DELETE SET NULL,
+  status VARCHAR(20) NOT NULL DEFAULT 'queued',
+  params JSONB NOT NULL DEFAULT '{}',
+  next_action_id UUID REFERENCES workflow_actions(id) ON DELETE SET NULL,
+  error TEXT NOT NULL DEFAULT '',
+  resume_at TIMESTAMP WITH TIME ZONE,
+  started_at TIMESTAMP WITH TIME ZONE,
+  finished_at TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS workflow_runs_status_idx ON workflow_runs (status, created_at);
+CREATE INDEX IF NOT EXISTS workflow_runs_parent_run_id_idx ON workflow_runs (parent_run_id);
+CREATE INDEX IF NOT EXISTS workflow_runs_replay_of_run_id_idx ON workflow_runs (replay_of_run_id);
+CREATE INDEX IF NOT EXISTS workflow_runs_workflow_id_idx ON workflow_runs (workflow_id, status, finished_at);
+CREATE INDEX IF NOT EXISTS workflow_runs_resume_at_idx ON workflow_runs (resume_at) WHERE status = 'waiting';
+
+CREATE TABLE IF NOT EXISTS run_steps (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  run_id UUID NOT NULL REFERENCES workflow_runs(id) ON DELETE CASCADE,
+  workflow_action_id UUID REFERENCES workflow_actions(id) ON DELETE SET NULL,
+  status VARCHAR(20) NOT NULL,
+  input JSONB,
+  output JSONB,
+  error TEXT NOT NULL DEFAULT '',
+  started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  finished_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS trigger_events (
+  workflow_id UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+  dedupe_key TEXT NOT NULL,
+  run_id UUID REFERENCES workflow_runs(id) ON DELETE SET NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  PRIMARY KEY (workflow_id, dedupe_key)
+);
+
+CREATE INDEX IF NOT EXISTS trigger_events_created_at_idx ON trigger_events (created_at);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS dead_letters (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  run_id UUID NOT NULL UNIQUE REFERENCES workflow_runs(id) ON DELETE CASCADE,
+  workflow_id UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+  workflow_action_id UUID REFERENCES workflow_actions(id) ON DELETE SET NULL,
+  provider VARCHAR(255) NOT NULL DEFAULT '',
+  params JSONB NOT NULL DEFAULT '{}',
+  error TEXT NOT NULL DEFAULT '',
+  attempts INTEGER NOT NULL DEFAULT 1,
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS dead_letters_status_idx ON dead_letters (status, workflow_id);
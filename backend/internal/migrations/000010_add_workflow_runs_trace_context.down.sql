@@ -0,0 +1 @@
+ALTER TABLE workflow_runs DROP COLUMN IF EXISTS trace_context;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS workflow_runs_workflow_created_idx;
+DROP INDEX IF EXISTS workflows_tags_idx;
+
+ALTER TABLE workflows DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS workflow_runs_search_vector_idx;
+DROP INDEX IF EXISTS workflow_actions_search_vector_idx;
+DROP INDEX IF EXISTS workflows_search_vector_idx;
+
+DROP TRIGGER IF EXISTS workflow_actions_search_vector_trigger ON workflow_actions;
+DROP FUNCTION IF EXISTS workflow_actions_search_vector();
+
+ALTER TABLE workflow_actions DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE workflow_runs DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE workflows DROP COLUMN IF EXISTS search_vector;
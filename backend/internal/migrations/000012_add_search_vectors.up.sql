@@ -0,0 +1,34 @@
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+  GENERATED ALWAYS AS (setweight(to_tsvector('english', name), 'A')) STORED;
+
+ALTER TABLE workflow_runs ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+  GENERATED ALWAYS AS (setweight(to_tsvector('english', error), 'C')) STORED;
+
+-- A step is found by its text and by the provider and operation it runs,
+-- which live in other tables, so its vector is kept by a trigger.
+ALTER TABLE workflow_actions ADD COLUMN IF NOT EXISTS search_vector TSVECTOR NOT NULL DEFAULT ''::tsvector;
+
+CREATE OR REPLACE FUNCTION workflow_actions_search_vector() RETURNS trigger AS $$
+BEGIN
+  NEW.search_vector :=
+    setweight(to_tsvector('english', coalesce(NEW.text, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce((
+      SELECT p.name || ' ' || a.operation
+      FROM actions a
+      INNER JOIN providers p ON a.provider_id = p.id
+      WHERE a.id = NEW.action_id
+    ), '')), 'B');
+
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workflow_actions_search_vector_trigger
+  BEFORE INSERT OR UPDATE OF text, action_id ON workflow_actions
+  FOR EACH ROW EXECUTE FUNCTION workflow_actions_search_vector();
+
+UPDATE workflow_actions SET text = text;
+
+CREATE INDEX IF NOT EXISTS workflows_search_vector_idx ON workflows USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS workflow_actions_search_vector_idx ON workflow_actions USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS workflow_runs_search_vector_idx ON workflow_runs USING GIN (search_vector);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS connections_workspace_id_idx;
+DROP INDEX IF EXISTS workflows_workspace_id_idx;
+
+ALTER TABLE connections DROP COLUMN IF EXISTS workspace_id;
+ALTER TABLE workflows DROP COLUMN IF EXISTS workspace_id;
+
+DROP TABLE IF EXISTS workspace_invitations;
+DROP TABLE IF EXISTS workspace_members;
+DROP TABLE IF EXISTS workspaces;
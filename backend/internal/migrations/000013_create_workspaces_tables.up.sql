@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS workspaces (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name VARCHAR(50) NOT NULL,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+  version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+  workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role VARCHAR(20) NOT NULL,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now(),
+  PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS workspace_members_user_id_idx ON workspace_members (user_id);
+
+CREATE TABLE IF NOT EXISTS workspace_invitations (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+  hash BYTEA NOT NULL UNIQUE,
+  email TEXT NOT NULL DEFAULT '',
+  role VARCHAR(20) NOT NULL,
+  invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  expiry TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+  created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS workspace_invitations_workspace_id_idx ON workspace_invitations (workspace_id);
+
+-- Every user gets a personal workspace that takes the user's id, so the
+-- workflows and connections they own can be moved into it.
+INSERT INTO workspaces (id, name) SELECT id, 'Personal' FROM users;
+INSERT INTO workspace_members (workspace_id, user_id, role) SELECT id, id, 'owner' FROM users;
+
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS workspace_id UUID REFERENCES workspaces(id);
+UPDATE workflows SET workspace_id = user_id;
+ALTER TABLE workflows ALTER COLUMN workspace_id SET NOT NULL;
+
+ALTER TABLE connections ADD COLUMN IF NOT EXISTS workspace_id UUID REFERENCES workspaces(id);
+UPDATE connections SET workspace_id = user_id;
+ALTER TABLE connections ALTER COLUMN workspace_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS workflows_workspace_id_idx ON workflows (workspace_id);
+CREATE INDEX IF NOT EXISTS connections_workspace_id_idx ON connections (workspace_id);
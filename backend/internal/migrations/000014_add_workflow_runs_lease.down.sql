@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS workflow_runs_locked_until_idx;
+
+ALTER TABLE workflow_runs DROP COLUMN IF EXISTS recoveries;
+ALTER TABLE workflow_runs DROP COLUMN IF EXISTS locked_until;
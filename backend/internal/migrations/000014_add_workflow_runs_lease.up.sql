@@ -0,0 +1,8 @@
+ALTER TABLE workflow_runs ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP(0) WITH TIME ZONE;
+ALTER TABLE workflow_runs ADD COLUMN IF NOT EXISTS recoveries INTEGER NOT NULL DEFAULT 0;
+
+-- Runs that were running before leases existed have no worker keeping them
+-- alive, so their lease is expired right away.
+UPDATE workflow_runs SET locked_until = now() WHERE status = 'running';
+
+CREATE INDEX IF NOT EXISTS workflow_runs_locked_until_idx ON workflow_runs (locked_until) WHERE status = 'running';
@@ -0,0 +1,2 @@
+-- The secrets stay in their connections; steps keep pointing to them.
+ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS connection_id;
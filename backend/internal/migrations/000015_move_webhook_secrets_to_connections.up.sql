@@ -0,0 +1,51 @@
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS connection_id UUID REFERENCES connections(id) ON DELETE SET NULL;
+
+-- The signing secret of every Send Webhook step moves from the step params
+-- to a connection of the workflow's workspace, which the step and the
+-- deliveries it sent point to instead.
+CREATE TEMPORARY TABLE webhook_secrets ON COMMIT DROP AS
+SELECT wa.id AS step_id, w.id AS workflow_id, gen_random_uuid() AS connection_id, w.user_id, w.workspace_id,
+  wa.params->>'secret' AS secret
+FROM workflow_actions wa
+INNER JOIN workflows w ON wa.workflow_id = w.id
+INNER JOIN actions a ON wa.action_id = a.id
+INNER JOIN providers p ON a.provider_id = p.id
+WHERE p.name = 'Webhook'
+AND a.operation = 'Send Webhook'
+AND COALESCE(wa.params->>'secret', '') <> '';
+
+INSERT INTO connections (id, user_id, workspace_id, name, type, credentials)
+SELECT connection_id, user_id, workspace_id, 'Webhook secret', 'webhookSecret', jsonb_build_object('secret', secret)
+FROM webhook_secrets;
+
+UPDATE workflow_actions wa
+SET params = (wa.params - 'secret') || jsonb_build_object('connectionId', s.connection_id::text)
+FROM webhook_secrets s
+WHERE wa.id = s.step_id;
+
+UPDATE webhook_deliveries d
+SET connection_id = s.connection_id
+FROM webhook_secrets s
+WHERE d.workflow_action_id = s.step_id;
+
+-- The secret was passed on to the rest of the run like any other param,
+-- so it is dropped wherever a run of the workflow recorded it.
+UPDATE workflow_runs r
+SET params = r.params - 'secret'
+FROM webhook_secrets s
+WHERE r.workflow_id = s.workflow_id
+AND r.params->>'secret' = s.secret;
+
+UPDATE run_steps rs
+SET input = rs.input - 'secret', output = rs.output - 'secret'
+FROM workflow_runs r, webhook_secrets s
+WHERE rs.run_id = r.id
+AND r.workflow_id = s.workflow_id
+AND (rs.input->>'secret' = s.secret OR rs.output->>'secret' = s.secret);
+
+UPDATE dead_letters dl
+SET params = dl.params - 'secret'
+FROM workflow_runs r, webhook_secrets s
+WHERE dl.run_id = r.id
+AND r.workflow_id = s.workflow_id
+AND dl.params->>'secret' = s.secret;
@@ -0,0 +1,9 @@
+ALTER TABLE workflow_runs DROP COLUMN IF EXISTS retries;
+
+ALTER TABLE dead_letters ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 1;
+
+UPDATE dead_letters d SET attempts = a.count
+FROM (SELECT run_id, count(*) AS count FROM dead_letter_attempts GROUP BY run_id) a
+WHERE a.run_id = d.run_id;
+
+DROP TABLE IF EXISTS dead_letter_attempts;
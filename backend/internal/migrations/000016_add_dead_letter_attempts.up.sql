@@ -0,0 +1,19 @@
+-- Every failed attempt of a run, automatic retries included. Attempts are
+-- keyed by run since the first ones happen before the run is dead lettered.
+CREATE TABLE IF NOT EXISTS dead_letter_attempts (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  run_id UUID NOT NULL REFERENCES workflow_runs(id) ON DELETE CASCADE,
+  workflow_action_id UUID REFERENCES workflow_actions(id) ON DELETE SET NULL,
+  error TEXT NOT NULL DEFAULT '',
+  failed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS dead_letter_attempts_run_id_idx ON dead_letter_attempts (run_id, failed_at);
+
+-- Only the last error of the existing dead letters is known.
+INSERT INTO dead_letter_attempts (run_id, workflow_action_id, error, failed_at)
+SELECT run_id, workflow_action_id, error, updated_at FROM dead_letters;
+
+ALTER TABLE dead_letters DROP COLUMN IF EXISTS attempts;
+
+ALTER TABLE workflow_runs ADD COLUMN IF NOT EXISTS retries INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,100 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestLoad(t *testing.T) {
+	file := func(contents string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(contents)}
+	}
+
+	testMap := []struct {
+		name        string
+		fsys        fstest.MapFS
+		versions    []int64
+		shouldError string
+	}{
+		{
+			name: "Sorted By Version",
+			fsys: fstest.MapFS{
+				"000010_add_runs.up.sql":      file("CREATE TABLE runs ();"),
+				"000010_add_runs.down.sql":    file("DROP TABLE runs;"),
+				"000002_add_users.up.sql":     file("CREATE TABLE users ();"),
+				"000002_add_users.down.sql":   file("DROP TABLE users;"),
+				"000001_add_actions.up.sql":   file("CREATE TABLE actions ();"),
+				"000001_add_actions.down.sql": file("DROP TABLE actions;"),
+			},
+			versions: []int64{1, 2, 10},
+		},
+		{
+			name: "Missing Down File Should Error",
+			fsys: fstest.MapFS{
+				"000001_add_users.up.sql": file("CREATE TABLE users ();"),
+			},
+			shouldError: "needs both an up and a down file",
+		},
+		{
+			name: "Empty Down File Should Error",
+			fsys: fstest.MapFS{
+				"000001_add_users.up.sql":   file("CREATE TABLE users ();"),
+				"000001_add_users.down.sql": file(""),
+			},
+			shouldError: "needs both an up and a down file",
+		},
+		{
+			name: "Invalid Name Should Error",
+			fsys: fstest.MapFS{
+				"add_users.up.sql": file("CREATE TABLE users ();"),
+			},
+			shouldError: "name must be",
+		},
+		{
+			name: "Version Zero Should Error",
+			fsys: fstest.MapFS{
+				"000000_add_users.up.sql":   file("CREATE TABLE users ();"),
+				"000000_add_users.down.sql": file("DROP TABLE users;"),
+			},
+			shouldError: "invalid version",
+		},
+		{
+			name: "Two Names For A Version Should Error",
+			fsys: fstest.MapFS{
+				"000001_add_users.up.sql":      file("CREATE TABLE users ();"),
+				"000001_create_users.down.sql": file("DROP TABLE users;"),
+			},
+			shouldError: "has two names",
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := load(tt.fsys)
+
+			if tt.shouldError != "" {
+				assert.Error(t, err)
+				assert.StringContains(t, err.Error(), tt.shouldError)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, len(migrations), len(tt.versions))
+
+			for i, migration := range migrations {
+				assert.Equal(t, migration.Version, tt.versions[i])
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	m, err := New(nil)
+	assert.NilError(t, err)
+
+	for i, migration := range m.migrations {
+		assert.Equal(t, migration.Version, int64(i+1))
+	}
+}
@@ -0,0 +1,357 @@
+// Package migrations evolves the database schema with the versioned SQL
+// files embedded in it.
+//
+// Every migration is a pair of files, NNNNNN_name.up.sql and
+// NNNNNN_name.down.sql. A migration and the row recording it in
+// schema_migrations are applied in the same transaction, so a failed
+// migration leaves nothing behind; statements that can't run in a
+// transaction, like CREATE INDEX CONCURRENTLY, can't be used. Migrations
+// hold a Postgres advisory lock while they run, so several instances
+// starting at once migrate one at a time.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// lockKey identifies the advisory lock taken while migrating.
+const lockKey int64 = 4_710_928_361
+
+// undefinedTable is the Postgres error code for a table that doesn't exist.
+const undefinedTable = "42P01"
+
+var filenameRX = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var ErrUnknownVersion = errors.New("unknown migration version")
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and whether it has been applied.
+type Status struct {
+	Version int64  `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+}
+
+type Migrator struct {
+	DB         *sqlx.DB
+	migrations []Migration
+}
+
+// New returns a migrator for the embedded migrations.
+func New(db *sqlx.DB) (*Migrator, error) {
+	migrations, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{DB: db, migrations: migrations}, nil
+}
+
+// Latest returns the version of the newest migration.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every migration that hasn't been applied yet.
+func (m *Migrator) Up() ([]Migration, error) {
+	return m.To(m.Latest())
+}
+
+// Down reverts the last steps migrations that were applied.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var done []Migration
+
+	err := m.withLock(func(ctx context.Context, conn *sqlx.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		target := int64(0)
+		if steps < len(applied) {
+			target = applied[len(applied)-1-steps]
+		}
+
+		done, err = m.migrate(ctx, conn, applied, target)
+
+		return err
+	})
+
+	return done, err
+}
+
+// To applies or reverts migrations until the version of the database is
+// version. Version 0 reverts every migration.
+func (m *Migrator) To(version int64) ([]Migration, error) {
+	if version != 0 {
+		if _, ok := m.find(version); !ok {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+		}
+	}
+
+	var done []Migration
+
+	err := m.withLock(func(ctx context.Context, conn *sqlx.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		done, err = m.migrate(ctx, conn, applied, version)
+
+		return err
+	})
+
+	return done, err
+}
+
+// Version returns the newest migration applied to the database, 0 when
+// none is. Unlike the other methods it doesn't take the migration lock, so
+// it can be polled, by a readiness check for example.
+func (m *Migrator) Version() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var version int64
+
+	err := m.DB.GetContext(ctx, &version, `SELECT COALESCE(max(version), 0) FROM schema_migrations`)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == undefinedTable {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Status lists every migration and whether it has been applied.
+func (m *Migrator) Status() ([]Status, error) {
+	var statuses []Status
+
+	err := m.withLock(func(ctx context.Context, conn *sqlx.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		isApplied := make(map[int64]bool, len(applied))
+		for _, v := range applied {
+			isApplied[v] = true
+		}
+
+		for _, migration := range m.migrations {
+			statuses = append(statuses, Status{
+				Version: migration.Version,
+				Name:    migration.Name,
+				Applied: isApplied[migration.Version],
+			})
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// migrate reverts the applied migrations newer than target, newest first,
+// and then applies the ones up to target, oldest first.
+func (m *Migrator) migrate(ctx context.Context, conn *sqlx.Conn, applied []int64, target int64) ([]Migration, error) {
+	var done []Migration
+
+	isApplied := make(map[int64]bool, len(applied))
+
+	for _, v := range applied {
+		if _, ok := m.find(v); !ok {
+			return nil, fmt.Errorf("%w: the database has migration %d applied, which this build doesn't have", ErrUnknownVersion, v)
+		}
+
+		isApplied[v] = true
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version <= target || !isApplied[migration.Version] {
+			continue
+		}
+
+		err := run(ctx, conn, migration.Down, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s down: %w", migration.Version, migration.Name, err)
+		}
+
+		done = append(done, migration)
+	}
+
+	for _, migration := range m.migrations {
+		if migration.Version > target || isApplied[migration.Version] {
+			continue
+		}
+
+		err := run(ctx, conn, migration.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name)
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s up: %w", migration.Version, migration.Name, err)
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// run executes a migration and records it in the same transaction.
+func run(ctx context.Context, conn *sqlx.Conn, script string, record string, args ...interface{}) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, record, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// withLock runs fn on a single connection holding the migration lock. The
+// lock belongs to the session, so everything has to go through conn.
+func (m *Migrator) withLock(fn func(ctx context.Context, conn *sqlx.Conn) error) error {
+	ctx := context.Background()
+
+	conn, err := m.DB.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey)
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+
+	return fn(ctx, conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sqlx.Conn) ([]int64, error) {
+	var versions []int64
+
+	err := conn.SelectContext(ctx, &versions, `SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+
+	return Migration{}, false
+}
+
+// load reads the migrations in fsys, sorted by version. Every version needs
+// both an up and a down file.
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+
+	for _, entry := range entries {
+		match := filenameRX.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s: name must be NNNNNN_name.up.sql or NNNNNN_name.down.sql", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version", entry.Name())
+		}
+
+		contents, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
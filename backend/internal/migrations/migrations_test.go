@@ -0,0 +1,153 @@
+package migrations_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/luisya22/confluo/backend/internal/migrations"
+	"github.com/luisya22/confluo/backend/internal/tests"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+var db *sqlx.DB
+
+func TestMain(m *testing.M) {
+	var err error
+
+	db, err = tests.NewTestDB()
+	if err != nil {
+		// The tests of the runner need a database; the others don't.
+		fmt.Println("error creating db:", err)
+		db = nil
+	}
+
+	exitCode := m.Run()
+
+	if db != nil {
+		db.Close()
+	}
+
+	os.Exit(exitCode)
+}
+
+func newMigrator(t *testing.T) *migrations.Migrator {
+	t.Helper()
+
+	if db == nil {
+		t.Skip("no test database")
+	}
+
+	migrator, err := migrations.New(db)
+	assert.NilError(t, err)
+
+	// Start from an empty database and leave it migrated for the next test.
+	_, err = migrator.To(0)
+	assert.NilError(t, err)
+	t.Cleanup(func() { tests.SetupDb(db) })
+
+	return migrator
+}
+
+func assertVersion(t *testing.T, migrator *migrations.Migrator, version int64) {
+	t.Helper()
+
+	got, err := migrator.Version()
+	assert.NilError(t, err)
+	assert.Equal(t, got, version)
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	migrator := newMigrator(t)
+	latest := migrator.Latest()
+
+	assertVersion(t, migrator, 0)
+
+	done, err := migrator.Up()
+	assert.NilError(t, err)
+	assert.Equal(t, int64(len(done)), latest)
+	assert.Equal(t, done[0].Version, int64(1))
+	assertVersion(t, migrator, latest)
+
+	done, err = migrator.Up()
+	assert.NilError(t, err)
+	assert.Equal(t, len(done), 0)
+
+	done, err = migrator.Down(2)
+	assert.NilError(t, err)
+	assert.Equal(t, len(done), 2)
+	assert.Equal(t, done[0].Version, latest)
+	assert.Equal(t, done[1].Version, latest-1)
+	assertVersion(t, migrator, latest-2)
+
+	// Every down file reverts its up file, so the schema can be rebuilt
+	// from scratch.
+	done, err = migrator.Down(int(latest))
+	assert.NilError(t, err)
+	assert.Equal(t, int64(len(done)), latest-2)
+	assertVersion(t, migrator, 0)
+
+	done, err = migrator.Up()
+	assert.NilError(t, err)
+	assert.Equal(t, int64(len(done)), latest)
+	assertVersion(t, migrator, latest)
+}
+
+func TestMigrateTo(t *testing.T) {
+	migrator := newMigrator(t)
+
+	done, err := migrator.To(3)
+	assert.NilError(t, err)
+	assert.Equal(t, len(done), 3)
+	assertVersion(t, migrator, 3)
+
+	done, err = migrator.To(5)
+	assert.NilError(t, err)
+	assert.Equal(t, len(done), 2)
+	assert.Equal(t, done[0].Version, int64(4))
+	assertVersion(t, migrator, 5)
+
+	done, err = migrator.To(2)
+	assert.NilError(t, err)
+	assert.Equal(t, len(done), 3)
+	assert.Equal(t, done[0].Version, int64(5))
+	assertVersion(t, migrator, 2)
+
+	_, err = migrator.To(migrator.Latest() + 1)
+	assert.Equal(t, errors.Is(err, migrations.ErrUnknownVersion), true)
+	assertVersion(t, migrator, 2)
+}
+
+func TestMigrateStatus(t *testing.T) {
+	migrator := newMigrator(t)
+
+	_, err := migrator.To(4)
+	assert.NilError(t, err)
+
+	statuses, err := migrator.Status()
+	assert.NilError(t, err)
+	assert.Equal(t, int64(len(statuses)), migrator.Latest())
+
+	for _, status := range statuses {
+		assert.Equal(t, status.Applied, status.Version <= 4)
+		assert.NotEqual(t, status.Name, "")
+	}
+}
+
+func TestMigrateUnknownAppliedVersion(t *testing.T) {
+	migrator := newMigrator(t)
+
+	_, err := migrator.Up()
+	assert.NilError(t, err)
+
+	_, err = db.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, 'from_a_newer_build')`, migrator.Latest()+1)
+	assert.NilError(t, err)
+
+	_, err = migrator.Down(1)
+	assert.Equal(t, errors.Is(err, migrations.ErrUnknownVersion), true)
+
+	_, err = db.Exec(`DELETE FROM schema_migrations WHERE version = $1`, migrator.Latest()+1)
+	assert.NilError(t, err)
+}
@@ -2,12 +2,17 @@ package github
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/google/go-github/v61/github"
 	"github.com/luisya22/confluo/backend/internal/executor"
+	"github.com/luisya22/confluo/backend/internal/metrics"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 const ProviderName = "Github"
@@ -34,10 +39,26 @@ func Initialize(e *executor.Executor) {
 	e.Subscribe(ProviderName, actions)
 }
 
+// httpClient traces the calls to the Github API.
+var httpClient = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+// baseURL replaces the Github API URL when it is set, in tests.
+var baseURL *url.URL
+
+func newClient(token string) *github.Client {
+	client := github.NewClient(httpClient).WithAuthToken(token)
+
+	if baseURL != nil {
+		client.BaseURL = baseURL
+	}
+
+	return client
+}
+
 // Triggers
 
-func newIssue(params map[string]interface{}) (map[string]interface{}, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func newIssue(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	token, owner, repo, err := getRepoData(params)
@@ -45,17 +66,19 @@ func newIssue(params map[string]interface{}) (map[string]interface{}, error) {
 		return params, err
 	}
 
-	lastIssue, ok := params["lastIssue"].(int)
-	if !ok {
-		return params, fmt.Errorf("lastIssue not found or it is not correct format")
+	lastIssue, err := intParam(params, "lastIssue")
+	if err != nil {
+		return params, err
 	}
 
-	client := github.NewClient(nil).WithAuthToken(token)
+	client := newClient(token)
 
 	for {
 		lastIssue++
 
 		issue, res, err := client.Issues.Get(ctx, owner, repo, lastIssue)
+		observeRateLimit(res)
+
 		if err != nil {
 			if res != nil && res.StatusCode == http.StatusNotFound {
 				return params, executor.ErrNotTriggered
@@ -68,8 +91,8 @@ func newIssue(params map[string]interface{}) (map[string]interface{}, error) {
 			// TODO: Finish this
 			params["issueTitle"] = *issue.Title
 			params["lastIssue"] = *issue.Number
+			params[executor.ParamDedupeKey] = fmt.Sprintf("%s/%s#%d", owner, repo, *issue.Number)
 
-			fmt.Println(*issue.Title)
 			break
 		}
 
@@ -78,7 +101,7 @@ func newIssue(params map[string]interface{}) (map[string]interface{}, error) {
 	return params, nil
 }
 
-func newBranch(params map[string]interface{}) (map[string]interface{}, error) {
+func newBranch(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
 	// ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	// defer cancel()
 	//
@@ -90,52 +113,81 @@ func newBranch(params map[string]interface{}) (map[string]interface{}, error) {
 	return params, fmt.Errorf("not implemented")
 }
 
-func newCommit(params map[string]interface{}) (map[string]interface{}, error) {
+func newCommit(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
 	return params, fmt.Errorf("not implemented")
 }
 
-func newRepo(params map[string]interface{}) (map[string]interface{}, error) {
+func newRepo(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
 	return params, fmt.Errorf("not implemented")
 }
 
-func newRelease(params map[string]interface{}) (map[string]interface{}, error) {
+func newRelease(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
 	return params, fmt.Errorf("not implemented")
 }
 
 // Events
 
-func createComment(params map[string]interface{}) (map[string]interface{}, error) {
+func createComment(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
 	return params, fmt.Errorf("not implemented")
 }
 
-func createIssue(params map[string]interface{}) (map[string]interface{}, error) {
+func createIssue(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
 	return params, fmt.Errorf("not implemented")
 }
 
-func updateIssue(params map[string]interface{}) (map[string]interface{}, error) {
+func updateIssue(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
 	return params, fmt.Errorf("not implemented")
 }
 
-func createPullRequest(params map[string]interface{}) (map[string]interface{}, error) {
+func createPullRequest(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
 	return params, fmt.Errorf("not implemented")
 }
 
-func updatePullRequest(params map[string]interface{}) (map[string]interface{}, error) {
+func updatePullRequest(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
 	return params, fmt.Errorf("not implemented")
 }
 
-func deleteBranch(params map[string]interface{}) (map[string]interface{}, error) {
+func deleteBranch(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
 	return params, fmt.Errorf("not implemented")
 }
 
-func findIssue(params map[string]interface{}) (map[string]interface{}, error) {
+func findIssue(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
 	return params, fmt.Errorf("not implemented")
 }
 
-func findPullRequest(params map[string]interface{}) (map[string]interface{}, error) {
+func findPullRequest(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
 	return params, fmt.Errorf("not implemented")
 }
 
+// observeRateLimit records the rate limit the response reported, if any.
+func observeRateLimit(res *github.Response) {
+	if res == nil || res.Rate.Limit == 0 {
+		return
+	}
+
+	metrics.SetGithubRateLimitRemaining(res.Rate.Remaining)
+}
+
+// intParam reads a whole number param. Params stored as JSON, like the
+// state a trigger saves between polls, come back as float64.
+func intParam(params map[string]interface{}, key string) (int, error) {
+	switch v := params[key].(type) {
+	case int:
+		return v, nil
+	case float64:
+		if v == math.Trunc(v) {
+			return int(v), nil
+		}
+	case json.Number:
+		n, err := v.Int64()
+		if err == nil {
+			return int(n), nil
+		}
+	}
+
+	return 0, fmt.Errorf("%s not found or it is not correct format", key)
+}
+
 // Get Params and returns token, owner, repo and if its error
 func getRepoData(params map[string]interface{}) (string, string, string, error) {
 	token, ok := params["token"].(string)
@@ -0,0 +1,101 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/executor"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestIntParam(t *testing.T) {
+	testMap := []struct {
+		name        string
+		value       interface{}
+		n           int
+		shouldError bool
+	}{
+		{name: "Int", value: 11, n: 11},
+		{name: "Float From JSON", value: 11.0, n: 11},
+		{name: "JSON Number", value: json.Number("11"), n: 11},
+		{name: "Fraction Should Error", value: 11.5, shouldError: true},
+		{name: "String Should Error", value: "11", shouldError: true},
+		{name: "Missing Should Error", value: nil, shouldError: true},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := intParam(map[string]interface{}{"lastIssue": tt.value}, "lastIssue")
+
+			if tt.shouldError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, n, tt.n)
+		})
+	}
+}
+
+// TestNewIssuePolledTwice saves the trigger state between polls the way the
+// engine does, as JSON, so lastIssue comes back as a float64.
+func TestNewIssuePolledTwice(t *testing.T) {
+	issues := map[string]string{
+		"1": `{"number": 1, "title": "Broken build"}`,
+		"2": `{"number": 2, "title": "Fix build", "pull_request": {"url": "https://api.github.com/repos/octocat/hello/pulls/2"}}`,
+		"3": `{"number": 3, "title": "Flaky test"}`,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octocat/hello/issues/{number}", func(w http.ResponseWriter, r *http.Request) {
+		issue, ok := issues[r.PathValue("number")]
+		if !ok {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprint(w, issue)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL + "/")
+	assert.NilError(t, err)
+
+	baseURL = u
+	t.Cleanup(func() { baseURL = nil })
+
+	params := map[string]interface{}{"token": "t", "owner": "octocat", "repo": "hello", "lastIssue": 0}
+
+	poll := func() error {
+		output, err := newIssue(context.Background(), params)
+
+		stored, marshalErr := json.Marshal(output)
+		assert.NilError(t, marshalErr)
+
+		params = map[string]interface{}{}
+		assert.NilError(t, json.Unmarshal(stored, &params))
+
+		return err
+	}
+
+	assert.NilError(t, poll())
+	assert.Equal(t, params["issueTitle"], interface{}("Broken build"))
+	assert.Equal(t, params[executor.ParamDedupeKey], interface{}("octocat/hello#1"))
+
+	// The pull request is skipped.
+	assert.NilError(t, poll())
+	assert.Equal(t, params["issueTitle"], interface{}("Flaky test"))
+	assert.Equal(t, params["lastIssue"], interface{}(3.0))
+	assert.Equal(t, params[executor.ParamDedupeKey], interface{}("octocat/hello#3"))
+
+	assert.Equal(t, errors.Is(poll(), executor.ErrNotTriggered), true)
+}
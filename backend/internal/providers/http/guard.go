@@ -0,0 +1,189 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var (
+	ErrHostDenied     = errors.New("destination host is denied")
+	ErrHostNotAllowed = errors.New("destination host is not in the allow list")
+)
+
+// Carrier-grade NAT range, not covered by net.IP.IsPrivate.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+type hostRule struct {
+	host     string
+	wildcard bool
+	network  *net.IPNet
+}
+
+// hostGuard decides which destinations the provider may connect to. Checks
+// run at dial time against the resolved addresses so a hostname can't be
+// pointed at the internal network after it was validated.
+type hostGuard struct {
+	resolver resolver
+	dial     func(ctx context.Context, network, addr string) (net.Conn, error)
+	allowed  []hostRule
+	denied   []hostRule
+}
+
+type resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+func newHostGuard(dialer *net.Dialer, allowed, denied []string) (*hostGuard, error) {
+	allowedRules, err := parseHostRules(allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	deniedRules, err := parseHostRules(denied)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hostGuard{
+		resolver: net.DefaultResolver,
+		dial:     dialer.DialContext,
+		allowed:  allowedRules,
+		denied:   deniedRules,
+	}, nil
+}
+
+// Rules can be an exact host (api.example.com), a wildcard subdomain
+// (*.example.com), an IP address or a CIDR block (10.0.0.0/8).
+func parseHostRules(entries []string) ([]hostRule, error) {
+	rules := make([]hostRule, 0, len(entries))
+
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+
+		switch {
+		case strings.Contains(entry, "/"):
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid host rule %q: %w", entry, err)
+			}
+			rules = append(rules, hostRule{network: network})
+
+		case net.ParseIP(entry) != nil:
+			ip := net.ParseIP(entry)
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			rules = append(rules, hostRule{network: &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}})
+
+		case strings.HasPrefix(entry, "*."):
+			rules = append(rules, hostRule{host: strings.TrimPrefix(entry, "*"), wildcard: true})
+
+		default:
+			rules = append(rules, hostRule{host: entry})
+		}
+	}
+
+	return rules, nil
+}
+
+func (r hostRule) matches(host string, ip net.IP) bool {
+	if r.network != nil {
+		return ip != nil && r.network.Contains(ip)
+	}
+
+	if r.wildcard {
+		return strings.HasSuffix(host, r.host)
+	}
+
+	return host == r.host
+}
+
+func matchAny(rules []hostRule, host string, ip net.IP) bool {
+	for _, r := range rules {
+		if r.matches(host, ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check applies the deny list first. When an allow list is configured only
+// hosts on it are reachable, internal ones included; otherwise any public
+// address is reachable and internal ranges are rejected.
+func (g *hostGuard) check(host string, ip net.IP) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	if matchAny(g.denied, host, ip) {
+		return fmt.Errorf("%w: %s", ErrHostDenied, host)
+	}
+
+	if len(g.allowed) > 0 {
+		if !matchAny(g.allowed, host, ip) {
+			return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+		}
+
+		return nil
+	}
+
+	if ip != nil && isInternal(ip) {
+		return fmt.Errorf("%w: %s resolves to an internal address", ErrHostDenied, host)
+	}
+
+	return nil
+}
+
+func (g *hostGuard) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := g.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ip := range ips {
+		if err := g.check(host, ip.IP); err != nil {
+			return nil, err
+		}
+	}
+
+	var dialErr error
+	for _, ip := range ips {
+		// Dial the checked address, not the host, so it isn't resolved
+		// again to something else.
+		conn, err := g.dial(ctx, network, net.JoinHostPort(ip.IP.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+
+		dialErr = err
+	}
+
+	if dialErr == nil {
+		dialErr = fmt.Errorf("no addresses found for %s", host)
+	}
+
+	return nil, dialErr
+}
+
+func isInternal(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip)
+}
@@ -0,0 +1,264 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestHostGuardCheck(t *testing.T) {
+	testMap := []struct {
+		name    string
+		allowed []string
+		denied  []string
+		host    string
+		ip      string
+		err     error
+	}{
+		{
+			name: "Public Address",
+			host: "api.example.com",
+			ip:   "93.184.216.34",
+		},
+		{
+			name: "Loopback Should Be Denied",
+			host: "localhost",
+			ip:   "127.0.0.1",
+			err:  ErrHostDenied,
+		},
+		{
+			name: "IPv6 Loopback Should Be Denied",
+			host: "localhost",
+			ip:   "::1",
+			err:  ErrHostDenied,
+		},
+		{
+			name: "Private Range Should Be Denied",
+			host: "db.internal",
+			ip:   "10.1.2.3",
+			err:  ErrHostDenied,
+		},
+		{
+			name: "Private IPv6 Range Should Be Denied",
+			host: "db.internal",
+			ip:   "fd00::1",
+			err:  ErrHostDenied,
+		},
+		{
+			name: "Link Local Should Be Denied",
+			host: "metadata.google.internal",
+			ip:   "169.254.169.254",
+			err:  ErrHostDenied,
+		},
+		{
+			name: "IPv6 Link Local Should Be Denied",
+			host: "router",
+			ip:   "fe80::1",
+			err:  ErrHostDenied,
+		},
+		{
+			name: "Shared Address Space Should Be Denied",
+			host: "cgnat",
+			ip:   "100.64.0.1",
+			err:  ErrHostDenied,
+		},
+		{
+			name: "Unspecified Should Be Denied",
+			host: "zero",
+			ip:   "0.0.0.0",
+			err:  ErrHostDenied,
+		},
+		{
+			name: "IPv4 Mapped Loopback Should Be Denied",
+			host: "mapped",
+			ip:   "::ffff:127.0.0.1",
+			err:  ErrHostDenied,
+		},
+		{
+			name:   "Denied Host",
+			denied: []string{"api.example.com"},
+			host:   "API.example.com.",
+			ip:     "93.184.216.34",
+			err:    ErrHostDenied,
+		},
+		{
+			name:   "Denied Wildcard",
+			denied: []string{"*.example.com"},
+			host:   "api.example.com",
+			ip:     "93.184.216.34",
+			err:    ErrHostDenied,
+		},
+		{
+			name:   "Wildcard Doesn't Match The Apex",
+			denied: []string{"*.example.com"},
+			host:   "example.com",
+			ip:     "93.184.216.34",
+		},
+		{
+			name:   "Denied CIDR",
+			denied: []string{"93.184.216.0/24"},
+			host:   "api.example.com",
+			ip:     "93.184.216.34",
+			err:    ErrHostDenied,
+		},
+		{
+			name:    "Deny Wins Over Allow",
+			allowed: []string{"api.example.com"},
+			denied:  []string{"93.184.216.34"},
+			host:    "api.example.com",
+			ip:      "93.184.216.34",
+			err:     ErrHostDenied,
+		},
+		{
+			name:    "Allowed Host",
+			allowed: []string{"api.example.com"},
+			host:    "api.example.com",
+			ip:      "93.184.216.34",
+		},
+		{
+			name:    "Host Not On The Allow List",
+			allowed: []string{"api.example.com"},
+			host:    "other.example.com",
+			ip:      "93.184.216.34",
+			err:     ErrHostNotAllowed,
+		},
+		{
+			name:    "Allow List Reaches Internal Hosts",
+			allowed: []string{"10.0.0.0/8"},
+			host:    "db.internal",
+			ip:      "10.1.2.3",
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := newHostGuard(&net.Dialer{}, tt.allowed, tt.denied)
+			assert.NilError(t, err)
+
+			err = guard.check(tt.host, net.ParseIP(tt.ip))
+
+			if tt.err != nil {
+				assert.Equal(t, errors.Is(err, tt.err), true)
+				return
+			}
+
+			assert.NilError(t, err)
+		})
+	}
+}
+
+func TestParseHostRules(t *testing.T) {
+	testMap := []struct {
+		name        string
+		entries     []string
+		rules       int
+		shouldError bool
+	}{
+		{name: "Hosts, IPs And CIDRs", entries: []string{"api.example.com", "*.example.com", "10.0.0.1", "fd00::1", "10.0.0.0/8"}, rules: 5},
+		{name: "Blank Entries Are Skipped", entries: []string{"", "  "}, rules: 0},
+		{name: "Invalid CIDR Should Error", entries: []string{"10.0.0.0/33"}, shouldError: true},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := parseHostRules(tt.entries)
+
+			if tt.shouldError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, len(rules), tt.rules)
+		})
+	}
+}
+
+// rebindingResolver answers with the next set of addresses on every lookup,
+// like a DNS server with a zero TTL switching its answer.
+type rebindingResolver struct {
+	answers [][]string
+	lookups int
+}
+
+func (r *rebindingResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	answer := r.answers[min(r.lookups, len(r.answers)-1)]
+	r.lookups++
+
+	ips := make([]net.IPAddr, 0, len(answer))
+	for _, ip := range answer {
+		ips = append(ips, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+
+	return ips, nil
+}
+
+func TestHostGuardDialContext(t *testing.T) {
+	testMap := []struct {
+		name    string
+		answers [][]string
+		dialed  []string
+		err     error
+	}{
+		{
+			name:    "Dials The Checked Address",
+			answers: [][]string{{"93.184.216.34"}},
+			dialed:  []string{"93.184.216.34:443"},
+		},
+		{
+			name:    "Any Internal Address Should Be Denied",
+			answers: [][]string{{"93.184.216.34", "127.0.0.1"}},
+			err:     ErrHostDenied,
+		},
+		{
+			name:    "Rebinding Should Be Denied",
+			answers: [][]string{{"93.184.216.34"}, {"169.254.169.254"}},
+			dialed:  []string{"93.184.216.34:443"},
+			err:     ErrHostDenied,
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := newHostGuard(&net.Dialer{}, nil, nil)
+			assert.NilError(t, err)
+
+			var dialed []string
+
+			guard.resolver = &rebindingResolver{answers: tt.answers}
+			guard.dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dialed = append(dialed, addr)
+
+				client, server := net.Pipe()
+				server.Close()
+
+				return client, nil
+			}
+
+			// Every connection resolves the host again, so a name that
+			// passed once can't be pointed at the internal network later.
+			for range tt.answers {
+				var conn net.Conn
+				conn, err = guard.dialContext(context.Background(), "tcp", "rebind.example.com:443")
+				if err != nil {
+					break
+				}
+				conn.Close()
+			}
+
+			if tt.err != nil {
+				assert.Equal(t, errors.Is(err, tt.err), true)
+			} else {
+				assert.NilError(t, err)
+			}
+
+			assert.Equal(t, len(dialed), len(tt.dialed))
+			for i, addr := range dialed {
+				assert.Equal(t, addr, tt.dialed[i])
+			}
+		})
+	}
+}
@@ -0,0 +1,458 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/executor"
+	"github.com/luisya22/confluo/backend/internal/validator"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const ProviderName = "HTTP"
+
+const (
+	defaultTimeout   = 30 * time.Second
+	maxTimeout       = 2 * time.Minute
+	maxResponseBytes = 10 << 20
+	maxRedirects     = 10
+)
+
+type Config struct {
+	AllowedHosts []string
+	DeniedHosts  []string
+}
+
+type ConnectionStore interface {
+	Get(id string) (*data.Connection, error)
+}
+
+// GetConnection loads a connection for the step with params. Workflows can
+// only use connections of their own workspace, so a connection of another
+// workspace is reported as not found, and so is every connection when the
+// step doesn't say which workspace it runs in.
+func GetConnection(connections ConnectionStore, params map[string]interface{}, connectionId string) (*data.Connection, error) {
+	if connections == nil {
+		return nil, fmt.Errorf("connections are not available")
+	}
+
+	workspaceId, _ := params[executor.ParamWorkspaceId].(string)
+	if workspaceId == "" {
+		return nil, fmt.Errorf("connection %s not found", connectionId)
+	}
+
+	connection, err := connections.Get(connectionId)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, fmt.Errorf("connection %s not found", connectionId)
+		}
+
+		return nil, err
+	}
+
+	if connection.WorkspaceId != workspaceId {
+		return nil, fmt.Errorf("connection %s not found", connectionId)
+	}
+
+	return connection, nil
+}
+
+type provider struct {
+	client      *http.Client
+	connections ConnectionStore
+}
+
+func Initialize(e *executor.Executor, cfg Config, connections ConnectionStore) error {
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	p := &provider{
+		client:      client,
+		connections: connections,
+	}
+
+	actions := make(executor.Provider)
+
+	actions["Request"] = p.request
+
+	e.Subscribe(ProviderName, actions)
+
+	return nil
+}
+
+// NewClient returns a client whose connections are checked against the
+// configured host rules and whose requests are traced. Other providers that
+// call user supplied URLs should use it too.
+func NewClient(cfg Config) (*http.Client, error) {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	guard, err := newHostGuard(dialer, cfg.AllowedHosts, cfg.DeniedHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Transport: otelhttp.NewTransport(&http.Transport{
+			// No proxy: every connection has to go through the guard.
+			Proxy:                 nil,
+			DialContext:           guard.dialContext,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+		}),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+
+			return CheckURL(req.URL)
+		},
+	}
+
+	return client, nil
+}
+
+// Events
+
+// request sends an HTTP request built from params and stores the response
+// under responseStatus, responseHeaders and responseBody. When
+// idempotencyHeader is set, e.g. to "Idempotency-Key", the step's
+// idempotency key is sent in that header.
+func (p *provider) request(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+	method := strings.ToUpper(stringParam(params, "method", http.MethodGet))
+	if !validator.PermittedValue(
+		method,
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions,
+	) {
+		return params, fmt.Errorf("method %q is not supported", method)
+	}
+
+	rawUrl, ok := params["url"].(string)
+	if !ok || rawUrl == "" {
+		return params, fmt.Errorf("url not found or it is not correct format")
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return params, fmt.Errorf("invalid url: %w", err)
+	}
+
+	if err := CheckURL(u); err != nil {
+		return params, err
+	}
+
+	if err := addQuery(u, params["query"]); err != nil {
+		return params, err
+	}
+
+	timeout, err := timeoutParam(params)
+	if err != nil {
+		return params, err
+	}
+
+	body, contentType, err := buildBody(params)
+	if err != nil {
+		return params, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return params, err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	if err := addHeaders(req, params["headers"]); err != nil {
+		return params, err
+	}
+
+	if header := stringParam(params, "idempotencyHeader", ""); header != "" && req.Header.Get(header) == "" {
+		if key, _ := params[executor.ParamIdempotencyKey].(string); key != "" {
+			req.Header.Set(header, key)
+		}
+	}
+
+	if err := p.authenticate(req, params); err != nil {
+		return params, err
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return params, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, maxResponseBytes+1))
+	if err != nil {
+		return params, err
+	}
+
+	if len(resBody) > maxResponseBytes {
+		return params, fmt.Errorf("response body must not be larger than %d bytes", maxResponseBytes)
+	}
+
+	headers := make(map[string]interface{}, len(res.Header))
+	for key, values := range res.Header {
+		headers[key] = strings.Join(values, ", ")
+	}
+
+	parsedBody, err := parseBody(resBody, res.Header.Get("Content-Type"), stringParam(params, "responseType", "auto"))
+	if err != nil {
+		return params, err
+	}
+
+	params["responseStatus"] = res.StatusCode
+	params["responseHeaders"] = headers
+	params["responseBody"] = parsedBody
+
+	failOnErrorStatus, ok := params["failOnErrorStatus"].(bool)
+	if !ok {
+		failOnErrorStatus = true
+	}
+
+	if failOnErrorStatus && res.StatusCode >= http.StatusBadRequest {
+		return params, fmt.Errorf("request failed with status %d", res.StatusCode)
+	}
+
+	return params, nil
+}
+
+// authenticate applies the credentials of the connection referenced by
+// connectionId, if any.
+func (p *provider) authenticate(req *http.Request, params map[string]interface{}) error {
+	connectionId, ok := params["connectionId"].(string)
+	if !ok || connectionId == "" {
+		return nil
+	}
+
+	connection, err := GetConnection(p.connections, params, connectionId)
+	if err != nil {
+		return err
+	}
+
+	credentials := connection.Credentials
+
+	switch connection.Type {
+	case data.ConnectionTypeBasic:
+		req.SetBasicAuth(credentials["username"], credentials["password"])
+
+	case data.ConnectionTypeBearer:
+		req.Header.Set("Authorization", "Bearer "+credentials["token"])
+
+	case data.ConnectionTypeApiKey:
+		name := credentials["name"]
+		if name == "" {
+			name = "X-API-Key"
+		}
+
+		if credentials["in"] == "query" {
+			q := req.URL.Query()
+			q.Set(name, credentials["key"])
+			req.URL.RawQuery = q.Encode()
+		} else {
+			req.Header.Set(name, credentials["key"])
+		}
+
+	default:
+		return fmt.Errorf("connection type %q is not supported", connection.Type)
+	}
+
+	return nil
+}
+
+// CheckURL rejects URLs the provider can't or shouldn't call.
+func CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url scheme must be http or https")
+	}
+
+	if u.Hostname() == "" {
+		return fmt.Errorf("url must contain a host")
+	}
+
+	return nil
+}
+
+func addQuery(u *url.URL, raw interface{}) error {
+	if raw == nil {
+		return nil
+	}
+
+	query, ok := raw.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("query is not correct format")
+	}
+
+	q := u.Query()
+	for key, value := range query {
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				q.Add(key, fmt.Sprint(item))
+			}
+		default:
+			q.Set(key, fmt.Sprint(v))
+		}
+	}
+
+	u.RawQuery = q.Encode()
+
+	return nil
+}
+
+func addHeaders(req *http.Request, raw interface{}) error {
+	if raw == nil {
+		return nil
+	}
+
+	headers, ok := raw.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("headers is not correct format")
+	}
+
+	for key, value := range headers {
+		req.Header.Set(key, fmt.Sprint(value))
+	}
+
+	return nil
+}
+
+// buildBody encodes params["body"] according to params["bodyType"], which
+// is one of json (default), form or raw.
+func buildBody(params map[string]interface{}) (io.Reader, string, error) {
+	body, ok := params["body"]
+	if !ok || body == nil {
+		return nil, "", nil
+	}
+
+	switch bodyType := stringParam(params, "bodyType", "json"); bodyType {
+	case "json":
+		js, err := json.Marshal(body)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return bytes.NewReader(js), "application/json", nil
+
+	case "form":
+		fields, ok := body.(map[string]interface{})
+		if !ok {
+			return nil, "", fmt.Errorf("form body must be an object")
+		}
+
+		form := url.Values{}
+		for key, value := range fields {
+			form.Set(key, fmt.Sprint(value))
+		}
+
+		return strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", nil
+
+	case "raw":
+		s, ok := body.(string)
+		if !ok {
+			return nil, "", fmt.Errorf("raw body must be a string")
+		}
+
+		return strings.NewReader(s), "text/plain", nil
+
+	default:
+		return nil, "", fmt.Errorf("body type %q is not supported", bodyType)
+	}
+}
+
+// parseBody decodes JSON responses when asked to, or when responseType is
+// auto and the server says it sent JSON. Everything else is kept as text.
+func parseBody(body []byte, contentType string, responseType string) (interface{}, error) {
+	if len(body) == 0 {
+		return nil, nil
+	}
+
+	switch responseType {
+	case "text":
+		return string(body), nil
+
+	case "json":
+		var parsed interface{}
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return nil, fmt.Errorf("response body is not valid JSON: %w", err)
+		}
+
+		return parsed, nil
+
+	case "auto":
+		if strings.Contains(contentType, "json") {
+			var parsed interface{}
+			if err := json.Unmarshal(body, &parsed); err == nil {
+				return parsed, nil
+			}
+		}
+
+		return string(body), nil
+
+	default:
+		return nil, fmt.Errorf("response type %q is not supported", responseType)
+	}
+}
+
+// timeoutParam accepts seconds as a number or a duration string like "5s".
+func timeoutParam(params map[string]interface{}) (time.Duration, error) {
+	var timeout time.Duration
+
+	switch v := params["timeout"].(type) {
+	case nil:
+		return defaultTimeout, nil
+	case float64:
+		timeout = time.Duration(v * float64(time.Second))
+	case int:
+		timeout = time.Duration(v) * time.Second
+	case string:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timeout: %w", err)
+		}
+		timeout = d
+	default:
+		return 0, fmt.Errorf("timeout is not correct format")
+	}
+
+	if timeout <= 0 {
+		return 0, fmt.Errorf("timeout must be greater than zero")
+	}
+
+	if timeout > maxTimeout {
+		return maxTimeout, nil
+	}
+
+	return timeout, nil
+}
+
+func stringParam(params map[string]interface{}, key string, defaultValue string) string {
+	s, ok := params[key].(string)
+	if !ok || s == "" {
+		return defaultValue
+	}
+
+	return s
+}
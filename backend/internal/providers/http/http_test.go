@@ -0,0 +1,352 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/executor"
+	httpprovider "github.com/luisya22/confluo/backend/internal/providers/http"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+type connectionStore map[string]*data.Connection
+
+func (s connectionStore) Get(id string) (*data.Connection, error) {
+	connection, ok := s[id]
+	if !ok {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return connection, nil
+}
+
+func TestGetConnection(t *testing.T) {
+	connections := connectionStore{
+		"c1": {Id: "c1", WorkspaceId: "w1", Type: data.ConnectionTypeBearer},
+	}
+
+	testMap := []struct {
+		name         string
+		params       map[string]interface{}
+		connectionId string
+		shouldError  bool
+	}{
+		{
+			name:         "Same Workspace",
+			params:       map[string]interface{}{executor.ParamWorkspaceId: "w1"},
+			connectionId: "c1",
+		},
+		{
+			name:         "Other Workspace Should Error",
+			params:       map[string]interface{}{executor.ParamWorkspaceId: "w2"},
+			connectionId: "c1",
+			shouldError:  true,
+		},
+		{
+			name:         "Missing Workspace Should Error",
+			params:       map[string]interface{}{},
+			connectionId: "c1",
+			shouldError:  true,
+		},
+		{
+			name:         "Workspace Not A String Should Error",
+			params:       map[string]interface{}{executor.ParamWorkspaceId: 1},
+			connectionId: "c1",
+			shouldError:  true,
+		},
+		{
+			name:         "Unknown Connection Should Error",
+			params:       map[string]interface{}{executor.ParamWorkspaceId: "w1"},
+			connectionId: "c2",
+			shouldError:  true,
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			connection, err := httpprovider.GetConnection(connections, tt.params, tt.connectionId)
+
+			if tt.shouldError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, connection.Id, tt.connectionId)
+		})
+	}
+}
+
+// newEchoServer returns a server that answers with what it received as
+// JSON, so tests can check the request the provider sent. /status/<code>
+// answers with that status and /text with plain text.
+func newEchoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Served-By", "echo")
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"method":         r.Method,
+			"query":          r.URL.RawQuery,
+			"contentType":    r.Header.Get("Content-Type"),
+			"body":           string(body),
+			"custom":         r.Header.Get("X-Custom"),
+			"idempotencyKey": r.Header.Get("Idempotency-Key"),
+			"authorization":  r.Header.Get("Authorization"),
+		})
+	})
+
+	mux.HandleFunc("/status/{code}", func(w http.ResponseWriter, r *http.Request) {
+		code, _ := strconv.Atoi(r.PathValue("code"))
+		w.WriteHeader(code)
+	})
+
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello"))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newExecutor returns an executor with the provider subscribed under cfg.
+func newExecutor(t *testing.T, cfg httpprovider.Config, connections httpprovider.ConnectionStore) *executor.Executor {
+	t.Helper()
+
+	e := executor.NewExecutor()
+	assert.NilError(t, httpprovider.Initialize(e, cfg, connections))
+
+	return e
+}
+
+type requestTestResult struct {
+	status int
+	echo   map[string]string
+	body   interface{}
+	err    string
+}
+
+func TestRequest(t *testing.T) {
+	server := newEchoServer(t)
+
+	connections := connectionStore{
+		"c1": {Id: "c1", WorkspaceId: "w1", Type: data.ConnectionTypeBearer, Credentials: map[string]string{"token": "secret"}},
+	}
+
+	e := newExecutor(t, httpprovider.Config{AllowedHosts: []string{"127.0.0.1"}}, connections)
+
+	testMap := []struct {
+		name   string
+		path   string
+		params map[string]interface{}
+		wants  requestTestResult
+	}{
+		{
+			name:   "GET With Query",
+			path:   "/echo",
+			params: map[string]interface{}{"query": map[string]interface{}{"page": 2.0, "tag": []interface{}{"a", "b"}}},
+			wants: requestTestResult{
+				status: http.StatusOK,
+				echo:   map[string]string{"method": "GET", "query": "page=2&tag=a&tag=b", "body": ""},
+			},
+		},
+		{
+			name:   "POST JSON Body",
+			path:   "/echo",
+			params: map[string]interface{}{"method": "post", "body": map[string]interface{}{"name": "Ada"}},
+			wants: requestTestResult{
+				status: http.StatusOK,
+				echo:   map[string]string{"method": "POST", "contentType": "application/json", "body": `{"name":"Ada"}`},
+			},
+		},
+		{
+			name:   "PUT Form Body",
+			path:   "/echo",
+			params: map[string]interface{}{"method": "PUT", "bodyType": "form", "body": map[string]interface{}{"name": "Ada", "age": 36.0}},
+			wants: requestTestResult{
+				status: http.StatusOK,
+				echo:   map[string]string{"method": "PUT", "contentType": "application/x-www-form-urlencoded", "body": "age=36&name=Ada"},
+			},
+		},
+		{
+			name:   "PATCH Raw Body",
+			path:   "/echo",
+			params: map[string]interface{}{"method": "PATCH", "bodyType": "raw", "body": "hello"},
+			wants: requestTestResult{
+				status: http.StatusOK,
+				echo:   map[string]string{"method": "PATCH", "contentType": "text/plain", "body": "hello"},
+			},
+		},
+		{
+			name:   "Headers",
+			path:   "/echo",
+			params: map[string]interface{}{"headers": map[string]interface{}{"X-Custom": "yes"}},
+			wants: requestTestResult{
+				status: http.StatusOK,
+				echo:   map[string]string{"custom": "yes"},
+			},
+		},
+		{
+			name: "Idempotency Header",
+			path: "/echo",
+			params: map[string]interface{}{
+				"idempotencyHeader":          "Idempotency-Key",
+				executor.ParamIdempotencyKey: "key-1",
+			},
+			wants: requestTestResult{
+				status: http.StatusOK,
+				echo:   map[string]string{"idempotencyKey": "key-1"},
+			},
+		},
+		{
+			name: "Bearer Connection",
+			path: "/echo",
+			params: map[string]interface{}{
+				"connectionId":            "c1",
+				executor.ParamWorkspaceId: "w1",
+			},
+			wants: requestTestResult{
+				status: http.StatusOK,
+				echo:   map[string]string{"authorization": "Bearer secret"},
+			},
+		},
+		{
+			name:  "Text Response",
+			path:  "/text",
+			wants: requestTestResult{status: http.StatusOK, body: "hello"},
+		},
+		{
+			name:  "Error Status Fails",
+			path:  "/status/500",
+			wants: requestTestResult{status: http.StatusInternalServerError, err: "request failed with status 500"},
+		},
+		{
+			name:   "Error Status Kept Without failOnErrorStatus",
+			path:   "/status/404",
+			params: map[string]interface{}{"failOnErrorStatus": false},
+			wants:  requestTestResult{status: http.StatusNotFound},
+		},
+		{
+			name:   "Unsupported Method Should Error",
+			path:   "/echo",
+			params: map[string]interface{}{"method": "TRACE"},
+			wants:  requestTestResult{err: `method "TRACE" is not supported`},
+		},
+		{
+			name:   "Unsupported Body Type Should Error",
+			path:   "/echo",
+			params: map[string]interface{}{"method": "POST", "bodyType": "xml", "body": "<a/>"},
+			wants:  requestTestResult{err: `body type "xml" is not supported`},
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			params := map[string]interface{}{"url": server.URL + tt.path}
+			for k, v := range tt.params {
+				params[k] = v
+			}
+
+			output, err := e.Execute(context.Background(), httpprovider.ProviderName, "Request", params)
+
+			if tt.wants.err != "" {
+				assert.Error(t, err)
+				assert.StringContains(t, err.Error(), tt.wants.err)
+			} else {
+				assert.NilError(t, err)
+			}
+
+			if tt.wants.status == 0 {
+				return
+			}
+
+			assert.Equal(t, output["responseStatus"], interface{}(tt.wants.status))
+
+			if tt.wants.body != nil {
+				assert.Equal(t, output["responseBody"], tt.wants.body)
+			}
+
+			if tt.wants.echo == nil {
+				return
+			}
+
+			headers, _ := output["responseHeaders"].(map[string]interface{})
+			assert.Equal(t, headers["X-Served-By"], interface{}("echo"))
+
+			echo, _ := output["responseBody"].(map[string]interface{})
+			for key, want := range tt.wants.echo {
+				assert.Equal(t, echo[key], interface{}(want))
+			}
+		})
+	}
+}
+
+func TestRequestHostRules(t *testing.T) {
+	server := newEchoServer(t)
+
+	testMap := []struct {
+		name    string
+		allowed []string
+		denied  []string
+		err     error
+	}{
+		{
+			name:    "Allowed Host",
+			allowed: []string{"127.0.0.1"},
+		},
+		{
+			name:    "Allowed Network",
+			allowed: []string{"127.0.0.0/8"},
+		},
+		{
+			name: "Internal Host Without Allow List Should Error",
+			err:  httpprovider.ErrHostDenied,
+		},
+		{
+			name:    "Host Missing From Allow List Should Error",
+			allowed: []string{"api.example.com"},
+			err:     httpprovider.ErrHostNotAllowed,
+		},
+		{
+			name:    "Denied Host Should Error Even When Allowed",
+			allowed: []string{"127.0.0.1"},
+			denied:  []string{"127.0.0.0/8"},
+			err:     httpprovider.ErrHostDenied,
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newExecutor(t, httpprovider.Config{AllowedHosts: tt.allowed, DeniedHosts: tt.denied}, nil)
+
+			params := map[string]interface{}{"url": server.URL + "/echo"}
+
+			output, err := e.Execute(context.Background(), httpprovider.ProviderName, "Request", params)
+
+			if tt.err != nil {
+				assert.Equal(t, errors.Is(err, tt.err), true)
+				assert.Equal(t, output["responseStatus"], nil)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, output["responseStatus"], interface{}(http.StatusOK))
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package system
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/executor"
+)
+
+// Events
+
+// delay suspends the run for duration. The runner persists resumeAt, so the
+// timer survives restarts and nothing sleeps while it runs down.
+func delay(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+	duration, ok, err := DurationParam(params, "duration")
+	if err != nil {
+		return params, err
+	}
+
+	if !ok {
+		return params, fmt.Errorf("duration not found or it is not correct format")
+	}
+
+	if duration < 0 {
+		return params, fmt.Errorf("duration must not be negative")
+	}
+
+	if duration == 0 {
+		return params, nil
+	}
+
+	params[executor.ParamResumeAt] = time.Now().Add(duration).Format(time.RFC3339)
+
+	return params, executor.ErrWaiting
+}
+
+// waitUntil suspends the run until the until timestamp. Timestamps in the
+// past let the run continue right away.
+func waitUntil(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+	until, ok, err := TimeParam(params, "until")
+	if err != nil {
+		return params, err
+	}
+
+	if !ok {
+		return params, fmt.Errorf("until not found or it is not correct format")
+	}
+
+	if !until.After(time.Now()) {
+		return params, nil
+	}
+
+	params[executor.ParamResumeAt] = until.Format(time.RFC3339)
+
+	return params, executor.ErrWaiting
+}
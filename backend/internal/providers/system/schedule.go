@@ -0,0 +1,246 @@
+package system
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/executor"
+	"github.com/luisya22/confluo/backend/internal/validator"
+	"github.com/robfig/cron/v3"
+)
+
+// Catch-up policies for occurrences that were due while the server was down.
+const (
+	// CatchUpSkip drops missed occurrences and only fires when the latest
+	// one is still within the misfire grace period.
+	CatchUpSkip = "skip"
+	// CatchUpLatest fires once for the latest missed occurrence.
+	CatchUpLatest = "latest"
+	// CatchUpAll fires once per missed occurrence, oldest first.
+	CatchUpAll = "all"
+)
+
+const (
+	defaultMisfireGrace = time.Minute
+	minInterval         = time.Minute
+)
+
+type scheduleSpec struct {
+	next  func(time.Time) time.Time
+	first func(time.Time) time.Time
+	// last returns the last occurrence from due up to limit and how many
+	// occurrences there are in between, due and the last one included.
+	last     func(due, limit time.Time) (time.Time, int)
+	location *time.Location
+	startAt  time.Time
+	endAt    time.Time
+	catchUp  string
+	grace    time.Duration
+}
+
+// Triggers
+
+// schedule fires on a cron expression or a fixed interval. lastFire is the
+// cursor: the occurrence that fired last, persisted between polls.
+func schedule(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+	return evaluateSchedule(params, time.Now())
+}
+
+func evaluateSchedule(params map[string]interface{}, now time.Time) (map[string]interface{}, error) {
+	spec, err := parseSchedule(params)
+	if err != nil {
+		return params, err
+	}
+
+	lastFire, hasLastFire, err := TimeParam(params, "lastFire")
+	if err != nil {
+		return params, err
+	}
+
+	var due time.Time
+
+	switch {
+	case hasLastFire:
+		due = spec.next(lastFire)
+	case !spec.startAt.IsZero():
+		due = spec.first(spec.startAt)
+	default:
+		// A new schedule starts counting from now instead of firing for
+		// everything that happened before it was enabled.
+		params["lastFire"] = now.Format(time.RFC3339)
+		return params, executor.ErrNotTriggered
+	}
+
+	// A cron expression that never matches, e.g. February 30th, has no
+	// next occurrence.
+	if due.IsZero() || due.After(now) || spec.pastEnd(due) {
+		return params, executor.ErrNotTriggered
+	}
+
+	limit := now
+	if spec.pastEnd(now) {
+		limit = spec.endAt
+	}
+
+	fire, count := spec.last(due, limit)
+
+	switch spec.catchUp {
+	case CatchUpAll:
+		fire = due
+	case CatchUpSkip:
+		if now.Sub(fire) > spec.grace {
+			params["lastFire"] = fire.Format(time.RFC3339)
+			return params, executor.ErrNotTriggered
+		}
+	}
+
+	params["lastFire"] = fire.Format(time.RFC3339)
+	params["scheduledTime"] = fire.In(spec.location).Format(time.RFC3339)
+	params["firedAt"] = now.In(spec.location).Format(time.RFC3339)
+	params["missedCount"] = count - 1
+	params[executor.ParamDedupeKey] = fire.UTC().Format(time.RFC3339)
+
+	return params, nil
+}
+
+func parseSchedule(params map[string]interface{}) (*scheduleSpec, error) {
+	spec := &scheduleSpec{
+		location: time.UTC,
+		catchUp:  CatchUpLatest,
+		grace:    defaultMisfireGrace,
+	}
+
+	if tz, ok := params["timezone"].(string); ok && tz != "" {
+		location, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone: %w", err)
+		}
+		spec.location = location
+	}
+
+	cronExpr, _ := params["cron"].(string)
+	interval, hasInterval, err := DurationParam(params, "interval")
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case cronExpr != "" && hasInterval:
+		return nil, fmt.Errorf("only one of cron or interval can be set")
+
+	case cronExpr != "":
+		s, err := cron.ParseStandard(cronExpr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression: %w", err)
+		}
+
+		spec.next = func(t time.Time) time.Time {
+			return s.Next(t.In(spec.location))
+		}
+		spec.first = func(t time.Time) time.Time {
+			return s.Next(t.In(spec.location).Add(-time.Second))
+		}
+		// Cron occurrences have no closed form, so they are walked one by
+		// one. Cron fires at most once a minute, so a year of downtime is
+		// about half a million steps.
+		spec.last = func(due, limit time.Time) (time.Time, int) {
+			last, count := due, 1
+			for n := spec.next(last); !n.IsZero() && !n.After(limit); n = spec.next(n) {
+				last = n
+				count++
+			}
+
+			return last, count
+		}
+
+	case hasInterval:
+		if interval < minInterval {
+			return nil, fmt.Errorf("interval must be at least %s", minInterval)
+		}
+
+		spec.next = func(t time.Time) time.Time {
+			return t.Add(interval)
+		}
+		spec.first = func(t time.Time) time.Time {
+			return t
+		}
+		spec.last = func(due, limit time.Time) (time.Time, int) {
+			n := int(limit.Sub(due) / interval)
+			return due.Add(time.Duration(n) * interval), n + 1
+		}
+
+	default:
+		return nil, fmt.Errorf("cron or interval must be provided")
+	}
+
+	if spec.startAt, _, err = TimeParam(params, "startAt"); err != nil {
+		return nil, err
+	}
+
+	if spec.endAt, _, err = TimeParam(params, "endAt"); err != nil {
+		return nil, err
+	}
+
+	if catchUp, ok := params["catchUp"].(string); ok && catchUp != "" {
+		if !validator.PermittedValue(catchUp, CatchUpSkip, CatchUpLatest, CatchUpAll) {
+			return nil, fmt.Errorf("invalid catchUp value %q", catchUp)
+		}
+		spec.catchUp = catchUp
+	}
+
+	grace, hasGrace, err := DurationParam(params, "misfireGrace")
+	if err != nil {
+		return nil, err
+	}
+
+	if hasGrace {
+		spec.grace = grace
+	}
+
+	return spec, nil
+}
+
+func (spec *scheduleSpec) pastEnd(t time.Time) bool {
+	return !spec.endAt.IsZero() && t.After(spec.endAt)
+}
+
+// TimeParam reads an RFC3339 timestamp.
+func TimeParam(params map[string]interface{}, key string) (time.Time, bool, error) {
+	s, ok := params[key].(string)
+	if !ok || s == "" {
+		return time.Time{}, false, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%s must be an RFC3339 timestamp", key)
+	}
+
+	return t, true, nil
+}
+
+// DurationParam accepts seconds as a number or a duration string like "15m".
+func DurationParam(params map[string]interface{}, key string) (time.Duration, bool, error) {
+	switch v := params[key].(type) {
+	case nil:
+		return 0, false, nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), true, nil
+	case int:
+		return time.Duration(v) * time.Second, true, nil
+	case string:
+		if v == "" {
+			return 0, false, nil
+		}
+
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid %s: %w", key, err)
+		}
+
+		return d, true, nil
+	default:
+		return 0, false, fmt.Errorf("%s is not correct format", key)
+	}
+}
@@ -0,0 +1,236 @@
+package system
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/executor"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestEvaluateSchedule(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 30, 0, time.UTC)
+
+	testMap := []struct {
+		name          string
+		params        map[string]interface{}
+		notTriggered  bool
+		lastFire      string
+		scheduledTime string
+		missedCount   int
+		shouldError   bool
+	}{
+		{
+			name:         "New Schedule Starts Counting From Now",
+			params:       map[string]interface{}{"cron": "* * * * *"},
+			notTriggered: true,
+			lastFire:     "2024-03-10T12:00:30Z",
+		},
+		{
+			name:          "Cron Due",
+			params:        map[string]interface{}{"cron": "* * * * *", "lastFire": "2024-03-10T11:59:00Z"},
+			lastFire:      "2024-03-10T12:00:00Z",
+			scheduledTime: "2024-03-10T12:00:00Z",
+		},
+		{
+			name:         "Cron Not Due",
+			params:       map[string]interface{}{"cron": "0 * * * *", "lastFire": "2024-03-10T12:00:00Z"},
+			notTriggered: true,
+			lastFire:     "2024-03-10T12:00:00Z",
+		},
+		{
+			name:          "Interval Due",
+			params:        map[string]interface{}{"interval": "15m", "lastFire": "2024-03-10T11:45:00Z"},
+			lastFire:      "2024-03-10T12:00:00Z",
+			scheduledTime: "2024-03-10T12:00:00Z",
+		},
+		{
+			name: "Cron In Time Zone",
+			params: map[string]interface{}{
+				"cron":     "0 8 * * *",
+				"timezone": "America/New_York",
+				"lastFire": "2024-03-09T13:00:00Z",
+			},
+			// Daylight saving time started in New York that morning.
+			lastFire:      "2024-03-10T08:00:00-04:00",
+			scheduledTime: "2024-03-10T08:00:00-04:00",
+		},
+		{
+			name: "Cron In Time Zone Not Due",
+			params: map[string]interface{}{
+				"cron":     "0 8 * * *",
+				"timezone": "Asia/Tokyo",
+				"lastFire": "2024-03-09T23:00:00Z",
+			},
+			notTriggered: true,
+			lastFire:     "2024-03-09T23:00:00Z",
+		},
+		{
+			name: "Start At Fires The First Occurrence",
+			params: map[string]interface{}{
+				"interval": "1h",
+				"startAt":  "2024-03-10T12:00:00Z",
+			},
+			lastFire:      "2024-03-10T12:00:00Z",
+			scheduledTime: "2024-03-10T12:00:00Z",
+		},
+		{
+			name: "Start At In The Future",
+			params: map[string]interface{}{
+				"interval": "1h",
+				"startAt":  "2024-03-11T00:00:00Z",
+			},
+			notTriggered: true,
+		},
+		{
+			name: "Past End At",
+			params: map[string]interface{}{
+				"interval": "15m",
+				"lastFire": "2024-03-10T11:00:00Z",
+				"endAt":    "2024-03-10T11:10:00Z",
+			},
+			notTriggered: true,
+			lastFire:     "2024-03-10T11:00:00Z",
+		},
+		{
+			name: "End At Stops Catching Up",
+			params: map[string]interface{}{
+				"interval":     "15m",
+				"lastFire":     "2024-03-10T10:00:00Z",
+				"endAt":        "2024-03-10T11:20:00Z",
+				"misfireGrace": "24h",
+			},
+			lastFire:      "2024-03-10T11:15:00Z",
+			scheduledTime: "2024-03-10T11:15:00Z",
+			missedCount:   4,
+		},
+		{
+			name: "Catch Up Latest",
+			params: map[string]interface{}{
+				"cron":     "0 * * * *",
+				"lastFire": "2024-03-10T08:00:00Z",
+				"catchUp":  CatchUpLatest,
+			},
+			lastFire:      "2024-03-10T12:00:00Z",
+			scheduledTime: "2024-03-10T12:00:00Z",
+			missedCount:   3,
+		},
+		{
+			name: "Catch Up All",
+			params: map[string]interface{}{
+				"cron":     "0 * * * *",
+				"lastFire": "2024-03-10T08:00:00Z",
+				"catchUp":  CatchUpAll,
+			},
+			lastFire:      "2024-03-10T09:00:00Z",
+			scheduledTime: "2024-03-10T09:00:00Z",
+			missedCount:   3,
+		},
+		{
+			name: "Catch Up Skip Within Grace",
+			params: map[string]interface{}{
+				"cron":     "0 * * * *",
+				"lastFire": "2024-03-10T08:00:00Z",
+				"catchUp":  CatchUpSkip,
+			},
+			lastFire:      "2024-03-10T12:00:00Z",
+			scheduledTime: "2024-03-10T12:00:00Z",
+			missedCount:   3,
+		},
+		{
+			name: "Catch Up Skip Past Grace",
+			params: map[string]interface{}{
+				"cron":         "0 * * * *",
+				"lastFire":     "2024-03-10T08:00:00Z",
+				"catchUp":      CatchUpSkip,
+				"misfireGrace": "10s",
+			},
+			notTriggered: true,
+			lastFire:     "2024-03-10T12:00:00Z",
+		},
+		{
+			name: "Long Outage Cron",
+			params: map[string]interface{}{
+				"cron":     "* * * * *",
+				"lastFire": "2024-02-10T12:00:00Z",
+			},
+			lastFire:      "2024-03-10T12:00:00Z",
+			scheduledTime: "2024-03-10T12:00:00Z",
+			missedCount:   29*24*60 - 1,
+		},
+		{
+			name: "Long Outage Interval",
+			params: map[string]interface{}{
+				"interval": "1m",
+				"lastFire": "2020-03-10T12:00:00Z",
+			},
+			lastFire:      "2024-03-10T12:00:00Z",
+			scheduledTime: "2024-03-10T12:00:00Z",
+			missedCount:   int(now.Sub(time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC))/time.Minute) - 1,
+		},
+		{
+			name: "Cron That Never Matches",
+			params: map[string]interface{}{
+				"cron":     "0 0 30 2 *",
+				"lastFire": "2024-03-10T11:00:00Z",
+			},
+			notTriggered: true,
+			lastFire:     "2024-03-10T11:00:00Z",
+		},
+		{
+			name:        "Cron And Interval Should Error",
+			params:      map[string]interface{}{"cron": "* * * * *", "interval": "1h"},
+			shouldError: true,
+		},
+		{
+			name:        "Interval Too Short Should Error",
+			params:      map[string]interface{}{"interval": "30s"},
+			shouldError: true,
+		},
+		{
+			name:        "Invalid Time Zone Should Error",
+			params:      map[string]interface{}{"cron": "* * * * *", "timezone": "Mars/Olympus"},
+			shouldError: true,
+		},
+		{
+			name:        "Invalid Catch Up Should Error",
+			params:      map[string]interface{}{"cron": "* * * * *", "catchUp": "some"},
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := evaluateSchedule(tt.params, now)
+
+			if tt.shouldError {
+				assert.Error(t, err)
+				assert.Equal(t, errors.Is(err, executor.ErrNotTriggered), false)
+				return
+			}
+
+			lastFire, _ := params["lastFire"].(string)
+			assert.Equal(t, lastFire, tt.lastFire)
+
+			if tt.notTriggered {
+				assert.Equal(t, errors.Is(err, executor.ErrNotTriggered), true)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, params["scheduledTime"].(string), tt.scheduledTime)
+			assert.Equal(t, params["missedCount"].(int), tt.missedCount)
+			assert.Equal(t, params["firedAt"].(string), now.In(mustLocation(t, tt.params)).Format(time.RFC3339))
+		})
+	}
+}
+
+func mustLocation(t *testing.T, params map[string]interface{}) *time.Location {
+	tz, _ := params["timezone"].(string)
+
+	location, err := time.LoadLocation(tz)
+	assert.NilError(t, err)
+
+	return location
+}
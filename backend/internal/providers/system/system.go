@@ -0,0 +1,20 @@
+package system
+
+import (
+	"github.com/luisya22/confluo/backend/internal/executor"
+)
+
+const ProviderName = "System"
+
+func Initialize(e *executor.Executor) {
+	actions := make(executor.Provider)
+
+	actions["Schedule"] = schedule
+
+	actions["Delay"] = delay
+	actions["Wait Until"] = waitUntil
+
+	actions["Transform"] = transform
+
+	e.Subscribe(ProviderName, actions)
+}
@@ -0,0 +1,143 @@
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+const (
+	maxExpressions      = 50
+	maxExpressionLength = 4096
+	maxExpressionNodes  = 1000
+
+	// maxExpressionMemory is how many list elements, map entries and string
+	// bytes a single expression may allocate.
+	maxExpressionMemory = 1_000_000
+	// maxEvaluationTime is how long a single expression may run.
+	maxEvaluationTime = time.Second
+)
+
+// Events
+
+// transform evaluates expressions, a map from output key to expression,
+// over the params and adds each result under its key. Every expression sees
+// the params as they were before the step, not the results of the others.
+//
+// Expressions use the expr language (https://expr-lang.org): string
+// functions, math, dates, member access into nested params and filter/map
+// over lists. It has no loops and no access to the filesystem or the
+// network. Each expression runs within maxExpressionMemory and stops after
+// maxEvaluationTime or when ctx is done, whichever comes first.
+func transform(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+	expressions, ok := params["expressions"].(map[string]interface{})
+	if !ok || len(expressions) == 0 {
+		return params, fmt.Errorf("expressions not found or it is not correct format")
+	}
+
+	if len(expressions) > maxExpressions {
+		return params, fmt.Errorf("expressions must not have more than %d entries", maxExpressions)
+	}
+
+	keys := make([]string, 0, len(expressions))
+	for key := range expressions {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	env := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		env[k] = v
+	}
+
+	results := make(map[string]interface{}, len(keys))
+
+	for _, key := range keys {
+		source, ok := expressions[key].(string)
+		if !ok {
+			return params, fmt.Errorf("expression %s must be a string", key)
+		}
+
+		value, err := evaluate(ctx, source, env)
+		if err != nil {
+			return params, fmt.Errorf("expression %s: %w", key, err)
+		}
+
+		results[key] = value
+	}
+
+	for k, v := range results {
+		params[k] = v
+	}
+
+	return params, nil
+}
+
+type evaluation struct {
+	value interface{}
+	err   error
+}
+
+// evaluate compiles and runs a single expression. The expr VM can't be
+// interrupted, so an expression that runs past its deadline is abandoned;
+// the memory budget bounds the work it can still do.
+func evaluate(ctx context.Context, source string, env map[string]interface{}) (interface{}, error) {
+	if len(source) > maxExpressionLength {
+		return nil, fmt.Errorf("must not be more than %d bytes long", maxExpressionLength)
+	}
+
+	program, err := expr.Compile(source, expr.Env(env), expr.MaxNodes(maxExpressionNodes))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxEvaluationTime)
+	defer cancel()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan evaluation, 1)
+
+	go func() {
+		machine := vm.VM{MemoryBudget: maxExpressionMemory}
+
+		value, err := machine.Run(program, env)
+		done <- evaluation{value: value, err: err}
+	}()
+
+	var value interface{}
+
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("evaluation stopped: %w", ctx.Err())
+	case result := <-done:
+		if result.err != nil {
+			return nil, result.err
+		}
+
+		value = result.value
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format(time.RFC3339), nil
+	case time.Duration:
+		return v.String(), nil
+	}
+
+	// Params are stored as JSON, so results that can't be stored are
+	// rejected here rather than when the run is saved.
+	if _, err := json.Marshal(value); err != nil {
+		return nil, fmt.Errorf("result can't be stored: %w", err)
+	}
+
+	return value, nil
+}
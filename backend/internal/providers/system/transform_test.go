@@ -0,0 +1,160 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+func TestTransform(t *testing.T) {
+	testMap := []struct {
+		name        string
+		params      map[string]interface{}
+		key         string
+		value       interface{}
+		shouldError string
+	}{
+		{
+			name: "String Functions",
+			params: map[string]interface{}{
+				"name":        "octocat",
+				"expressions": map[string]interface{}{"greeting": `"Hello " + upper(name)`},
+			},
+			key:   "greeting",
+			value: "Hello OCTOCAT",
+		},
+		{
+			name: "Nested Params And Lists",
+			params: map[string]interface{}{
+				"order":       map[string]interface{}{"items": []interface{}{1.0, 2.0, 3.0}},
+				"expressions": map[string]interface{}{"total": `sum(order.items)`},
+			},
+			key:   "total",
+			value: 6.0,
+		},
+		{
+			name: "Expressions See The Params Before The Step",
+			params: map[string]interface{}{
+				"n":           1,
+				"expressions": map[string]interface{}{"a": `n + 1`, "n": `10`, "z": `n + 1`},
+			},
+			key:   "z",
+			value: 2,
+		},
+		{
+			name: "Dates Are Stored As RFC3339",
+			params: map[string]interface{}{
+				"expressions": map[string]interface{}{"at": `date("2024-03-01T10:00:00Z")`},
+			},
+			key:   "at",
+			value: "2024-03-01T10:00:00Z",
+		},
+		{
+			name: "Durations Are Stored As Strings",
+			params: map[string]interface{}{
+				"expressions": map[string]interface{}{"wait": `duration("90m")`},
+			},
+			key:   "wait",
+			value: "1h30m0s",
+		},
+		{
+			name: "JSON Results",
+			params: map[string]interface{}{
+				"expressions": map[string]interface{}{"user": `fromJSON("{\"id\": 1}")`},
+			},
+			key:   "user",
+			value: map[string]interface{}{"id": 1.0},
+		},
+		{
+			name:        "Missing Expressions Should Error",
+			params:      map[string]interface{}{},
+			shouldError: "expressions not found",
+		},
+		{
+			name:        "Too Many Expressions Should Error",
+			params:      map[string]interface{}{"expressions": manyExpressions(maxExpressions + 1)},
+			shouldError: "must not have more than",
+		},
+		{
+			name: "Expression Not A String Should Error",
+			params: map[string]interface{}{
+				"expressions": map[string]interface{}{"a": 1},
+			},
+			shouldError: "must be a string",
+		},
+		{
+			name: "Oversized Expression Should Error",
+			params: map[string]interface{}{
+				"expressions": map[string]interface{}{"a": `"` + strings.Repeat("a", maxExpressionLength) + `"`},
+			},
+			shouldError: "bytes long",
+		},
+		{
+			name: "Too Many Nodes Should Error",
+			params: map[string]interface{}{
+				"expressions": map[string]interface{}{"a": strings.Repeat("1+", maxExpressionNodes) + "1"},
+			},
+			shouldError: "exceeds maximum allowed nodes",
+		},
+		{
+			name: "Memory Budget Should Error",
+			params: map[string]interface{}{
+				"expressions": map[string]interface{}{"a": `len(0..2000000)`},
+			},
+			shouldError: "memory budget exceeded",
+		},
+		{
+			name: "Result That Can't Be Stored Should Error",
+			params: map[string]interface{}{
+				"expressions": map[string]interface{}{"a": `1 / 0`},
+			},
+			shouldError: "result can't be stored",
+		},
+		{
+			name: "Invalid Expression Should Error",
+			params: map[string]interface{}{
+				"expressions": map[string]interface{}{"a": `unknown(`},
+			},
+			shouldError: "expression a",
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := transform(context.Background(), tt.params)
+
+			if tt.shouldError != "" {
+				assert.Error(t, err)
+				assert.StringContains(t, err.Error(), tt.shouldError)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, fmt.Sprintf("%#v", params[tt.key]), fmt.Sprintf("%#v", tt.value))
+		})
+	}
+}
+
+func TestTransformCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := transform(ctx, map[string]interface{}{
+		"expressions": map[string]interface{}{"a": `1 + 1`},
+	})
+
+	assert.Equal(t, errors.Is(err, context.Canceled), true)
+}
+
+func manyExpressions(n int) map[string]interface{} {
+	expressions := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		expressions[strings.Repeat("k", i+1)] = `1`
+	}
+
+	return expressions
+}
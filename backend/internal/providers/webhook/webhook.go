@@ -0,0 +1,321 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/executor"
+	httpprovider "github.com/luisya22/confluo/backend/internal/providers/http"
+)
+
+const ProviderName = "Webhook"
+
+// Receivers should recompute the signature over "<timestamp>.<body>" with
+// their copy of the secret, compare it in constant time and reject
+// timestamps that are too old. The delivery id stays the same across
+// redeliveries, so it can be used to drop duplicates; the idempotency key
+// also stays the same when the step sending the webhook is retried.
+const (
+	HeaderDelivery       = "X-Confluo-Delivery"
+	HeaderTimestamp      = "X-Confluo-Timestamp"
+	HeaderSignature      = "X-Confluo-Signature"
+	HeaderEvent          = "X-Confluo-Event"
+	HeaderIdempotencyKey = "X-Confluo-Idempotency-Key"
+)
+
+const attemptTimeout = 10 * time.Second
+
+// ErrNoSecret is returned by Deliver when the delivery has no connection to
+// sign it with, like when its connection was deleted. Deliveries are never
+// sent unsigned.
+var ErrNoSecret = errors.New("the delivery has no signing secret")
+
+type DeliveryStore interface {
+	Insert(d *data.WebhookDelivery) error
+	Update(d *data.WebhookDelivery) error
+	InsertAttempt(a *data.WebhookDeliveryAttempt) error
+}
+
+// Sender signs and delivers webhooks, recording every attempt. The secret
+// is kept in a webhookSecret connection of the workflow's workspace, never
+// in the step params, so it isn't shown with the workflow or recorded with
+// the run.
+type Sender struct {
+	client      *http.Client
+	deliveries  DeliveryStore
+	connections httpprovider.ConnectionStore
+}
+
+func NewSender(client *http.Client, deliveries DeliveryStore, connections httpprovider.ConnectionStore) *Sender {
+	return &Sender{
+		client:      client,
+		deliveries:  deliveries,
+		connections: connections,
+	}
+}
+
+func Initialize(e *executor.Executor, s *Sender) {
+	actions := make(executor.Provider)
+
+	actions["Send Webhook"] = s.sendWebhook
+
+	e.Subscribe(ProviderName, actions)
+}
+
+// Events
+
+func (s *Sender) sendWebhook(ctx context.Context, params map[string]interface{}) (map[string]interface{}, error) {
+	rawUrl, ok := params["url"].(string)
+	if !ok || rawUrl == "" {
+		return params, fmt.Errorf("url not found or it is not correct format")
+	}
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return params, fmt.Errorf("invalid url: %w", err)
+	}
+
+	if err := httpprovider.CheckURL(u); err != nil {
+		return params, err
+	}
+
+	if _, ok := params["secret"]; ok {
+		return params, fmt.Errorf("secret must not be a param, store it in a connection and set connectionId")
+	}
+
+	connectionId, _ := params["connectionId"].(string)
+	if connectionId == "" {
+		return params, fmt.Errorf("connectionId not found or it is not correct format")
+	}
+
+	connection, err := httpprovider.GetConnection(s.connections, params, connectionId)
+	if err != nil {
+		return params, err
+	}
+
+	if _, err := signingSecret(connection); err != nil {
+		return params, err
+	}
+
+	headers := make(map[string]string)
+	if rawHeaders, ok := params["headers"].(map[string]interface{}); ok {
+		for key, value := range rawHeaders {
+			headers[key] = fmt.Sprint(value)
+		}
+	}
+
+	if key, _ := params[executor.ParamIdempotencyKey].(string); key != "" {
+		headers[HeaderIdempotencyKey] = key
+	}
+
+	event, _ := params["event"].(string)
+	workflowActionId, _ := params[executor.ParamWorkflowActionId].(string)
+
+	delivery := &data.WebhookDelivery{
+		WorkflowActionId: sql.NullString{String: workflowActionId, Valid: workflowActionId != ""},
+		ConnectionId:     sql.NullString{String: connection.Id, Valid: true},
+		Url:              u.String(),
+		Event:            event,
+		Payload:          params["payload"],
+		Headers:          headers,
+	}
+
+	var attempt *data.WebhookDeliveryAttempt
+
+	// A dry run sends the webhook but doesn't keep a delivery for it, so
+	// it can't be redelivered either.
+	if dry, _ := params[executor.ParamDryRun].(bool); dry {
+		delivery.Id = dryDeliveryId()
+
+		attempt, err = s.attempt(ctx, delivery)
+		if err != nil {
+			return params, err
+		}
+
+		delivery.AttemptCount++
+		delivery.Status = attemptStatus(attempt)
+	} else {
+		err = s.deliveries.Insert(delivery)
+		if err != nil {
+			return params, err
+		}
+
+		attempt, err = s.Deliver(ctx, delivery)
+		if err != nil {
+			return params, err
+		}
+	}
+
+	params["deliveryId"] = delivery.Id
+
+	params["deliveryStatus"] = delivery.Status
+	params["responseStatus"] = attempt.ResponseStatus
+
+	if delivery.Status == data.DeliveryStatusFailed {
+		return params, fmt.Errorf("webhook delivery %s failed: %s", delivery.Id, attempt.Error)
+	}
+
+	return params, nil
+}
+
+// Deliver makes one attempt to send the delivery, signed with the secret
+// of its connection as it is now, and records it. A failed attempt is
+// reported through the delivery status and the attempt error; the returned
+// error is only set when the attempt couldn't be made or stored.
+func (s *Sender) Deliver(ctx context.Context, d *data.WebhookDelivery) (*data.WebhookDeliveryAttempt, error) {
+	attempt, err := s.attempt(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.deliveries.InsertAttempt(attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	d.AttemptCount++
+	d.Status = attemptStatus(attempt)
+
+	err = s.deliveries.Update(d)
+	if err != nil {
+		return nil, err
+	}
+
+	return attempt, nil
+}
+
+// attempt sends the delivery once without recording anything.
+func (s *Sender) attempt(ctx context.Context, d *data.WebhookDelivery) (*data.WebhookDeliveryAttempt, error) {
+	secret, err := s.secret(d)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(d.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, attemptTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range d.Headers {
+		req.Header.Set(key, value)
+	}
+
+	timestamp := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Confluo-Webhook")
+	req.Header.Set(HeaderDelivery, d.Id)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+
+	if d.Event != "" {
+		req.Header.Set(HeaderEvent, d.Event)
+	}
+
+	req.Header.Set(HeaderSignature, "sha256="+Sign(secret, timestamp, body))
+
+	attempt := &data.WebhookDeliveryAttempt{DeliveryId: d.Id}
+
+	start := time.Now()
+	res, err := s.client.Do(req)
+	attempt.LatencyMs = time.Since(start).Milliseconds()
+
+	if err != nil {
+		attempt.Error = err.Error()
+	} else {
+		io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+		res.Body.Close()
+
+		status := res.StatusCode
+		attempt.ResponseStatus = &status
+
+		if status < 200 || status >= 300 {
+			attempt.Error = fmt.Sprintf("receiver responded with status %d", status)
+		}
+	}
+
+	return attempt, nil
+}
+
+func attemptStatus(attempt *data.WebhookDeliveryAttempt) string {
+	if attempt.Error != "" {
+		return data.DeliveryStatusFailed
+	}
+
+	return data.DeliveryStatusDelivered
+}
+
+func dryDeliveryId() string {
+	b := make([]byte, 16)
+
+	// crypto/rand doesn't fail on the platforms we run on.
+	_, _ = rand.Read(b)
+
+	return "dry-" + hex.EncodeToString(b)
+}
+
+// secret returns the secret of the connection the delivery is signed with.
+func (s *Sender) secret(d *data.WebhookDelivery) (string, error) {
+	if !d.ConnectionId.Valid {
+		return "", ErrNoSecret
+	}
+
+	if s.connections == nil {
+		return "", fmt.Errorf("connections are not available")
+	}
+
+	connection, err := s.connections.Get(d.ConnectionId.String)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return "", ErrNoSecret
+		}
+
+		return "", err
+	}
+
+	return signingSecret(connection)
+}
+
+func signingSecret(connection *data.Connection) (string, error) {
+	if connection.Type != data.ConnectionTypeWebhookSecret {
+		return "", fmt.Errorf("connection %s must be a %s connection", connection.Id, data.ConnectionTypeWebhookSecret)
+	}
+
+	secret := connection.Credentials["secret"]
+	if secret == "" {
+		return "", fmt.Errorf("connection %s has no secret", connection.Id)
+	}
+
+	return secret, nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>".
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,204 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/executor"
+	"github.com/luisya22/confluo/backend/internal/providers/webhook"
+	"github.com/luisya22/confluo/backend/internal/tests/assert"
+)
+
+type connectionStore map[string]*data.Connection
+
+func (s connectionStore) Get(id string) (*data.Connection, error) {
+	connection, ok := s[id]
+	if !ok {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return connection, nil
+}
+
+type deliveryStore struct {
+	deliveries []*data.WebhookDelivery
+	attempts   []*data.WebhookDeliveryAttempt
+}
+
+func (s *deliveryStore) Insert(d *data.WebhookDelivery) error {
+	d.Id = strconv.Itoa(len(s.deliveries) + 1)
+	s.deliveries = append(s.deliveries, d)
+	return nil
+}
+
+func (s *deliveryStore) Update(d *data.WebhookDelivery) error {
+	return nil
+}
+
+func (s *deliveryStore) InsertAttempt(a *data.WebhookDeliveryAttempt) error {
+	s.attempts = append(s.attempts, a)
+	return nil
+}
+
+// receiver records the signature and body of the last request it got.
+type receiver struct {
+	signature string
+	timestamp string
+	body      []byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.signature = r.Header.Get(webhook.HeaderSignature)
+	rc.timestamp = r.Header.Get(webhook.HeaderTimestamp)
+	rc.body, _ = io.ReadAll(r.Body)
+}
+
+func (rc *receiver) signedWith(secret string) bool {
+	timestamp, _ := strconv.ParseInt(rc.timestamp, 10, 64)
+
+	return rc.signature == "sha256="+webhook.Sign(secret, timestamp, rc.body)
+}
+
+func newSender(t *testing.T, connections connectionStore) (*executor.Executor, *webhook.Sender, *deliveryStore, *receiver, string) {
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	t.Cleanup(server.Close)
+
+	deliveries := &deliveryStore{}
+	sender := webhook.NewSender(server.Client(), deliveries, connections)
+
+	exec := executor.NewExecutor()
+	webhook.Initialize(exec, sender)
+
+	return exec, sender, deliveries, rc, server.URL
+}
+
+func TestSendWebhook(t *testing.T) {
+	connections := connectionStore{
+		"secret": {Id: "secret", WorkspaceId: "w1", Type: data.ConnectionTypeWebhookSecret, Credentials: map[string]string{"secret": "s3cr3t"}},
+		"empty":  {Id: "empty", WorkspaceId: "w1", Type: data.ConnectionTypeWebhookSecret, Credentials: map[string]string{}},
+		"bearer": {Id: "bearer", WorkspaceId: "w1", Type: data.ConnectionTypeBearer, Credentials: map[string]string{"token": "t"}},
+		"other":  {Id: "other", WorkspaceId: "w2", Type: data.ConnectionTypeWebhookSecret, Credentials: map[string]string{"secret": "s3cr3t"}},
+	}
+
+	testMap := []struct {
+		name        string
+		params      map[string]interface{}
+		shouldError bool
+	}{
+		{
+			name:   "Signs With The Connection Secret",
+			params: map[string]interface{}{"connectionId": "secret"},
+		},
+		{
+			name:        "Missing Connection Should Error",
+			params:      map[string]interface{}{},
+			shouldError: true,
+		},
+		{
+			name:        "Secret Param Should Error",
+			params:      map[string]interface{}{"connectionId": "secret", "secret": "s3cr3t"},
+			shouldError: true,
+		},
+		{
+			name:        "Empty Secret Should Error",
+			params:      map[string]interface{}{"connectionId": "empty"},
+			shouldError: true,
+		},
+		{
+			name:        "Wrong Connection Type Should Error",
+			params:      map[string]interface{}{"connectionId": "bearer"},
+			shouldError: true,
+		},
+		{
+			name:        "Connection Of Another Workspace Should Error",
+			params:      map[string]interface{}{"connectionId": "other"},
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range testMap {
+		t.Run(tt.name, func(t *testing.T) {
+			exec, _, deliveries, rc, url := newSender(t, connections)
+
+			params := map[string]interface{}{
+				"url":                     url,
+				"payload":                 map[string]interface{}{"ok": true},
+				executor.ParamWorkspaceId: "w1",
+			}
+			for k, v := range tt.params {
+				params[k] = v
+			}
+
+			output, err := exec.Execute(context.Background(), webhook.ProviderName, "Send Webhook", params)
+
+			if tt.shouldError {
+				assert.Error(t, err)
+				assert.Equal(t, len(deliveries.deliveries), 0)
+				return
+			}
+
+			assert.NilError(t, err)
+			assert.Equal(t, output["deliveryStatus"], interface{}(data.DeliveryStatusDelivered))
+			assert.Equal(t, rc.signedWith("s3cr3t"), true)
+			assert.Equal(t, deliveries.deliveries[0].ConnectionId.String, "secret")
+		})
+	}
+}
+
+func TestDeliverUsesCurrentSecret(t *testing.T) {
+	connections := connectionStore{
+		"secret": {Id: "secret", WorkspaceId: "w1", Type: data.ConnectionTypeWebhookSecret, Credentials: map[string]string{"secret": "old"}},
+	}
+
+	exec, sender, deliveries, rc, url := newSender(t, connections)
+
+	_, err := exec.Execute(context.Background(), webhook.ProviderName, "Send Webhook", map[string]interface{}{
+		"url":                     url,
+		"connectionId":            "secret",
+		executor.ParamWorkspaceId: "w1",
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, rc.signedWith("old"), true)
+
+	connections["secret"].Credentials["secret"] = "new"
+
+	delivery := deliveries.deliveries[0]
+
+	_, err = sender.Deliver(context.Background(), delivery)
+	assert.NilError(t, err)
+	assert.Equal(t, rc.signedWith("new"), true)
+	assert.Equal(t, delivery.AttemptCount, 2)
+
+	delete(connections, "secret")
+
+	_, err = sender.Deliver(context.Background(), delivery)
+	assert.Equal(t, errors.Is(err, webhook.ErrNoSecret), true)
+	assert.Equal(t, len(deliveries.attempts), 2)
+}
+
+func TestSendWebhookDryRun(t *testing.T) {
+	connections := connectionStore{
+		"secret": {Id: "secret", WorkspaceId: "w1", Type: data.ConnectionTypeWebhookSecret, Credentials: map[string]string{"secret": "s3cr3t"}},
+	}
+
+	exec, _, deliveries, rc, url := newSender(t, connections)
+
+	output, err := exec.Execute(context.Background(), webhook.ProviderName, "Send Webhook", map[string]interface{}{
+		"url":                     url,
+		"connectionId":            "secret",
+		executor.ParamWorkspaceId: "w1",
+		executor.ParamDryRun:      true,
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, output["deliveryStatus"], interface{}(data.DeliveryStatusDelivered))
+	assert.Equal(t, rc.signedWith("s3cr3t"), true)
+	assert.Equal(t, len(deliveries.deliveries), 0)
+	assert.Equal(t, len(deliveries.attempts), 0)
+}
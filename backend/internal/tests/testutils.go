@@ -10,6 +10,7 @@ import (
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"github.com/luisya22/confluo/backend/internal/data"
+	"github.com/luisya22/confluo/backend/internal/migrations"
 	tc "github.com/testcontainers/testcontainers-go"
 
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -17,9 +18,11 @@ import (
 
 type TestData struct {
 	Users           []data.User
+	Workspaces      []data.Workspace
 	Actions         []data.Action
 	Workflows       []data.Workflow
 	WorkflowActions []data.WorkflowAction
+	Connections     []data.Connection
 }
 
 // Data struct that includes all other structs
@@ -73,8 +76,20 @@ func NewTestDB() (*sqlx.DB, error) {
 
 }
 
+// SetupDb migrates the database to the latest version and loads the test
+// data.
 func SetupDb(db *sqlx.DB) error {
-	script, err := os.ReadFile("../tests/testdata/setup.sql")
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	_, err = migrator.Up()
+	if err != nil {
+		return err
+	}
+
+	script, err := os.ReadFile("../tests/testdata/seed.sql")
 	if err != nil {
 		return err
 	}
@@ -87,13 +102,14 @@ func SetupDb(db *sqlx.DB) error {
 	return nil
 }
 
+// TeardownDb reverts every migration, dropping the test data with them.
 func TeardownDb(db *sqlx.DB) error {
-	script, err := os.ReadFile("../tests/testdata/teardown.sql")
+	migrator, err := migrations.New(db)
 	if err != nil {
 		return err
 	}
 
-	_, err = db.Exec(string(script))
+	_, err = migrator.To(0)
 	if err != nil {
 		fmt.Println(err)
 		return err
@@ -116,6 +132,11 @@ func LoadTestData() {
 		{Id: "550e8400-e29b-41d4-a716-446655440006"},
 	}
 
+	workspaces := []data.Workspace{
+		{Id: users[0].Id, Name: "Personal", Role: data.RoleOwner, Version: 1},
+		{Id: users[1].Id, Name: "Personal", Role: data.RoleOwner, Version: 1},
+	}
+
 	providers := []data.Provider{
 		{
 			Id:        "c4f9b885-2df5-4b1b-9fa4-81f87f824da8",
@@ -164,24 +185,110 @@ func LoadTestData() {
 			UpdatedAt:  time.Now(),
 			Version:    1,
 		},
+		{
+			Id:         "550e8400-e29b-41d4-a716-446655440013",
+			Operation:  "Schedule",
+			ProviderId: providers[0].Id,
+			Provider:   providers[0],
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+			Version:    1,
+		},
+		{
+			Id:         "550e8400-e29b-41d4-a716-446655440014",
+			Operation:  "Delay",
+			ProviderId: providers[0].Id,
+			Provider:   providers[0],
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+			Version:    1,
+		},
+		{
+			Id:         "550e8400-e29b-41d4-a716-446655440015",
+			Operation:  "Wait Until",
+			ProviderId: providers[0].Id,
+			Provider:   providers[0],
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+			Version:    1,
+		},
+		{
+			Id:         "550e8400-e29b-41d4-a716-446655440016",
+			Operation:  "For Each",
+			ProviderId: providers[0].Id,
+			Provider:   providers[0],
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+			Version:    1,
+		},
+		{
+			Id:         "550e8400-e29b-41d4-a716-446655440017",
+			Operation:  "Parallel",
+			ProviderId: providers[0].Id,
+			Provider:   providers[0],
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+			Version:    1,
+		},
+		{
+			Id:         "550e8400-e29b-41d4-a716-446655440018",
+			Operation:  "Join",
+			ProviderId: providers[0].Id,
+			Provider:   providers[0],
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+			Version:    1,
+		},
+		{
+			Id:         "550e8400-e29b-41d4-a716-446655440019",
+			Operation:  "Call Workflow",
+			ProviderId: providers[0].Id,
+			Provider:   providers[0],
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+			Version:    1,
+		},
+		{
+			Id:         "550e8400-e29b-41d4-a716-446655440020",
+			Operation:  "Transform",
+			ProviderId: providers[0].Id,
+			Provider:   providers[0],
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+			Version:    1,
+		},
+	}
+
+	connections := []data.Connection{
+		{
+			Id:          "550e8400-e29b-41d4-a716-446655440012",
+			UserId:      users[0].Id,
+			WorkspaceId: workspaces[0].Id,
+			Name:        "Internal API",
+			Type:        data.ConnectionTypeBearer,
+			Credentials: map[string]string{"token": "secret-token"},
+			Version:     1,
+		},
 	}
 
 	workflows := []data.Workflow{
 		{
-			Id:        "550e8400-e29b-41d4-a716-446655440002",
-			UserId:    users[0].Id,
-			Name:      "User Onboarding",
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-			Version:   1,
+			Id:          "550e8400-e29b-41d4-a716-446655440002",
+			UserId:      users[0].Id,
+			WorkspaceId: workspaces[0].Id,
+			Name:        "User Onboarding",
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+			Version:     1,
 		},
 		{
-			Id:        "550e8400-e29b-41d4-a716-446655440009",
-			UserId:    "550e8400-e29b-41d4-a716-446655440006",
-			Name:      "Document Approval",
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-			Version:   1,
+			Id:          "550e8400-e29b-41d4-a716-446655440009",
+			UserId:      "550e8400-e29b-41d4-a716-446655440006",
+			WorkspaceId: workspaces[1].Id,
+			Name:        "Document Approval",
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+			Version:     1,
 		},
 	}
 
@@ -244,8 +351,10 @@ func LoadTestData() {
 
 	Data = TestData{
 		Users:           users,
+		Workspaces:      workspaces,
 		Actions:         actions,
 		Workflows:       workflows,
 		WorkflowActions: workflowActions,
+		Connections:     connections,
 	}
 }
@@ -1,15 +1,45 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"log"
+	"os"
 
 	"github.com/luisya22/confluo/backend/api"
 )
 
 func main() {
-	app := api.NewApplication(api.Config{})
+	cfg, args, err := api.LoadConfig(os.Args[1:], os.Getenv, os.Stderr)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+
+		log.Fatal(err)
+	}
+
+	if len(args) > 0 {
+		if args[0] != "migrate" {
+			log.Fatalf("unknown command %q", args[0])
+		}
+
+		err = api.Migrate(cfg, args[1:], os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	app := api.NewApplication(cfg)
 
-	err := app.Serve()
+	err = app.Serve()
 	if err != nil {
 		log.Fatal(err)
 	}